@@ -0,0 +1,138 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+var airQualityLog = NewLogger("airquality")
+
+/* Station data from the `waqi.info` API, `AQI` is a number or `-` when the
+ * station has no current reading. */
+type AirQualityAPIData struct {
+	AQI  json.RawMessage `json:"aqi"`
+	City struct {
+		Name string `json:"name"`
+	} `json:"city"`
+}
+
+/* Result from the `waqi.info` API, `Data` holds an error message instead of
+ * station data when `Status` is not `ok`. */
+type AirQualityAPIResult struct {
+	Status string          `json:"status"`
+	Data   json.RawMessage `json:"data"`
+}
+
+/* Parse a response of the `waqi.info` API into the air quality index. */
+func ParseAirQuality(body []byte) (int, error) {
+	var apiResult AirQualityAPIResult
+	var apiData AirQualityAPIData
+	var aqi float64
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return 0, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if apiResult.Status != "ok" {
+		var message string
+
+		json.Unmarshal(apiResult.Data, &message)
+
+		return 0, fmt.Errorf("the response status was `%s`: %s", apiResult.Status, message)
+	}
+
+	if err := json.Unmarshal(apiResult.Data, &apiData); err != nil {
+		return 0, fmt.Errorf("could not parse the station data: %w", err)
+	}
+
+	if err := json.Unmarshal(apiData.AQI, &aqi); err != nil {
+		return 0, fmt.Errorf("the station has no current reading")
+	}
+
+	return int(aqi), nil
+}
+
+/* Map an air quality index to the category of the US EPA scale. */
+func AirQualityCategory(aqi int) string {
+	switch {
+	case aqi <= 50:
+		return "good"
+	case aqi <= 100:
+		return "moderate"
+	case aqi <= 150:
+		return "unhealthy_for_sensitive_groups"
+	case aqi <= 200:
+		return "unhealthy"
+	case aqi <= 300:
+		return "very_unhealthy"
+	default:
+		return "hazardous"
+	}
+}
+
+/* Call the `waqi.info` API and return the air quality index. */
+func AirQualityAPICall(ctx context.Context, apiUrl string) (int, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return ParseAirQuality(body)
+}
+
+/* A loop that waits between calls to the `waqi.info` API and submits the
+ * air quality index and its category to subtopics of the topic given in
+ * the environment variable `AIRQUALITY_TOPIC`. */
+func AirQualityLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	tokenFromEnv, tokenExists := cfg.Lookup("AIRQUALITY_TOKEN")
+
+	if !tokenExists {
+		airQualityLog.Println("AirQualityLoop needs `AIRQUALITY_TOKEN` set in the environment, disabled.")
+		return
+	}
+
+	if errors.Is(cfg.CoordinatesErr, ErrCoordinatesMissing) {
+		airQualityLog.Println("AirQualityLoop needs `AIRQUALITY_LATITUDE` and `AIRQUALITY_LONGITUDE`, or `MAGPIE_LATITUDE` and `MAGPIE_LONGITUDE`, set in the environment, disabled.")
+		return
+	}
+
+	if cfg.CoordinatesErr != nil {
+		airQualityLog.Warnf("AirQualityLoop could not use its coordinates: %s, disabled.\n", cfg.CoordinatesErr)
+		return
+	}
+
+	airQualityLog.Println("AirQualityLoop enabled.")
+
+	apiUrl := fmt.Sprintf("https://api.waqi.info/feed/geo:%f;%f/?token=%s", cfg.Coordinates.Latitude, cfg.Coordinates.Longitude, url.QueryEscape(tokenFromEnv))
+
+	for {
+		var aqi int
+
+		if !fetchWithRetry(ctx, cfg, airQualityLog, "AirQualityLoop could not fetch the air quality", func() error {
+			var err error
+
+			aqi, err = AirQualityAPICall(ctx, apiUrl)
+
+			return err
+		}) {
+			return
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "aqi"), Payload: strconv.Itoa(aqi)}) {
+			return
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "category"), Payload: AirQualityCategory(aqi)}) {
+			return
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package magpie
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseAirQuality(t *testing.T) {
+	body, err := os.ReadFile("testdata/airquality.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aqi, err := ParseAirQuality(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aqi != 42 {
+		t.Fatalf("expected an air quality index of 42, got %d", aqi)
+	}
+}
+
+func TestParseAirQualityWithoutReading(t *testing.T) {
+	for _, body := range []string{
+		`{"status":"error","data":"Invalid key"}`,
+		`{"status":"ok","data":{"aqi":"-","city":{"name":"Amsterdam"}}}`,
+	} {
+		if _, err := ParseAirQuality([]byte(body)); err == nil {
+			t.Errorf("expected `%s` to be an error", body)
+		}
+	}
+}
+
+func TestAirQualityCategory(t *testing.T) {
+	for _, c := range []struct {
+		aqi      int
+		category string
+	}{
+		{aqi: 0, category: "good"},
+		{aqi: 50, category: "good"},
+		{aqi: 51, category: "moderate"},
+		{aqi: 150, category: "unhealthy_for_sensitive_groups"},
+		{aqi: 200, category: "unhealthy"},
+		{aqi: 300, category: "very_unhealthy"},
+		{aqi: 301, category: "hazardous"},
+	} {
+		if category := AirQualityCategory(c.aqi); category != c.category {
+			t.Errorf("AirQualityCategory(%d) = %s, expected %s", c.aqi, category, c.category)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package magpie
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+/* Doubling wait between retries starting at `Base` and capped at `Max`. */
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	current time.Duration
+}
+
+func NewBackoff(base time.Duration, max time.Duration) *Backoff {
+	return &Backoff{Base: base, Max: max}
+}
+
+/* Return the wait before the next retry and double the one after it. */
+func (b *Backoff) Next() time.Duration {
+	if b.current == 0 {
+		b.current = b.Base
+	}
+
+	wait := b.current
+
+	if b.current *= 2; b.current > b.Max {
+		b.current = b.Max
+	}
+
+	if wait > b.Max {
+		wait = b.Max
+	}
+
+	return wait
+}
+
+/* Start over at `Base`, call after a success. */
+func (b *Backoff) Reset() {
+	b.current = 0
+}
+
+/* First wait after a failure in `retryWithBackoff`. */
+const retryBase = 10 * time.Second
+
+/* Spread a wait between half and all of it so sources that fail at the same
+ * time do not retry at the same time. Replaceable for deterministic tests. */
+var retryJitter = func(wait time.Duration) time.Duration {
+	return wait/2 + rand.N(wait/2+1)
+}
+
+/* Call `fn` until it succeeds, waiting a doubling and jittered time capped
+ * at `max` between attempts. Reports false when the context is done before
+ * `fn` succeeded. */
+func retryWithBackoff(ctx context.Context, fn func() error, max time.Duration) bool {
+	backoff := NewBackoff(retryBase, max)
+
+	for fn() != nil {
+		if !sleepContext(ctx, retryJitter(backoff.Next())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/* Fetch the upstream of a source until it succeeds as `retryWithBackoff`
+ * does, every failure is counted for the source and logged as `failure`
+ * followed by the error. The success marks the source as updated. Reports
+ * false when the context is done first. */
+func fetchWithRetry(ctx context.Context, cfg SourceConfig, log *Logger, failure string, fetch func() error) bool {
+	if !retryWithBackoff(ctx, func() error {
+		err := fetch()
+
+		if err != nil {
+			FetchErrors.Inc(cfg.Name)
+			log.Warnf("%s, retrying: %s.\n", failure, err)
+		}
+
+		return err
+	}, cfg.BackoffMax) {
+		return false
+	}
+
+	LastUpdates.Mark(cfg.Name, cfg.Now())
+
+	return true
+}
@@ -0,0 +1,109 @@
+package magpie
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	backoff := NewBackoff(time.Second, 5*time.Second)
+
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if wait := backoff.Next(); wait != expected {
+			t.Fatalf("expected a wait of %s, got %s", expected, wait)
+		}
+	}
+
+	backoff.Reset()
+
+	if wait := backoff.Next(); wait != time.Second {
+		t.Fatalf("expected a wait of 1s after a reset, got %s", wait)
+	}
+}
+
+func TestFetchWithRetryCountsEveryFailure(t *testing.T) {
+	defer func(jitter func(time.Duration) time.Duration) { retryJitter = jitter }(retryJitter)
+
+	retryJitter = func(time.Duration) time.Duration { return 0 }
+
+	cfg := SourceConfig{Name: "test-backoff-retry", BackoffMax: time.Second}
+	before := FetchErrors.Counts()[cfg.Name]
+	attempts := 0
+
+	if !fetchWithRetry(context.Background(), cfg, NewLogger("test"), "test could not fetch", func() error {
+		if attempts++; attempts < 3 {
+			return errors.New("unavailable")
+		}
+
+		return nil
+	}) {
+		t.Fatal("expected the fetch to succeed")
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	if failures := FetchErrors.Counts()[cfg.Name] - before; failures != 2 {
+		t.Fatalf("expected 2 counted errors, got %d", failures)
+	}
+}
+
+func TestFetchWithRetryStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cfg := SourceConfig{Name: "test-backoff-cancel", BackoffMax: time.Second}
+
+	if fetchWithRetry(ctx, cfg, NewLogger("test"), "test could not fetch", func() error {
+		return errors.New("unavailable")
+	}) {
+		t.Fatal("expected the fetch to give up once the context is done")
+	}
+}
+
+func TestFetchWithRetryMarksSuccess(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := SourceConfig{Name: "test-backoff-mark", BackoffMax: time.Second, Clock: FrozenClock{Time: now}}
+
+	if !fetchWithRetry(context.Background(), cfg, NewLogger("test"), "test could not fetch", func() error { return nil }) {
+		t.Fatal("expected the fetch to succeed")
+	}
+
+	if last, updated := LastUpdates.Last(cfg.Name); !updated || !last.Equal(now) {
+		t.Fatalf("expected the source to be marked at %s, got %s", now, last)
+	}
+}
+
+func TestRetryWithBackoffGrowsAndResets(t *testing.T) {
+	defer func(jitter func(time.Duration) time.Duration) { retryJitter = jitter }(retryJitter)
+
+	var waits []time.Duration
+
+	retryJitter = func(wait time.Duration) time.Duration {
+		waits = append(waits, wait)
+		return 0
+	}
+
+	failing := func(failures int) func() error {
+		return func() error {
+			if failures--; failures >= 0 {
+				return errors.New("unavailable")
+			}
+
+			return nil
+		}
+	}
+
+	retryWithBackoff(context.Background(), failing(4), time.Minute)
+	retryWithBackoff(context.Background(), failing(1), time.Minute)
+
+	expected := []time.Duration{retryBase, 2 * retryBase, 4 * retryBase, time.Minute, retryBase}
+
+	if !slices.Equal(waits, expected) {
+		t.Fatalf("expected waits of %v, got %v", expected, waits)
+	}
+}
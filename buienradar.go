@@ -1,153 +1,398 @@
 package magpie
 
 import (
+	"context"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
-	"os"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 )
 
+var weatherLog = NewLogger("weather")
+
 type WeatherAPIStationData struct {
 	Region string `xml:"regio,attr"`
 	Name   string `xml:",chardata"`
 }
 
 type WeatherAPIData struct {
-	Code              string                `xml:"stationcode"`
-	Station           WeatherAPIStationData `xml:"stationnaam"`
-	Lat               string                `xml:"lat"`
-	Lon               string                `xml:"lon"`
-	Humidity          string                `xml:"luchtvochtigheid"`
-	TemperatureGround string                `xml:"temperatuurGC"`
-	Temperature10cm   string                `xml:"temperatuur10cm"`
-	WindSpeed         string                `xml:"windsnelheidMS"`
-	GustSpeed         string                `xml:"windstotenMS"`
-	AirPressure       string                `xml:"luchtdruk"`
-	SightRange        string                `xml:"zichtmeters"`
-	SunIntensity      string                `xml:"zonintensiteitWM2"`
-	Rain              string                `xml:"regenMMPU"`
+	Code                 string                `xml:"stationcode"`
+	Station              WeatherAPIStationData `xml:"stationnaam"`
+	Timestamp            string                `xml:"datum"`
+	Lat                  string                `xml:"lat"`
+	Lon                  string                `xml:"lon"`
+	Humidity             string                `xml:"luchtvochtigheid"`
+	TemperatureGround    string                `xml:"temperatuurGC"`
+	Temperature10cm      string                `xml:"temperatuur10cm"`
+	WaterTemperature     string                `xml:"watertemperatuur"`
+	WindSpeed            string                `xml:"windsnelheidMS"`
+	GustSpeed            string                `xml:"windstotenMS"`
+	WindDirection        string                `xml:"windrichting"`
+	WindDirectionDegrees string                `xml:"windrichtingGR"`
+	AirPressure          string                `xml:"luchtdruk"`
+	SightRange           string                `xml:"zichtmeters"`
+	SunIntensity         string                `xml:"zonintensiteitWM2"`
+	Rain                 string                `xml:"regenMMPU"`
+}
+
+/* The national forecast for a single day, only the fields magpie publishes
+ * are parsed. `Snowfall` is the expected snowfall in centimeters and
+ * `RainChance` the chance of precipitation in percent. */
+type WeatherAPIForecastData struct {
+	Date       string `xml:"datum"`
+	Snowfall   string `xml:"sneeuwcms"`
+	RainChance string `xml:"kansregen"`
+}
+
+/* The metrics the weather source publishes as subtopics. */
+var WeatherMetrics = []string{
+	"humidity",
+	"temperature.ground",
+	"temperature.10cm",
+	"temperature.water",
+	"temperature.apparent",
+	"wind",
+	"gust",
+	"gust.alert",
+	"wind.bft",
+	"wind.arrow",
+	"wind.direction",
+	"wind.direction.degrees",
+	"pressure",
+	"pressure.trend",
+	"rain",
+	"sight",
+	"sun",
+	"station_count",
+	"timestamp",
+	"snowfall",
+	"snow.chance",
 }
 
 type WeatherAPIResult struct {
-	XMLName  xml.Name         `xml:"buienradarnl"`
-	Stations []WeatherAPIData `xml:"weergegevens>actueel_weer>weerstations>weerstation"`
+	XMLName  xml.Name               `xml:"buienradarnl"`
+	Stations []WeatherAPIData       `xml:"weergegevens>actueel_weer>weerstations>weerstation"`
+	Tomorrow WeatherAPIForecastData `xml:"weergegevens>verwachting_meerdaags>dag-plus1"`
 }
 
 /* The `buienradar.nl` API returns `-` when a value is not available, we convert
- * to empty string and check it later when queueing messages. */
+ * to empty string and check it later when queueing messages. Some fields use
+ * a decimal comma which is replaced by a dot. */
 func WeatherAPINormalizeValue(value string) string {
 	if value == "-" {
 		return ""
 	} else {
-		return value
+		return strings.Replace(strings.TrimSpace(value), ",", ".", 1)
+	}
+}
+
+/* Parse the time of a station's measurement, `buienradar.nl` uses
+ * `MM/DD/YYYY HH:MM:SS` in Dutch local time. */
+func ParseWeatherTimestamp(value string) (time.Time, error) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not load the Dutch timezone: %w", err)
+	}
+
+	t, err := time.ParseInLocation("01/02/2006 15:04:05", strings.TrimSpace(value), loc)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse `%s` as timestamp", value)
+	}
+
+	return t, nil
+}
+
+/* Remembers the time of the last published measurement of every station by
+ * its code, so unchanged readings are not published again. */
+type WeatherDedup map[string]time.Time
+
+/* Determine if the measurement of a station at `t` was not published yet,
+ * and remember it. */
+func (d WeatherDedup) Changed(code string, t time.Time) bool {
+	if last, exists := d[code]; exists && last.Equal(t) {
+		return false
+	}
+
+	d[code] = t
+
+	return true
+}
+
+/* Collect the metrics of a station with their values normalized, values
+ * that are missing or do not parse as a number are left out, the compass
+ * direction of the wind is the only text. The wind
+ * direction arrow is included when `arrow` is set. */
+func WeatherStationMetrics(location WeatherAPIData, arrow bool) []Metric {
+	var metrics []Metric
+
+	for _, field := range []Metric{
+		{Name: "humidity", Value: location.Humidity},
+		{Name: "temperature.ground", Value: location.TemperatureGround},
+		{Name: "temperature.10cm", Value: location.Temperature10cm},
+		{Name: "temperature.water", Value: location.WaterTemperature},
+		{Name: "wind", Value: location.WindSpeed},
+		{Name: "gust", Value: location.GustSpeed},
+		{Name: "wind.arrow", Value: location.WindDirectionDegrees},
+		{Name: "wind.direction", Value: location.WindDirection},
+		{Name: "wind.direction.degrees", Value: location.WindDirectionDegrees},
+		{Name: "pressure", Value: location.AirPressure},
+		{Name: "rain", Value: location.Rain},
+		{Name: "sight", Value: location.SightRange},
+		{Name: "sun", Value: location.SunIntensity},
+	} {
+		if field.Name == "wind.arrow" && !arrow {
+			continue
+		}
+
+		value := WeatherAPINormalizeValue(field.Value)
+
+		if len(value) == 0 {
+			continue
+		}
+
+		if field.Name == "wind.direction" {
+			metrics = append(metrics, Metric{Name: field.Name, Value: value})
+			continue
+		}
+
+		number, err := strconv.ParseFloat(value, 64)
+
+		if err != nil {
+			weatherLog.Warnf("WeatherLoop could not parse `%s='%s'` as number, skipping.\n", field.Name, field.Value)
+			continue
+		}
+
+		if field.Name == "wind.arrow" {
+			value = WindArrow(number)
+		}
+
+		metrics = append(metrics, Metric{Name: field.Name, Value: value})
+	}
+
+	return metrics
+}
+
+/* The region name of a station as used in `WEATHER_REGION`, lowercased with
+ * spaces replaced by dashes. */
+func WeatherRegionName(location WeatherAPIData) string {
+	return strings.Replace(strings.ToLower(location.Station.Region), " ", "-", -1)
+}
+
+/* Parse the comma separated region names of `WEATHER_REGION`. */
+func ParseWeatherRegions(spec string) []string {
+	var regions []string
+
+	for _, region := range strings.Split(spec, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+
+	return regions
+}
+
+/* Determine if a station is selected, by its exact `code` when given and
+ * otherwise by its region name being one of `regions`. */
+func WeatherStationSelected(location WeatherAPIData, code string, regions []string) bool {
+	if code != "" {
+		return location.Code == code
 	}
+
+	return slices.Contains(regions, WeatherRegionName(location))
 }
 
-/* Call the `buienradar.nl` API and return the array of station data. */
-func WeatherAPICall(apiUrl string) []WeatherAPIData {
-	var err error
-	var res *http.Response
+/* The topic a selected station publishes below, with more than one region
+ * every region has its own subtopic. */
+func WeatherStationTopic(topic string, location WeatherAPIData, code string, regions []string) string {
+	if code == "" && len(regions) > 1 {
+		return buildTopic(topic, WeatherRegionName(location))
+	}
+
+	return topic
+}
 
-	if res, err = http.Get(apiUrl); err != nil {
-		log.Fatalln("WeatherAPICall could not communicate with the `buienradar.nl` domain.")
+/* Describe the codes and region names of the stations for when none of them
+ * was selected. */
+func WeatherStationChoices(stations []WeatherAPIData) string {
+	var choices []string
+
+	for _, location := range stations {
+		choices = append(choices, fmt.Sprintf("%s (%s)", location.Code, WeatherRegionName(location)))
 	}
 
-	defer res.Body.Close()
+	return strings.Join(choices, ", ")
+}
+
+/* Write a table of the code, name, and region name of every station, the
+ * region name being what `WEATHER_REGION` expects. */
+func WriteWeatherStations(w io.Writer, stations []WeatherAPIData) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
 
-	body, err := io.ReadAll(res.Body)
+	fmt.Fprintln(tw, "CODE\tNAME\tREGION")
+
+	for _, location := range stations {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", location.Code, strings.TrimSpace(location.Station.Name), WeatherRegionName(location))
+	}
+
+	return tw.Flush()
+}
+
+/* Combine metrics into a single JSON object keyed by their names, values
+ * that parse as a number are emitted as numbers. */
+func WeatherJSON(metrics []Metric, names MetricNames) (string, error) {
+	values := make(map[string]any)
+
+	for _, metric := range metrics {
+		if number, err := strconv.ParseFloat(metric.Value, 64); err == nil {
+			values[names.Name(metric.Name)] = number
+		} else {
+			values[names.Name(metric.Name)] = metric.Value
+		}
+	}
+
+	payload, err := json.Marshal(values)
 
 	if err != nil {
-		log.Fatalln("WeatherAPICall could not read the response.")
+		return "", fmt.Errorf("could not serialize the weather: %w", err)
 	}
 
+	return string(payload), nil
+}
+
+/* Map a wind direction in degrees to the nearest of eight compass arrows,
+ * `0` being north. */
+func WindArrow(degrees float64) string {
+	arrows := []string{"↑", "↗", "→", "↘", "↓", "↙", "←", "↖"}
+
+	return arrows[int(math.Mod(math.Mod(degrees+22.5, 360)+360, 360)/45)%len(arrows)]
+}
+
+/* Parse the XML feed of `buienradar.nl` into the station data and
+ * forecast. */
+func ParseWeather(body []byte) (WeatherAPIResult, error) {
 	var apiResult WeatherAPIResult
 
 	if err := xml.Unmarshal(body, &apiResult); err != nil {
-		log.Fatalln("WeatherAPICall could not parse the response.")
+		return WeatherAPIResult{}, fmt.Errorf("could not parse the response: %w", err)
 	}
 
-	return apiResult.Stations
+	return apiResult, nil
 }
 
-func WeatherLoop(ch chan MqttCronMessage) {
-	topicFromEnv, topicExists := os.LookupEnv("WEATHER_TOPIC")
-	regionFromEnv, regionExists := os.LookupEnv("WEATHER_REGION")
+/* Call the `buienradar.nl` API and return the station data and forecast. */
+func WeatherAPICall(ctx context.Context, apiUrl string) (WeatherAPIResult, error) {
+	body, err := httpGet(ctx, apiUrl)
 
-	if !topicExists {
-		log.Println("WeatherLoop needs `WEATHER_TOPIC` set in the environment, disabled.")
-		return
+	if err != nil {
+		return WeatherAPIResult{}, err
 	}
 
-	if !regionExists {
-		log.Println("WeatherLoop needs `WEATHER_REGION` set in the environment, disabled.")
-		return
+	return ParseWeather(body)
+}
+
+/* The snow forecast metrics of a day of the national forecast, nothing when
+ * the forecast has no snowfall. */
+func BuienradarSnowMetrics(forecast WeatherAPIForecastData) []Metric {
+	snowfall, err := strconv.ParseFloat(WeatherAPINormalizeValue(forecast.Snowfall), 64)
+
+	if err != nil {
+		return nil
+	}
+
+	chance, err := strconv.ParseFloat(WeatherAPINormalizeValue(forecast.RainChance), 64)
+
+	if err != nil {
+		return []Metric{{Name: "snowfall", Value: strconv.FormatFloat(snowfall, 'f', -1, 64)}}
+	}
+
+	return SnowForecastMetrics(snowfall, chance)
+}
+
+/* Provides the readings of the `buienradar.nl` stations selected by `Code`
+ * or `Regions`, with more than one region every region publishes below a
+ * subtopic of `Topic`. Next to the stations it reports the number of matched
+ * stations per topic and the snow forecast of tomorrow. A feed
+ * without any station is warned about once until stations return, instead
+ * of warning that none of them matched. */
+type BuienradarProvider struct {
+	FeedUrl string
+	Topic   string
+	Code    string
+	Regions []string
+	Arrow   bool
+
+	diagnosed bool
+	empty     bool
+}
+
+func (p *BuienradarProvider) Readings(ctx context.Context) ([]WeatherReading, error) {
+	var readings []WeatherReading
+
+	apiResult, err := WeatherAPICall(ctx, p.FeedUrl)
+
+	if err != nil {
+		return nil, err
 	}
 
-	for {
-		for _, location := range WeatherAPICall("https://data.buienradar.nl/1.0/feed/xml") {
-			var msgs []string
-			var tpcs []string
+	if len(apiResult.Stations) == 0 && !p.empty {
+		weatherLog.Warnln("WeatherLoop received no stations at all from `buienradar.nl`, the feed may be under maintenance or have changed.")
+	}
 
-			regionName := strings.Replace(strings.ToLower(location.Station.Region), " ", "-", -1)
+	p.empty = len(apiResult.Stations) == 0
 
-			if regionName != regionFromEnv {
-				continue
-			}
+	matched := make(map[string]int)
 
-			if len(WeatherAPINormalizeValue(location.Humidity)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "humidity"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.Humidity))
-			}
+	for _, location := range apiResult.Stations {
+		if !WeatherStationSelected(location, p.Code, p.Regions) {
+			continue
+		}
 
-			if len(WeatherAPINormalizeValue(location.TemperatureGround)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "temperature.ground"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.TemperatureGround))
-			}
+		stationTopic := WeatherStationTopic(p.Topic, location, p.Code, p.Regions)
 
-			if len(WeatherAPINormalizeValue(location.Temperature10cm)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "temperature.10cm"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.Temperature10cm))
-			}
+		matched[stationTopic]++
 
-			if len(WeatherAPINormalizeValue(location.WindSpeed)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "wind"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.WindSpeed))
-			}
+		reading := WeatherReading{Topic: stationTopic, Station: location.Code, Metrics: WeatherStationMetrics(location, p.Arrow)}
 
-			if len(WeatherAPINormalizeValue(location.GustSpeed)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "gust"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.GustSpeed))
-			}
+		if timestamp, err := ParseWeatherTimestamp(location.Timestamp); err != nil {
+			weatherLog.Warnf("WeatherLoop %s.\n", err)
+		} else {
+			reading.Time = timestamp
+			reading.Metrics = append(reading.Metrics, Metric{Name: "timestamp", Value: timestamp.Format(time.RFC3339)})
+		}
 
-			if len(WeatherAPINormalizeValue(location.AirPressure)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "pressure"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.AirPressure))
-			}
+		readings = append(readings, reading)
+	}
 
-			if len(WeatherAPINormalizeValue(location.Rain)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "rain"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.Rain))
-			}
+	stationTopics := []string{p.Topic}
 
-			if len(WeatherAPINormalizeValue(location.SightRange)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "sight"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.SightRange))
-			}
+	if p.Code == "" && len(p.Regions) > 1 {
+		stationTopics = nil
 
-			if len(WeatherAPINormalizeValue(location.SunIntensity)) > 0 {
-				tpcs = append(tpcs, fmt.Sprintf("%s/%s", topicFromEnv, "sun"))
-				msgs = append(msgs, fmt.Sprintf("%s", location.SunIntensity))
-			}
+		for _, region := range p.Regions {
+			stationTopics = append(stationTopics, buildTopic(p.Topic, region))
+		}
+	}
 
-			for idx, msg := range msgs {
-				ch <- MqttCronMessage{Retain: false, Topic: tpcs[idx], Payload: msg}
-			}
+	for _, stationTopic := range stationTopics {
+		if matched[stationTopic] == 0 && !p.diagnosed && !p.empty {
+			weatherLog.Warnf("WeatherLoop matched no station for `%s`, available are %s.\n", stationTopic, WeatherStationChoices(apiResult.Stations))
+			p.diagnosed = true
 		}
 
-		time.Sleep(5 * time.Minute)
+		readings = append(readings, WeatherReading{Topic: stationTopic, Metrics: []Metric{{Name: "station_count", Value: strconv.Itoa(matched[stationTopic])}}})
 	}
+
+	if snow := BuienradarSnowMetrics(apiResult.Tomorrow); len(snow) > 0 {
+		readings = append(readings, WeatherReading{Topic: p.Topic, Metrics: snow})
+	}
+
+	return readings, nil
 }
@@ -0,0 +1,72 @@
+package magpie
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+var calendarLog = NewLogger("calendar")
+
+/* The ISO 8601 week number of `t`, weeks start on Monday and the first week
+ * of a year holds its first Thursday. */
+func CalendarWeek(t time.Time) int {
+	_, week := t.ISOWeek()
+
+	return week
+}
+
+/* The day of the year of `t`, starting at `1` on the first of January. */
+func CalendarYearDay(t time.Time) int {
+	return t.YearDay()
+}
+
+/* Determine if `t` falls on a Saturday or a Sunday. */
+func CalendarWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+/* Determine if the year of `t` is a leap year in the Gregorian calendar. */
+func CalendarLeapYear(t time.Time) bool {
+	year := t.Year()
+
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+/* Map a boolean to the `yes` or `no` magpie publishes. */
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+
+	return "no"
+}
+
+/* A loop that waits between submitting facts about the current date to
+ * subtopics of the topic defined in the environment as `CALENDAR_TOPIC`,
+ * the week number, the day of the year, and whether it is the weekend or a
+ * leap year. */
+func CalendarLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	calendarLog.Println("CalendarLoop enabled.")
+
+	for {
+		now := cfg.Now().In(cfg.Location)
+
+		msgs := []MqttCronMessage{
+			{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "week"), Payload: strconv.Itoa(CalendarWeek(now))},
+			{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "yearday"), Payload: strconv.Itoa(CalendarYearDay(now))},
+			{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "weekend"), Payload: yesNo(CalendarWeekend(now))},
+			{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "leapyear"), Payload: yesNo(CalendarLeapYear(now))},
+		}
+
+		for _, m := range msgs {
+			if !sendMessage(ctx, ch, m) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package magpie
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarAroundYearBoundaries(t *testing.T) {
+	for _, c := range []struct {
+		date    time.Time
+		week    int
+		yearDay int
+		weekend bool
+	}{
+		{date: time.Date(2020, 12, 31, 12, 0, 0, 0, time.UTC), week: 53, yearDay: 366, weekend: false},
+		{date: time.Date(2021, 1, 3, 12, 0, 0, 0, time.UTC), week: 53, yearDay: 3, weekend: true},
+		{date: time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC), week: 1, yearDay: 4, weekend: false},
+		{date: time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), week: 9, yearDay: 60, weekend: false},
+		{date: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), week: 9, yearDay: 61, weekend: false},
+		{date: time.Date(2024, 12, 30, 12, 0, 0, 0, time.UTC), week: 1, yearDay: 365, weekend: false},
+		{date: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), week: 1, yearDay: 1, weekend: false},
+		{date: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), week: 9, yearDay: 60, weekend: true},
+		{date: time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC), week: 53, yearDay: 365, weekend: false},
+		{date: time.Date(2027, 1, 2, 12, 0, 0, 0, time.UTC), week: 53, yearDay: 2, weekend: true},
+	} {
+		if week := CalendarWeek(c.date); week != c.week {
+			t.Errorf("CalendarWeek(%s) = %d, expected %d", c.date.Format(time.DateOnly), week, c.week)
+		}
+
+		if yearDay := CalendarYearDay(c.date); yearDay != c.yearDay {
+			t.Errorf("CalendarYearDay(%s) = %d, expected %d", c.date.Format(time.DateOnly), yearDay, c.yearDay)
+		}
+
+		if weekend := CalendarWeekend(c.date); weekend != c.weekend {
+			t.Errorf("CalendarWeekend(%s) = %t, expected %t", c.date.Format(time.DateOnly), weekend, c.weekend)
+		}
+	}
+}
+
+func TestCalendarLeapYear(t *testing.T) {
+	for year, leap := range map[int]bool{1900: false, 2000: true, 2024: true, 2025: false, 2026: false, 2028: true, 2100: false} {
+		if got := CalendarLeapYear(time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC)); got != leap {
+			t.Errorf("CalendarLeapYear(%d) = %t, expected %t", year, got, leap)
+		}
+	}
+}
+
+func TestCalendarUsesTheLocalDate(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newYear := time.Date(2025, 12, 31, 23, 30, 0, 0, time.UTC).In(amsterdam)
+
+	if CalendarYearDay(newYear) != 1 || CalendarWeek(newYear) != 1 {
+		t.Fatalf("expected the first day of 2026 in Amsterdam, got day %d of week %d", CalendarYearDay(newYear), CalendarWeek(newYear))
+	}
+}
@@ -0,0 +1,25 @@
+package magpie
+
+import "time"
+
+/* Tells the time to the loops, replaceable so their decisions can be made
+ * at a fixed time. */
+type Clock interface {
+	Now() time.Time
+}
+
+/* The clock of the system. */
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+/* A clock that always tells `Time`. */
+type FrozenClock struct {
+	Time time.Time
+}
+
+func (c FrozenClock) Now() time.Time {
+	return c.Time
+}
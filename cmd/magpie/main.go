@@ -3,22 +3,26 @@
  * interval. Longer intervals are used for non-often-changing-data (such as
  * seasons).
  *
- * This program will exit on any error, so be sure to run it in an init system
- * or other process manager.
+ * Failed calls to upstream APIs are retried with a growing backoff and a lost
+ * connection to the MQTT broker is reconnected, so one source or broker
+ * being down does not stop the others. The program does exit when its
+ * configuration has mistakes on startup, so be sure to run it in an init
+ * system or other process manager.
  *
  * This program can also be ran through the use of containers, use either
  * `docker` or `podman`: `podman run -e MQTT_HOST="tcp://127.0.0.1:1883" ghcr.io/petspalace/magpie`
  *
- * Available sources:
- * - Current daylight, requires `DAYLIGHT_TOPIC`, `DAYLIGHT_LATITUDE`, and
- *   `DAYLIGHT_LONGITUDE` to be passed in the environment.
- * - Current season, requires `SEASON_TOPIC` to be  passed in the environment.
- * - Current day phase, requires `DAYPHASE_TOPIC` to be  passed in the
- *   environment.
+ * Available sources are air quality, calendar, daylight, day phase, forecast,
+ * fuel prices, exchange rates, heartbeat, public holidays, a value of any
+ * JSON API, pollen, electricity prices, earthquakes, season, snow, tides, UV
+ * index, weather, and weather warnings. Run `magpie env` to list the
+ * settings of each of them.
  *
- * Sources are enabled when their respsective `_TOPIC` environment variables
- * are present. If a source is enabled and requires more configuration the
- * the program will exit if not provided.
+ * Sources are enabled when their respective `_TOPIC` environment variables
+ * are present, unless `<SOURCE>_ENABLED` is `false`. A source that lacks
+ * further settings it needs is disabled with a log line, settings that can
+ * not be used make the program exit on startup and are refused on a reload
+ * with `SIGHUP`.
  *
  * Bug reports, feature requests can be filed at this projects homepage which
  * you can find at https://github.com/petspalace/magpie
@@ -52,9 +56,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/eclipse/paho.mqtt.golang"
@@ -62,67 +72,384 @@ import (
 	"github.com/petspalace/magpie"
 )
 
-var logger = log.New(os.Stderr, "", log.LstdFlags)
+var logger = magpie.NewLogger("magpie")
 
-/* Listens on a channel to submit messages to MQTT. */
-func MessageLoop(c mqtt.Client, ch chan magpie.MqttCronMessage, prefix string) {
-	for m := range ch {
-		topic := fmt.Sprintf("%s/%s", prefix, m.Topic)
+/* Connect to the MQTT broker at `host`, retrying a few times with a growing
+ * wait before giving up or the context is done. The client announces magpie
+ * as `online` once connected, resetting `retained` when given, and
+ * reconnects on its own afterwards. */
+func Connect(ctx context.Context, config magpie.Config, host string, backoff *magpie.Backoff, retained *magpie.RetainedFilter) (mqtt.Client, error) {
+	c := mqtt.NewClient(magpie.MqttClientOptions(config, host, retained))
 
-		if token := c.Publish(topic, 0, m.Retain, m.Payload); token.Wait() && token.Error() != nil {
-			logger.Fatalln("MessageLoop could not publish message.")
+	for i := 0; i < 10; i++ {
+		if token := c.Connect(); token.Wait() && token.Error() != nil {
+			wait := backoff.Next()
+
+			logger.Warnf("Error connecting to MQTT server `%s`, retrying in %s.\n", host, wait)
+
+			select {
+			case <-ctx.Done():
+				return c, fmt.Errorf("stopped connecting to MQTT server `%s`: %w", host, ctx.Err())
+			case <-time.After(wait):
+			}
+		} else {
+			backoff.Reset()
+			return c, nil
+		}
+	}
+
+	return c, fmt.Errorf("exceeded max retries connecting to MQTT server `%s`", host)
+}
+
+/* Keep connecting a client that did not connect on startup, waiting a
+ * growing time between attempts, until it does or the context is done. */
+func keepConnecting(ctx context.Context, c mqtt.Client, backoff *magpie.Backoff) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff.Next()):
+		}
+
+		if token := c.Connect(); token.Wait() && token.Error() == nil {
+			return
+		}
+	}
+}
+
+/* Connect to every broker in the configuration at once. Brokers that can
+ * not be reached on startup keep being connected in the background so they
+ * do not hold up the others, magpie only gives up when none can be
+ * reached. Connecting stops once the context is done. */
+func ConnectBrokers(ctx context.Context, config magpie.Config, retained *magpie.RetainedFilter) []mqtt.Client {
+	clients := make([]mqtt.Client, len(config.Hosts))
+	errs := make([]error, len(config.Hosts))
+
+	var wg sync.WaitGroup
+
+	for i, host := range config.Hosts {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			clients[i], errs[i] = Connect(ctx, config, host, magpie.NewBackoff(5*time.Second, config.BackoffMax), retained)
+		}()
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return clients
+	}
+
+	var failed int
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		failed++
+
+		if failed == len(clients) {
+			logger.Fatalf("magpie %s.\n", err)
+		}
+
+		logger.Warnf("magpie %s, retrying in the background.\n", err)
+
+		go keepConnecting(ctx, clients[i], magpie.NewBackoff(5*time.Second, config.BackoffMax))
+	}
+
+	return clients
+}
+
+/* Handle the flags and subcommands that write to `w` instead of starting
+ * magpie, returns whether magpie should exit. */
+func handleArgs(args []string, w io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("magpie", flag.ContinueOnError)
+	version := fs.Bool("version", false, "print the version, commit, and build date and exit")
+	listWeatherStations := fs.Bool("list-weather-stations", false, "print the code, name, and region of every buienradar.nl station and exit")
+
+	if err := fs.Parse(args); err != nil {
+		return true, err
+	}
+
+	if *version {
+		_, err := fmt.Fprintf(w, "magpie %s\n", magpie.VersionString())
+		return true, err
+	}
+
+	if *listWeatherStations {
+		feedUrl, feedExists := os.LookupEnv("WEATHER_FEED_URL")
+
+		if !feedExists {
+			feedUrl = magpie.EnvDefault("WEATHER_FEED_URL")
+		}
+
+		apiResult, err := magpie.WeatherAPICall(context.Background(), feedUrl)
+
+		if err != nil {
+			return true, fmt.Errorf("could not fetch the weather stations: %w", err)
 		}
 
-		logger.Printf("MessageLoop published topic='%s',payload='%s'\n", topic, m.Payload)
+		return true, magpie.WriteWeatherStations(w, apiResult.Stations)
 	}
+
+	if fs.Arg(0) == "env" {
+		return true, magpie.WriteEnv(w)
+	}
+
+	return false, nil
 }
 
+/* The Home Assistant discovery messages of the configuration, none when
+ * `HASS_DISCOVERY` is not set. */
+func discoveryMessages(config magpie.Config) ([]magpie.MqttCronMessage, error) {
+	if !config.Discovery {
+		return nil, nil
+	}
+
+	configs, err := magpie.Discovery(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return magpie.DiscoveryMessages(configs, config.DiscoveryPrefix)
+}
+
+/* Switch to the reloaded configuration `config`. The global settings, the
+ * quiet hours, and the sources follow it and the discovery is announced
+ * again. A configuration whose topics are refused or whose discovery can
+ * not be built changes nothing. */
+func reloadConfig(ctx context.Context, ch chan magpie.MqttCronMessage, supervisor *magpie.Supervisor, quiet *magpie.CurrentQuietHours, config magpie.Config, started time.Time) error {
+	collisions, err := magpie.CheckTopics(config)
+
+	for _, collision := range collisions {
+		logger.Warnf("magpie found overlapping topics, %s.\n", collision)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	msgs, err := discoveryMessages(config)
+
+	if err != nil {
+		return err
+	}
+
+	if err := config.ApplyGlobals(); err != nil {
+		return err
+	}
+
+	quiet.Set(config.QuietHours)
+
+	stopped, starting := supervisor.Apply(ctx, magpie.NewSources(config, started))
+
+	logger.Printf("magpie reloaded the configuration, stopped %d and started %d sources.\n", len(stopped), len(starting))
+
+	if config.Discovery {
+		go magpie.SendMessages(ctx, ch, msgs...)
+	}
+
+	return nil
+}
+
+/* Reload the configuration on every `SIGHUP` until the context is done,
+ * sources that were disabled or changed are stopped and new ones started
+ * while the connection to the broker stays up. A configuration that does not
+ * load or is refused keeps the current one. */
+func reloadOnHangup(ctx context.Context, ch chan magpie.MqttCronMessage, supervisor *magpie.Supervisor, quiet *magpie.CurrentQuietHours, started time.Time) {
+	hangup := make(chan os.Signal, 1)
+
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			config, err := magpie.LoadConfig()
+
+			if err == nil {
+				err = reloadConfig(ctx, ch, supervisor, quiet, config, started)
+			}
+
+			if err != nil {
+				logger.Warnf("magpie could not reload the configuration, keeping the current one: %s.\n", err)
+			}
+		}
+	}
+}
 
 func main() {
+	started := time.Now()
+
+	if exit, err := handleArgs(os.Args[1:], os.Stdout); err != nil {
+		logger.Fatalf("magpie %s.\n", err)
+	} else if exit {
+		return
+	}
+
+	config, err := magpie.LoadConfig()
+
+	if err != nil {
+		logger.Fatalf("magpie %s.\n", err)
+	}
+
+	if err := config.ApplyGlobals(); err != nil {
+		logger.Fatalf("magpie %s.\n", err)
+	}
+
+	logger.Printf("magpie %s starting.\n", magpie.VersionString())
+
 	ch := make(chan magpie.MqttCronMessage)
 
-	hostFromEnv, hostExists := os.LookupEnv("MQTT_HOST")
+	logger.Printf("`MQTT_PREFIX` set to `%s`.\n", config.Prefix)
+
+	summary := magpie.SummarizeConfig(config)
 
-	if !hostExists {
-		logger.Fatalln("magpie needs `MQTT_HOST` set in the environment to a value such as `tcp://127.0.0.1:1883`.")
+	for _, line := range summary.Lines() {
+		logger.Println(line)
 	}
 
-	prefixFromEnv, prefixExists := os.LookupEnv("MQTT_PREFIX")
+	collisions, err := magpie.CheckTopics(config)
 
-	if !prefixExists {
-		logger.Println("`MQTT_PREFIX` undefined using default `home.arpa`-prefix.")
-		prefixFromEnv = "/home.arpa"
-	} else {
-		logger.Printf("`MQTT_PREFIX` set to `%s`.\n", prefixFromEnv)
+	for _, collision := range collisions {
+		logger.Warnf("magpie found overlapping topics, %s.\n", collision)
 	}
 
-	opts := mqtt.NewClientOptions().AddBroker(hostFromEnv).SetClientID("magpie")
-	opts.SetKeepAlive(2 * time.Second)
-	opts.SetPingTimeout(1 * time.Second)
+	if err != nil {
+		logger.Fatalf("magpie %s.\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if config.MaxRuntime > 0 {
+		logger.Printf("`MAX_RUNTIME` set to `%s`.\n", config.MaxRuntime)
 
-	c := mqtt.NewClient(opts)
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, config.MaxRuntime)
+		defer cancel()
+	}
+
+	magpie.HttpClient.Timeout = config.HttpTimeout
+
+	var retained *magpie.RetainedFilter
+
+	if !config.ForceRepublish {
+		retained = magpie.NewRetainedFilter()
+	}
 
-	for i := 0; i <= 10; i++ {
-		if i == 10 {
-			logger.Fatalln("Exceeded max retries")
+	var clients []mqtt.Client
+	var sinks []magpie.Sink
+
+	if config.DryRun {
+		logger.Println("`MAGPIE_DRY_RUN` set, logging messages instead of publishing them.")
+
+		sinks = append(sinks, magpie.NewLogSink())
+	} else if len(config.Hosts) > 0 {
+		clients = ConnectBrokers(ctx, config, retained)
+
+		for i, c := range clients {
+			sinks = append(sinks, magpie.NewMqttSink(c, config.Hosts[i], config.Qos))
 		}
+	}
 
-		if token := c.Connect(); token.Wait() && token.Error() != nil {
-			logger.Println("Error connecting to MQTT server, retrying")
-			time.Sleep(5 * time.Second)
-		} else {
-			break
+	if config.SocketPath != "" && !config.DryRun {
+		logger.Printf("`SOCKET_PATH` set to `%s`.\n", config.SocketPath)
+
+		socket := magpie.NewSocketSink(config.SocketPath)
+		defer socket.Close()
+
+		sinks = append(sinks, socket)
+	}
+
+	if config.Stdout && !config.DryRun {
+		logger.Println("`STDOUT_SINK` set, writing messages to stdout.")
+
+		sinks = append(sinks, magpie.NewWriterSink(os.Stdout))
+	}
+
+	if config.MetricsAddr != "" {
+		healthy := func() bool {
+			for _, c := range clients {
+				if c.IsConnectionOpen() {
+					return true
+				}
+			}
+
+			return len(clients) == 0
 		}
+
+		go magpie.ServeStatus(ctx, config.MetricsAddr, healthy)
+	}
+
+	if config.PublishConfig {
+		payload, err := json.Marshal(summary)
+
+		if err != nil {
+			logger.Fatalln("magpie could not serialize the configuration summary.")
+		}
+
+		go magpie.SendMessages(ctx, ch, magpie.MqttCronMessage{Retain: true, Critical: true, Topic: "magpie/config", Payload: string(payload)})
+	}
+
+	msgs, err := discoveryMessages(config)
+
+	if err != nil {
+		logger.Fatalf("magpie %s.\n", err)
+	}
+
+	if config.Discovery {
+		logger.Printf("`HASS_DISCOVERY` set, announcing %d sensors on `%s`.\n", len(msgs), config.DiscoveryPrefix)
+
+		go magpie.SendMessages(ctx, ch, msgs...)
 	}
 
-	go magpie.DayLightLoop(ch)
-	go magpie.DayPhaseLoop(ch)
-	go magpie.SeasonLoop(ch)
-	go magpie.WeatherLoop(ch)
+	supervisor := magpie.NewSupervisor(ch)
+	supervisor.Apply(ctx, magpie.NewSources(config, started))
+
+	quiet := magpie.NewCurrentQuietHours(config.QuietHours)
+
+	go reloadOnHangup(ctx, ch, supervisor, quiet, started)
 
-	MessageLoop(c, ch, prefixFromEnv)
+	go magpie.ErrorsLoop(ctx, ch, supervisor.Running, config.ErrorsInterval)
+
+	if config.StaleMultiplier > 0 {
+		go magpie.StaleLoop(ctx, ch, supervisor.Running, config.StaleMultiplier)
+	}
+
+	messages := ch
+
+	if config.QueueSize > 0 {
+		messages = make(chan magpie.MqttCronMessage, config.QueueSize)
+
+		go magpie.QueueLoop(ctx, ch, messages, config.QueuePolicy)
+	}
 
-	c.Disconnect(250)
+	magpie.MessageLoop(ctx, messages, sinks, config.Prefix, quiet.Get, retained)
+
+	logger.Println("magpie shutting down.")
+
+	supervisor.Wait()
+
+	for i, c := range clients {
+		if !c.IsConnectionOpen() {
+			continue
+		}
+
+		if token := c.Publish(config.AvailabilityTopic, 0, true, "offline"); token.Wait() && token.Error() != nil {
+			logger.Warnf("Error announcing unavailability to MQTT server `%s`.\n", config.Hosts[i])
+		}
+
+		c.Disconnect(250)
+	}
 
 	time.Sleep(1 * time.Second)
 }
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/petspalace/magpie"
+)
+
+/* Run `main` in a process of its own with `env` as its whole environment
+ * when the test binary is started again by the test of `name`. Reports
+ * whether this is that process. */
+func runMainIn(name string, env []string) (*exec.Cmd, bool) {
+	if os.Getenv("MAGPIE_TEST_MAIN") == name {
+		os.Args = []string{"magpie"}
+		main()
+		return nil, true
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+	cmd.Env = append(env, "MAGPIE_TEST_MAIN="+name)
+
+	return cmd, false
+}
+
+func TestMaxRuntimeStopsAndDrains(t *testing.T) {
+	cmd, inside := runMainIn("TestMaxRuntimeStopsAndDrains", []string{
+		"MAX_RUNTIME=300ms",
+		"MAGPIE_START_JITTER=0s",
+		"STDOUT_SINK=1",
+		"SEASON_TOPIC=season",
+	})
+
+	if inside {
+		return
+	}
+
+	start := time.Now()
+	output, err := cmd.Output()
+
+	if err != nil {
+		t.Fatalf("expected magpie to exit cleanly, got %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 10*time.Second {
+		t.Fatalf("expected magpie to stop shortly after `MAX_RUNTIME`, took %s", elapsed)
+	}
+
+	topics := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+
+	for scanner.Scan() {
+		var line magpie.MessageLine
+
+		if json.Unmarshal(scanner.Bytes(), &line) == nil {
+			topics[line.Topic] = line.Payload
+		}
+	}
+
+	if _, published := topics["home.arpa/season"]; !published {
+		t.Fatalf("expected the season to be published before stopping, got %q", output)
+	}
+}
+
+/* Read a configuration from `settings` alone. */
+func configFrom(t *testing.T, settings map[string]string) magpie.Config {
+	t.Helper()
+
+	config, err := magpie.ConfigFromLookup(func(name string) (string, bool) {
+		value, exists := settings[name]
+		return value, exists
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return config
+}
+
+func TestReloadConfigAppliesTheGlobalSettings(t *testing.T) {
+	defer magpie.SetTemperatureUnit("c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan magpie.MqttCronMessage)
+
+	go func() {
+		for range ch {
+		}
+	}()
+
+	supervisor := magpie.NewSupervisor(ch)
+	quiet := magpie.NewCurrentQuietHours(nil)
+
+	defer func() {
+		cancel()
+		supervisor.Wait()
+		close(ch)
+	}()
+
+	overlapping := configFrom(t, map[string]string{
+		"STDOUT_SINK":             "1",
+		"STRICT_TOPICS":           "1",
+		"SEASON_TOPIC":            "home",
+		"DAYPHASE_TOPIC":          "home/dayphase",
+		"MAGPIE_TEMPERATURE_UNIT": "f",
+		"QUIET_HOURS":             "23:00-06:00",
+	})
+
+	if err := reloadConfig(ctx, ch, supervisor, quiet, overlapping, time.Now()); !errors.Is(err, magpie.ErrTopicsOverlap) {
+		t.Fatalf("expected the overlapping topics to be refused, got %v", err)
+	}
+
+	if symbol := magpie.TemperatureSymbol(); symbol != "°C" || quiet.Get() != nil || len(supervisor.Running()) != 0 {
+		t.Fatalf("expected a refused reload to change nothing, got %s, %v, and %d sources", symbol, quiet.Get(), len(supervisor.Running()))
+	}
+
+	accepted := configFrom(t, map[string]string{
+		"STDOUT_SINK":             "1",
+		"STRICT_TOPICS":           "1",
+		"SEASON_TOPIC":            "home",
+		"MAGPIE_TEMPERATURE_UNIT": "f",
+		"QUIET_HOURS":             "23:00-06:00",
+	})
+
+	if err := reloadConfig(ctx, ch, supervisor, quiet, accepted, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if symbol := magpie.TemperatureSymbol(); symbol != "°F" {
+		t.Errorf("expected the temperature unit to follow the reload, got %s", symbol)
+	}
+
+	if quiet.Get() == nil || *quiet.Get() != *accepted.QuietHours {
+		t.Errorf("expected the quiet hours to follow the reload, got %v", quiet.Get())
+	}
+
+	if running := supervisor.Running(); len(running) != 1 || running[0].Config.Name != "season" {
+		t.Errorf("expected only the season source to run, got %+v", running)
+	}
+}
+
+func TestHandleArgsVersion(t *testing.T) {
+	defer func(version string, commit string, date string) {
+		magpie.Version, magpie.Commit, magpie.BuildDate = version, commit, date
+	}(magpie.Version, magpie.Commit, magpie.BuildDate)
+
+	magpie.Version, magpie.Commit, magpie.BuildDate = "1.4.0", "0a1b2c3", "2026-06-21"
+
+	var out bytes.Buffer
+
+	exit, err := handleArgs([]string{"-version"}, &out)
+
+	if err != nil || !exit {
+		t.Fatalf("expected `-version` to exit without an error, got %t and %v", exit, err)
+	}
+
+	if expected := "magpie 1.4.0 (0a1b2c3, 2026-06-21)\n"; out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestHandleArgsWithoutFlagsRuns(t *testing.T) {
+	var out bytes.Buffer
+
+	if exit, err := handleArgs(nil, &out); exit || err != nil || out.Len() != 0 {
+		t.Fatalf("expected magpie to run without arguments, got %t, %v, and %q", exit, err, out.String())
+	}
+
+	if exit, err := handleArgs([]string{"-unknown"}, &out); !exit || err == nil {
+		t.Fatalf("expected an unknown flag to exit with an error, got %t and %v", exit, err)
+	}
+}
@@ -0,0 +1,444 @@
+package magpie
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* The resolved settings of a single source. Settings specific to a source
+ * are looked up through `Lookup` and `Get`. */
+type SourceConfig struct {
+	Name     string
+	Topic    string
+	Enabled  bool
+	Retain   bool
+	Interval time.Duration
+	Location *time.Location
+
+	/* The wait before the first iteration of the source. */
+	StartDelay time.Duration
+
+	/* The decimals numeric payloads are rounded to, `-1` leaves them as
+	 * they are. */
+	RoundDecimals int
+
+	/* The prefix of the topics of the source, `<SOURCE>_PREFIX` or else
+	 * `MQTT_PREFIX`. */
+	Prefix string
+
+	/* Set for sources that take coordinates, `CoordinatesErr` explains why
+	 * they could not be used and is `ErrCoordinatesMissing` when none are
+	 * set. */
+	Coordinates    Coordinates
+	CoordinatesErr error
+
+	BackoffMax time.Duration
+
+	/* When magpie started, which a reload leaves alone. */
+	Started time.Time
+
+	/* Tells the time, the system clock unless replaced. */
+	Clock Clock
+
+	lookup func(string) (string, bool)
+}
+
+/* The current time according to the clock of the source. */
+func (s SourceConfig) Now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+
+	return s.Clock.Now()
+}
+
+/* Look up a setting of the source. */
+func (s SourceConfig) Lookup(name string) (string, bool) {
+	return s.lookup(name)
+}
+
+/* Look up a setting of the source, falling back to its default. */
+func (s SourceConfig) Get(name string) string {
+	if value, exists := s.lookup(name); exists {
+		return value
+	}
+
+	return EnvDefault(name)
+}
+
+/* The resolved settings of magpie and its sources, read and validated once
+ * on startup. */
+type Config struct {
+	Hosts             []string
+	Username          string
+	Password          string
+	ClientId          string
+	AvailabilityTopic string
+	Qos               byte
+	QueueSize         int
+	QueuePolicy       QueuePolicy
+	ReconnectInterval time.Duration
+	Prefix            string
+	SocketPath        string
+	Stdout            bool
+	DryRun            bool
+	MetricsAddr       string
+	ErrorsInterval    time.Duration
+	StaleMultiplier   float64
+
+	StrictTopics    bool
+	QuietHours      *QuietHours
+	MaxRuntime      time.Duration
+	BackoffMax      time.Duration
+	StartJitter     time.Duration
+	HttpTimeout     time.Duration
+	PublishConfig   bool
+	Discovery       bool
+	DiscoveryPrefix string
+	ForceRepublish  bool
+	TopicStyle      string
+	TemperatureUnit string
+	LogFormat       string
+	LogLevel        LogLevel
+
+	Sources []SourceConfig
+
+	lookup func(string) (string, bool)
+}
+
+/* Load the configuration from the environment, or from the file in
+ * `MAGPIE_CONFIG` with the environment taking precedence. */
+func LoadConfig() (Config, error) {
+	if pathFromEnv, pathExists := os.LookupEnv("MAGPIE_CONFIG"); pathExists {
+		return LoadConfigFile(pathFromEnv)
+	}
+
+	return ConfigFromLookup(os.LookupEnv)
+}
+
+/* Parse a boolean setting through `lookup`, falling back to its default. */
+func boolFromEnv(lookup func(string) (string, bool), name string) (bool, error) {
+	valueFromEnv, valueExists := lookup(name)
+
+	if !valueExists {
+		valueFromEnv = EnvDefault(name)
+	}
+
+	if valueFromEnv == "" {
+		return false, nil
+	}
+
+	value, err := strconv.ParseBool(valueFromEnv)
+
+	if err != nil {
+		return false, fmt.Errorf("could not parse `%s='%s'` as boolean", name, valueFromEnv)
+	}
+
+	return value, nil
+}
+
+/* The names of the sources in the order of the registry. */
+func sourceNames() []string {
+	var names []string
+
+	for _, v := range EnvVars {
+		if v.Source != "" && (len(names) == 0 || names[len(names)-1] != v.Source) {
+			names = append(names, v.Source)
+		}
+	}
+
+	return names
+}
+
+/* Determine if a source is enabled, which it is once `<source>_TOPIC` is
+ * set unless `<source>_ENABLED` is false. */
+func SourceEnabled(lookup func(string) (string, bool), source string) (bool, error) {
+	if _, topicExists := lookup(source + "_TOPIC"); !topicExists {
+		return false, nil
+	}
+
+	return boolFromEnv(lookup, source+"_ENABLED")
+}
+
+/* Resolve the settings of a single source, only enabled sources are
+ * validated. */
+func sourceConfigFromLookup(lookup func(string) (string, bool), name string, prefixGlobal string, backoffMax time.Duration, startJitter time.Duration) (SourceConfig, error) {
+	var err error
+
+	prefix := strings.ToUpper(name)
+	source := SourceConfig{Name: name, BackoffMax: backoffMax, Clock: RealClock{}, lookup: lookup}
+
+	source.Topic, _ = lookup(prefix + "_TOPIC")
+
+	if source.Enabled, err = SourceEnabled(lookup, prefix); err != nil || !source.Enabled {
+		return source, err
+	}
+
+	source.Prefix = ResolvePrefix(lookup, prefix, prefixGlobal)
+
+	retainDefault, err := strconv.ParseBool(EnvDefault(prefix + "_RETAIN"))
+
+	if err != nil {
+		retainDefault = false
+	}
+
+	if source.Retain, err = ResolveRetain(lookup, prefix, retainDefault); err != nil {
+		return source, err
+	}
+
+	if source.Interval, err = intervalFromEnv(lookup, prefix); err != nil {
+		return source, err
+	}
+
+	if source.Location, err = LocationFromEnv(lookup, prefix); err != nil {
+		return source, err
+	}
+
+	if source.StartDelay, err = startDelayFromEnv(lookup, prefix, startJitter); err != nil {
+		return source, err
+	}
+
+	if source.RoundDecimals, err = roundDecimalsFromEnv(lookup, prefix); err != nil {
+		return source, err
+	}
+
+	if EnvKnown(prefix + "_LATITUDE") {
+		var global bool
+
+		source.Coordinates, global, source.CoordinatesErr = ResolveCoordinates(lookup, prefix)
+
+		if source.CoordinatesErr != nil && global && !errors.Is(source.CoordinatesErr, ErrCoordinatesMissing) {
+			return source, fmt.Errorf("could not use the global coordinates: %w", source.CoordinatesErr)
+		}
+	}
+
+	if validate, exists := sourceValidators[name]; exists {
+		if err := validate(source); err != nil {
+			return source, err
+		}
+	}
+
+	return source, nil
+}
+
+/* Read and validate the configuration through `lookup`, which is usually
+ * `os.LookupEnv`. */
+func ConfigFromLookup(lookup func(string) (string, bool)) (Config, error) {
+	var err error
+
+	config := Config{lookup: lookup}
+
+	config.Hosts = BrokerHosts(lookup)
+	config.SocketPath, _ = lookup("SOCKET_PATH")
+
+	if config.Stdout, err = boolFromEnv(lookup, "STDOUT_SINK"); err != nil {
+		return config, err
+	}
+
+	if config.DryRun, err = boolFromEnv(lookup, "MAGPIE_DRY_RUN"); err != nil {
+		return config, err
+	}
+
+	if len(config.Hosts) == 0 && config.SocketPath == "" && !config.Stdout && !config.DryRun {
+		return config, errors.New("needs `MQTT_HOST` set in the environment to a value such as `tcp://127.0.0.1:1883`, `SOCKET_PATH` to a Unix socket, or `STDOUT_SINK=1`")
+	}
+
+	config.MetricsAddr, _ = lookup("MAGPIE_METRICS_ADDR")
+	config.Username, _ = lookup("MQTT_USERNAME")
+	config.Password, _ = lookup("MQTT_PASSWORD")
+	config.ClientId = ClientId(lookup, os.Hostname)
+
+	var prefixExists bool
+
+	if config.Prefix, prefixExists = lookup("MQTT_PREFIX"); !prefixExists {
+		config.Prefix = EnvDefault("MQTT_PREFIX")
+	}
+
+	config.Prefix = NormalizePrefix(config.Prefix)
+
+	config.AvailabilityTopic = AvailabilityTopic(lookup, config.Prefix)
+
+	if qosFromEnv, qosExists := lookup("MQTT_QOS"); qosExists {
+		if config.Qos, err = ParseQos(qosFromEnv); err != nil {
+			return config, err
+		}
+	}
+
+	if config.QueueSize, err = queueSizeFromEnv(lookup); err != nil {
+		return config, err
+	}
+
+	policyFromEnv, policyExists := lookup("MQTT_QUEUE_POLICY")
+
+	if !policyExists {
+		policyFromEnv = EnvDefault("MQTT_QUEUE_POLICY")
+	}
+
+	if config.QueuePolicy, err = ParseQueuePolicy(policyFromEnv); err != nil {
+		return config, err
+	}
+
+	if config.ReconnectInterval, err = DurationFromEnv(lookup, "MQTT_RECONNECT_INTERVAL"); err != nil {
+		return config, err
+	}
+
+	if config.ReconnectInterval <= 0 {
+		return config, errors.New("`MQTT_RECONNECT_INTERVAL` has to be positive")
+	}
+
+	if config.BackoffMax, err = DurationFromEnv(lookup, "BACKOFF_MAX"); err != nil {
+		return config, err
+	}
+
+	if config.BackoffMax <= 0 {
+		return config, errors.New("`BACKOFF_MAX` has to be positive")
+	}
+
+	if config.StartJitter, err = DurationFromEnv(lookup, "MAGPIE_START_JITTER"); err != nil {
+		return config, err
+	}
+
+	if config.ErrorsInterval, err = DurationFromEnv(lookup, "MAGPIE_ERRORS_INTERVAL"); err != nil {
+		return config, err
+	}
+
+	if config.ErrorsInterval <= 0 {
+		return config, errors.New("`MAGPIE_ERRORS_INTERVAL` has to be positive")
+	}
+
+	multiplierFromEnv, multiplierExists := lookup("MAGPIE_STALE_MULTIPLIER")
+
+	if !multiplierExists {
+		multiplierFromEnv = EnvDefault("MAGPIE_STALE_MULTIPLIER")
+	}
+
+	if config.StaleMultiplier, err = strconv.ParseFloat(multiplierFromEnv, 64); err != nil || config.StaleMultiplier < 0 {
+		return config, fmt.Errorf("could not parse `MAGPIE_STALE_MULTIPLIER='%s'`, expected a non-negative number", multiplierFromEnv)
+	}
+
+	if config.HttpTimeout, err = DurationFromEnv(lookup, "MAGPIE_HTTP_TIMEOUT"); err != nil {
+		return config, err
+	}
+
+	if config.HttpTimeout <= 0 {
+		return config, errors.New("`MAGPIE_HTTP_TIMEOUT` has to be positive")
+	}
+
+	if _, runtimeExists := lookup("MAX_RUNTIME"); runtimeExists {
+		if config.MaxRuntime, err = DurationFromEnv(lookup, "MAX_RUNTIME"); err != nil {
+			return config, err
+		}
+	}
+
+	if quietFromEnv, quietExists := lookup("QUIET_HOURS"); quietExists {
+		loc, err := LocationFromEnv(lookup, "QUIET_HOURS")
+
+		if err != nil {
+			return config, err
+		}
+
+		quiet, err := ParseQuietHours(quietFromEnv, loc)
+
+		if err != nil {
+			return config, fmt.Errorf("could not parse `QUIET_HOURS='%s'`: %w", quietFromEnv, err)
+		}
+
+		config.QuietHours = &quiet
+	}
+
+	for name, value := range map[string]*bool{
+		"STRICT_TOPICS":          &config.StrictTopics,
+		"MAGPIE_PUBLISH_CONFIG":  &config.PublishConfig,
+		"HASS_DISCOVERY":         &config.Discovery,
+		"MAGPIE_FORCE_REPUBLISH": &config.ForceRepublish,
+	} {
+		if *value, err = boolFromEnv(lookup, name); err != nil {
+			return config, err
+		}
+	}
+
+	styleFromEnv, _ := lookup("MAGPIE_TOPIC_STYLE")
+
+	if config.TopicStyle, err = ParseTopicStyle(styleFromEnv); err != nil {
+		return config, err
+	}
+
+	unitFromEnv, _ := lookup("MAGPIE_TEMPERATURE_UNIT")
+
+	if config.TemperatureUnit, err = ParseTemperatureUnit(unitFromEnv); err != nil {
+		return config, err
+	}
+
+	formatFromEnv, _ := lookup("MAGPIE_LOG_FORMAT")
+
+	if config.LogFormat, err = ParseLogFormat(formatFromEnv); err != nil {
+		return config, err
+	}
+
+	config.LogLevel = LevelInfo
+
+	if levelFromEnv, levelExists := lookup("MAGPIE_LOG_LEVEL"); levelExists {
+		if config.LogLevel, err = ParseLogLevel(levelFromEnv); err != nil {
+			return config, err
+		}
+	}
+
+	var discoveryPrefixExists bool
+
+	if config.DiscoveryPrefix, discoveryPrefixExists = lookup("HASS_DISCOVERY_PREFIX"); !discoveryPrefixExists {
+		config.DiscoveryPrefix = EnvDefault("HASS_DISCOVERY_PREFIX")
+	}
+
+	for _, name := range sourceNames() {
+		source, err := sourceConfigFromLookup(lookup, name, config.Prefix, config.BackoffMax, config.StartJitter)
+
+		if err != nil {
+			return config, fmt.Errorf("source `%s`: %w", name, err)
+		}
+
+		config.Sources = append(config.Sources, source)
+	}
+
+	return config, nil
+}
+
+/* Look up a setting the configuration was read from. */
+func (c Config) Lookup(name string) (string, bool) {
+	return c.lookup(name)
+}
+
+/* Apply the settings that hold for all of magpie, the topic style,
+ * temperature unit, log format, and log level. Done on startup and on every
+ * reload, the configuration has already validated them. */
+func (c Config) ApplyGlobals() error {
+	if err := SetTopicStyle(c.TopicStyle); err != nil {
+		return err
+	}
+
+	if err := SetTemperatureUnit(c.TemperatureUnit); err != nil {
+		return err
+	}
+
+	if err := SetLogFormat(c.LogFormat); err != nil {
+		return err
+	}
+
+	SetLogLevel(c.LogLevel)
+
+	return nil
+}
+
+/* The settings of the source called `name`. */
+func (c Config) Source(name string) SourceConfig {
+	for _, source := range c.Sources {
+		if source.Name == name {
+			return source
+		}
+	}
+
+	return SourceConfig{Name: name, lookup: func(string) (string, bool) { return "", false }}
+}
@@ -0,0 +1,177 @@
+package magpie
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* Look up settings in `settings` as if they were the environment. */
+func mapLookup(settings map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, exists := settings[name]
+		return value, exists
+	}
+}
+
+func TestConfigFromLookupChecksSourceSettings(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		err      string
+	}{
+		{settings: map[string]string{"DAYLIGHT_TOPIC": "daylight", "MAGPIE_LATITUDE": "52", "MAGPIE_LONGITUDE": "5", "DAYLIGHT_FORMAT": "xml"}, err: "DAYLIGHT_FORMAT='xml'"},
+		{settings: map[string]string{"DAYPHASE_TOPIC": "dayphase", "DAYPHASE_GRANULARITY": "5"}, err: "DAYPHASE_GRANULARITY='5'"},
+		{settings: map[string]string{"HEARTBEAT_TOPIC": "heartbeat", "HEARTBEAT_UPTIME": "maybe"}, err: "HEARTBEAT_UPTIME='maybe'"},
+		{settings: map[string]string{"HTTPJSON_TOPIC": "json", "HTTPJSON_URL": "http://localhost", "HTTPJSON_PATH": "a..b"}, err: "source `httpjson`"},
+		{settings: map[string]string{"QUAKE_TOPIC": "quake", "QUAKE_RADIUS_KM": "-1"}, err: "QUAKE_RADIUS_KM='-1'"},
+		{settings: map[string]string{"SEASON_TOPIC": "season", "SEASON_HEMISPHERE": "east"}, err: "SEASON_HEMISPHERE='east'"},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_PROVIDER": "knmi"}, err: "WEATHER_PROVIDER='knmi'"},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_WIND_UNIT": "knots"}, err: "WEATHER_WIND_UNIT='knots'"},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_WIND_ARROW": "yes"}, err: "WEATHER_WIND_ARROW='yes'"},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_WIND_BEAUFORT": "on"}, err: "WEATHER_WIND_BEAUFORT='on'"},
+	} {
+		c.settings["STDOUT_SINK"] = "1"
+
+		_, err := ConfigFromLookup(mapLookup(c.settings))
+
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected an error about %s, got %v", c.err, err)
+		}
+	}
+}
+
+func TestConfigFromLookupSkipsChecksOfDisabledSources(t *testing.T) {
+	if _, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1", "SEASON_HEMISPHERE": "east"})); err != nil {
+		t.Fatalf("expected the settings of a disabled source to be left alone, got %s", err)
+	}
+
+	if _, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1", "SEASON_TOPIC": "season", "SEASON_HEMISPHERE": "south"})); err != nil {
+		t.Fatalf("expected valid settings to be accepted, got %s", err)
+	}
+}
+
+func TestHttpJsonLoopWithoutUrlIsDisabled(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1", "HTTPJSON_TOPIC": "json"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan MqttCronMessage)
+
+	HttpJsonLoop(context.Background(), ch, config.Source("httpjson"))
+}
+
+func TestConfigFromLookupParsesSettings(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"MQTT_HOST":         "tcp://127.0.0.1:1883",
+		"MQTT_PREFIX":       "/home/",
+		"MQTT_CLIENT_ID":    "kitchen",
+		"MQTT_QOS":          "1",
+		"MQTT_USERNAME":     "magpie",
+		"MQTT_PASSWORD":     "secret",
+		"MAGPIE_LATITUDE":   "52.37",
+		"MAGPIE_LONGITUDE":  "4.89",
+		"DAYLIGHT_TOPIC":    "daylight",
+		"DAYLIGHT_INTERVAL": "30m",
+		"SEASON_TOPIC":      "season",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(config.Hosts, []string{"tcp://127.0.0.1:1883"}) || config.Prefix != "home" || config.ClientId != "kitchen" || config.Qos != 1 {
+		t.Errorf("expected the broker settings of the environment, got %v, `%s`, `%s`, and %d", config.Hosts, config.Prefix, config.ClientId, config.Qos)
+	}
+
+	if config.Username != "magpie" || config.Password != "secret" || config.AvailabilityTopic != "home/magpie/status" {
+		t.Errorf("expected the credentials and availability topic, got `%s`, `%s`, and `%s`", config.Username, config.Password, config.AvailabilityTopic)
+	}
+
+	daylight := config.Source("daylight")
+
+	if !daylight.Enabled || daylight.Topic != "daylight" || daylight.Interval != 30*time.Minute || daylight.Prefix != "home" {
+		t.Errorf("expected daylight on `daylight` every 30m, got %+v", daylight)
+	}
+
+	if daylight.CoordinatesErr != nil || daylight.Coordinates != (Coordinates{Latitude: 52.37, Longitude: 4.89}) {
+		t.Errorf("expected the global coordinates, got %+v and %v", daylight.Coordinates, daylight.CoordinatesErr)
+	}
+
+	if season := config.Source("season"); !season.Enabled || season.Interval != time.Hour {
+		t.Errorf("expected season every hour by default, got %+v", season)
+	}
+
+	if weather := config.Source("weather"); weather.Enabled {
+		t.Errorf("expected weather without a topic to be disabled, got %+v", weather)
+	}
+}
+
+func TestConfigFromLookupChecksGlobalSettings(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		err      string
+	}{
+		{settings: map[string]string{}, err: "MQTT_HOST"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MQTT_QOS": "3"}, err: "quality of service"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MQTT_RECONNECT_INTERVAL": "soon"}, err: "MQTT_RECONNECT_INTERVAL"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MQTT_RECONNECT_INTERVAL": "0s"}, err: "`MQTT_RECONNECT_INTERVAL` has to be positive"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "BACKOFF_MAX": "0s"}, err: "`BACKOFF_MAX` has to be positive"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "BACKOFF_MAX": "-1m"}, err: "`BACKOFF_MAX` has to be positive"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MAGPIE_HTTP_TIMEOUT": "0s"}, err: "`MAGPIE_HTTP_TIMEOUT` has to be positive"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MAGPIE_STALE_MULTIPLIER": "-2"}, err: "MAGPIE_STALE_MULTIPLIER='-2'"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "QUIET_HOURS": "late"}, err: "QUIET_HOURS='late'"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MAGPIE_TOPIC_STYLE": "flat"}, err: "MAGPIE_TOPIC_STYLE='flat'"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MAGPIE_TEMPERATURE_UNIT": "k"}, err: "MAGPIE_TEMPERATURE_UNIT='k'"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MAGPIE_LOG_FORMAT": "xml"}, err: "MAGPIE_LOG_FORMAT='xml'"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MAGPIE_LOG_LEVEL": "verbose"}, err: "MAGPIE_LOG_LEVEL='verbose'"},
+		{settings: map[string]string{"STDOUT_SINK": "1", "MAGPIE_LATITUDE": "910", "MAGPIE_LONGITUDE": "5", "DAYLIGHT_TOPIC": "daylight"}, err: "global coordinates"},
+	} {
+		_, err := ConfigFromLookup(mapLookup(c.settings))
+
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected an error about %s, got %v", c.err, err)
+		}
+	}
+}
+
+func TestSourceEnabled(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		enabled  bool
+		valid    bool
+	}{
+		{settings: map[string]string{}, enabled: false, valid: true},
+		{settings: map[string]string{"WEATHER_ENABLED": "true"}, enabled: false, valid: true},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather"}, enabled: true, valid: true},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_ENABLED": "1"}, enabled: true, valid: true},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_ENABLED": "false"}, enabled: false, valid: true},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_ENABLED": "0"}, enabled: false, valid: true},
+		{settings: map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_ENABLED": "off"}, enabled: false, valid: false},
+	} {
+		enabled, err := SourceEnabled(mapLookup(c.settings), "WEATHER")
+
+		if enabled != c.enabled || (err == nil) != c.valid {
+			t.Errorf("SourceEnabled(%v) = %t, %v, expected %t and valid to be %t", c.settings, enabled, err, c.enabled, c.valid)
+		}
+	}
+}
+
+func TestDisabledSourceKeepsItsTopic(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1", "SEASON_TOPIC": "season", "SEASON_ENABLED": "false"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if season := config.Source("season"); season.Enabled || season.Topic != "season" {
+		t.Fatalf("expected season to be switched off while keeping its topic, got %+v", season)
+	}
+
+	if _, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1", "SEASON_TOPIC": "season", "SEASON_ENABLED": "off"})); err == nil || !strings.Contains(err.Error(), "SEASON_ENABLED='off'") {
+		t.Fatalf("expected an error about `SEASON_ENABLED='off'`, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package magpie
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/* Flatten nested settings into variable names by joining the uppercased
+ * keys with underscores, so `weather: {topic: weather}` becomes
+ * `WEATHER_TOPIC=weather`. */
+func flattenSettings(prefix string, node map[string]any, settings map[string]string) error {
+	for key, value := range node {
+		name := strings.ToUpper(key)
+
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			if err := flattenSettings(name, value, settings); err != nil {
+				return err
+			}
+		case []any, nil:
+			return fmt.Errorf("could not use `%s`, expected a value or a mapping", name)
+		default:
+			if !EnvKnown(name) {
+				return fmt.Errorf("unknown setting `%s`", name)
+			}
+
+			settings[name] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+/* Parse settings from YAML, either nested by source such as
+ * `weather: {topic: weather}` or by their variable names such as
+ * `WEATHER_TOPIC: weather`. */
+func ParseConfigFile(data []byte) (map[string]string, error) {
+	var node map[string]any
+
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("could not parse the configuration file: %w", err)
+	}
+
+	settings := make(map[string]string)
+
+	if err := flattenSettings("", node, settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+/* Look up settings through `lookup` first and in `settings` second. */
+func overlayLookup(lookup func(string) (string, bool), settings map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if value, exists := lookup(name); exists {
+			return value, true
+		}
+
+		value, exists := settings[name]
+
+		return value, exists
+	}
+}
+
+/* Load the configuration from the YAML file at `path`, variables in the
+ * environment override the file. */
+func LoadConfigFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return Config{}, fmt.Errorf("could not read the configuration file: %w", err)
+	}
+
+	settings, err := ParseConfigFile(data)
+
+	if err != nil {
+		return Config{}, err
+	}
+
+	return ConfigFromLookup(overlayLookup(os.LookupEnv, settings))
+}
@@ -0,0 +1,62 @@
+package magpie
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	settings, err := ParseConfigFile([]byte("weather:\n  topic: weather\n  station_code: 6260\nMQTT_PREFIX: home\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]string{"WEATHER_TOPIC": "weather", "WEATHER_STATION_CODE": "6260", "MQTT_PREFIX": "home"}; !reflect.DeepEqual(settings, expected) {
+		t.Fatalf("expected %v, got %v", expected, settings)
+	}
+
+	for _, c := range []struct {
+		data string
+		err  string
+	}{
+		{data: "weather:\n  colour: blue\n", err: "WEATHER_COLOUR"},
+		{data: "weather:\n  topic: [weather, wind]\n", err: "WEATHER_TOPIC"},
+		{data: "weather: [", err: "could not parse"},
+	} {
+		if _, err := ParseConfigFile([]byte(c.data)); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected an error about %s, got %v", c.err, err)
+		}
+	}
+}
+
+func TestLoadConfigFileWithEnvironmentOverrides(t *testing.T) {
+	t.Setenv("MQTT_PREFIX", "garden")
+	t.Setenv("DAYLIGHT_INTERVAL", "2h")
+
+	config, err := LoadConfigFile("testdata/config.yaml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Prefix != "garden" || config.Username != "magpie" {
+		t.Errorf("expected the prefix of the environment and the username of the file, got `%s` and `%s`", config.Prefix, config.Username)
+	}
+
+	daylight := config.Source("daylight")
+
+	if daylight.Topic != "daylight" || daylight.Interval != 2*time.Hour || daylight.Coordinates != (Coordinates{Latitude: 52.37, Longitude: 4.89}) {
+		t.Errorf("expected daylight every 2h at the coordinates of the file, got %+v", daylight)
+	}
+
+	if season := config.Source("season"); !season.Enabled || season.Topic != "season" {
+		t.Errorf("expected season to be enabled by the file, got %+v", season)
+	}
+
+	if _, err := LoadConfigFile("testdata/missing.yaml"); err == nil {
+		t.Error("expected a missing file to be refused")
+	}
+}
@@ -0,0 +1,99 @@
+package magpie
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+/* A location on earth in degrees. */
+type Coordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+var (
+	ErrCoordinatesMissing = errors.New("no coordinates set")
+	ErrCoordinatesPartial = errors.New("only one of latitude and longitude set")
+	ErrCoordinatesRange   = errors.New("coordinates out of range")
+)
+
+/* Check that the latitude is within `[-90, 90]` and the longitude within
+ * `[-180, 180]`. */
+func ValidateCoordinates(coords Coordinates) error {
+	if coords.Latitude < -90 || coords.Latitude > 90 {
+		return fmt.Errorf("%w, latitude `%g` is not between -90 and 90", ErrCoordinatesRange, coords.Latitude)
+	}
+
+	if coords.Longitude < -180 || coords.Longitude > 180 {
+		return fmt.Errorf("%w, longitude `%g` is not between -180 and 180", ErrCoordinatesRange, coords.Longitude)
+	}
+
+	return nil
+}
+
+/* Parse the coordinates in `<prefix>_LATITUDE` and `<prefix>_LONGITUDE`,
+ * which have to be within range. */
+func coordinatesFromEnv(lookup func(string) (string, bool), prefix string) (Coordinates, error) {
+	var err error
+	var coords Coordinates
+
+	latName := fmt.Sprintf("%s_LATITUDE", prefix)
+	lonName := fmt.Sprintf("%s_LONGITUDE", prefix)
+
+	latFromEnv, latExists := lookup(latName)
+	lonFromEnv, lonExists := lookup(lonName)
+
+	if !latExists && !lonExists {
+		return coords, ErrCoordinatesMissing
+	}
+
+	if !latExists || !lonExists {
+		return coords, fmt.Errorf("%w, needs both `%s` and `%s`", ErrCoordinatesPartial, latName, lonName)
+	}
+
+	if coords.Latitude, err = strconv.ParseFloat(latFromEnv, 64); err != nil {
+		return coords, fmt.Errorf("could not parse `%s='%s'` as float", latName, latFromEnv)
+	}
+
+	if coords.Longitude, err = strconv.ParseFloat(lonFromEnv, 64); err != nil {
+		return coords, fmt.Errorf("could not parse `%s='%s'` as float", lonName, lonFromEnv)
+	}
+
+	if err = ValidateCoordinates(coords); err != nil {
+		return coords, fmt.Errorf("`%s` and `%s` %w", latName, lonName, err)
+	}
+
+	return coords, nil
+}
+
+/* Resolve the coordinates for a source from `<prefix>_LATITUDE` and
+ * `<prefix>_LONGITUDE`, falling back to `MAGPIE_LATITUDE` and
+ * `MAGPIE_LONGITUDE` when the source sets neither. `global` reports whether
+ * the fallback was used, errors in the fallback concern every source. */
+func ResolveCoordinates(lookup func(string) (string, bool), prefix string) (coords Coordinates, global bool, err error) {
+	if coords, err = coordinatesFromEnv(lookup, prefix); !errors.Is(err, ErrCoordinatesMissing) {
+		return coords, false, err
+	}
+
+	coords, err = coordinatesFromEnv(lookup, "MAGPIE")
+
+	return coords, true, err
+}
+
+/* Mean radius of the earth in kilometers. */
+const earthRadiusKm = 6371.0
+
+/* The great-circle distance between two locations in kilometers, by the
+ * haversine formula. */
+func DistanceKm(a Coordinates, b Coordinates) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := (b.Latitude - a.Latitude) * math.Pi / 180
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
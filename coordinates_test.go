@@ -0,0 +1,118 @@
+package magpie
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestResolveCoordinates(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		coords   Coordinates
+		global   bool
+		err      error
+	}{
+		{settings: map[string]string{"DAYLIGHT_LATITUDE": "52.1", "DAYLIGHT_LONGITUDE": "5.2"}, coords: Coordinates{Latitude: 52.1, Longitude: 5.2}},
+		{settings: map[string]string{"MAGPIE_LATITUDE": "51", "MAGPIE_LONGITUDE": "4"}, coords: Coordinates{Latitude: 51, Longitude: 4}, global: true},
+		{settings: map[string]string{"DAYLIGHT_LATITUDE": "52.1", "MAGPIE_LATITUDE": "51", "MAGPIE_LONGITUDE": "4"}, err: ErrCoordinatesPartial},
+		{settings: map[string]string{}, global: true, err: ErrCoordinatesMissing},
+	} {
+		coords, global, err := ResolveCoordinates(mapLookup(c.settings), "DAYLIGHT")
+
+		if !errors.Is(err, c.err) || (c.err == nil && err != nil) {
+			t.Errorf("expected %v for %v, got %v", c.err, c.settings, err)
+		} else if c.err == nil && (coords != c.coords || global != c.global) {
+			t.Errorf("expected %+v and global %t for %v, got %+v and %t", c.coords, c.global, c.settings, coords, global)
+		}
+	}
+}
+
+func TestPartialCoordinatesOnlyDisableTheirSource(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":       "1",
+		"DAYLIGHT_TOPIC":    "daylight",
+		"DAYLIGHT_LATITUDE": "52.1",
+		"SEASON_TOPIC":      "season",
+	}))
+
+	if err != nil {
+		t.Fatalf("expected partial coordinates of a source to be accepted, got %s", err)
+	}
+
+	buffer, restore := captureLog()
+	defer restore()
+
+	ch := make(chan MqttCronMessage)
+
+	DayLightLoop(context.Background(), ch, config.Source("daylight"))
+
+	restore()
+
+	if !strings.Contains(buffer.String(), "DayLightLoop could not use its coordinates") || !strings.Contains(buffer.String(), "disabled") {
+		t.Fatalf("expected the daylight source to log that it is disabled, got %q", buffer.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		SeasonLoop(ctx, ch, config.Source("season"))
+	}()
+
+	m := receive(t, ch)
+
+	cancel()
+	<-done
+
+	if m.Topic != "season" {
+		t.Fatalf("expected the season source to keep running, got %+v", m)
+	}
+}
+
+func TestValidateCoordinatesBoundaries(t *testing.T) {
+	for _, c := range []struct {
+		coords Coordinates
+		valid  bool
+	}{
+		{coords: Coordinates{Latitude: 90, Longitude: 180}, valid: true},
+		{coords: Coordinates{Latitude: -90, Longitude: -180}, valid: true},
+		{coords: Coordinates{Latitude: 0, Longitude: 0}, valid: true},
+		{coords: Coordinates{Latitude: 90.0001, Longitude: 0}, valid: false},
+		{coords: Coordinates{Latitude: -90.0001, Longitude: 0}, valid: false},
+		{coords: Coordinates{Latitude: 0, Longitude: 180.0001}, valid: false},
+		{coords: Coordinates{Latitude: 0, Longitude: -180.0001}, valid: false},
+	} {
+		err := ValidateCoordinates(c.coords)
+
+		if (err == nil) != c.valid {
+			t.Errorf("ValidateCoordinates(%+v) returned %v, expected valid to be %t", c.coords, err, c.valid)
+		} else if !c.valid && !errors.Is(err, ErrCoordinatesRange) {
+			t.Errorf("expected ErrCoordinatesRange for %+v, got %v", c.coords, err)
+		}
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	amsterdam := Coordinates{Latitude: 52.3676, Longitude: 4.9041}
+	paris := Coordinates{Latitude: 48.8566, Longitude: 2.3522}
+
+	if distance := DistanceKm(amsterdam, paris); math.Abs(distance-430) > 5 {
+		t.Fatalf("expected about 430km between Amsterdam and Paris, got %.1f", distance)
+	}
+
+	if distance := DistanceKm(paris, amsterdam); math.Abs(distance-DistanceKm(amsterdam, paris)) > 1e-9 {
+		t.Fatalf("expected the distance to be the same both ways, got %.1f", distance)
+	}
+
+	if distance := DistanceKm(amsterdam, amsterdam); distance != 0 {
+		t.Fatalf("expected no distance to itself, got %f", distance)
+	}
+
+	if distance := DistanceKm(Coordinates{Latitude: 0, Longitude: 0}, Coordinates{Latitude: 0, Longitude: 180}); math.Abs(distance-math.Pi*earthRadiusKm) > 1e-6 {
+		t.Fatalf("expected half the circumference between antipodes, got %.1f", distance)
+	}
+}
@@ -1,16 +1,17 @@
 package magpie
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
+	"net/url"
 	"strconv"
 	"time"
 )
 
+var dayLightLog = NewLogger("daylight")
+
 /* Result data from the `sunrise-sunset.org` API. */
 type DayLightAPIData struct {
 	Sunrise                   time.Time `json:"sunrise"`
@@ -31,80 +32,384 @@ type DayLightAPIResult struct {
 	Results DayLightAPIData `json:"results"`
 }
 
+/* Errors returned by `FetchDaylight`, wrapped with the underlying cause.
+ * Responses without a `2xx` status return `ErrHttpStatus` instead. */
+var (
+	ErrDayLightUnreachable = errors.New("could not communicate with the `api.sunrise-sunset.org` domain")
+	ErrDayLightParse       = errors.New("could not parse the response")
+	ErrDayLightStatus      = errors.New("the response status was not OK")
+)
+
 /* Call the `sunrise-sunset.org` API and deserialize the result. */
-func DayLightAPICall(apiUrl string) DayLightAPIData {
-	var err error
-	var res *http.Response
+func DayLightAPICall(ctx context.Context, apiUrl string) (DayLightAPIData, error) {
+	body, err := httpGet(ctx, apiUrl)
 
-	if res, err = http.Get(apiUrl); err != nil {
-		log.Fatalln("DaylightAPICall could not communicate with the `api.sunrise-sunset.org` domain.")
+	if errors.Is(err, ErrHttpStatus) {
+		return DayLightAPIData{}, err
 	}
 
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
-
 	if err != nil {
-		log.Fatalln("DaylightAPICall could not read the response.")
+		return DayLightAPIData{}, fmt.Errorf("%w: %s", ErrDayLightUnreachable, err)
+	}
+
+	var apiStatus struct {
+		Status string `json:"status"`
 	}
 
 	var apiResult DayLightAPIResult
 
+	/* The results are an empty string rather than an object when the status
+	 * is not OK, so the status is checked before the results are parsed. */
+	if err := json.Unmarshal(body, &apiStatus); err != nil {
+		return DayLightAPIData{}, fmt.Errorf("%w: %s", ErrDayLightParse, err)
+	}
+
+	if apiStatus.Status != "OK" {
+		return DayLightAPIData{}, fmt.Errorf("%w: %s", ErrDayLightStatus, apiStatus.Status)
+	}
+
 	if err := json.Unmarshal(body, &apiResult); err != nil {
-		log.Fatalln("DaylightAPICall could not parse the response.")
+		return DayLightAPIData{}, fmt.Errorf("%w: %s", ErrDayLightParse, err)
 	}
 
-	return apiResult.Results
+	return apiResult.Results, nil
 }
 
-/* A loop that waits between calls to the `sunrise-sunset.org` API
- * and submits the current daylight status to the topic given in the
- * environment variable `DAYLIGHT_TOPIC`. */
-func DayLightLoop(ch chan MqttCronMessage) {
-	topicFromEnv, topicExists := os.LookupEnv("DAYLIGHT_TOPIC")
+/* The endpoint of the `sunrise-sunset.org` API, replaceable for tests. */
+var dayLightBaseUrl = "https://api.sunrise-sunset.org/json"
 
-	if !topicExists {
-		log.Println("DayLightLoop needs `DAYLIGHT_TOPIC` set in the environment, disabled.")
-		return
+/* Fetch the sun times for a location on `date`, which is either `today` or
+ * a date in the `YYYY-MM-DD` format. */
+func FetchDaylight(ctx context.Context, lat, lon float64, date string) (DayLightAPIData, error) {
+	return DayLightAPICall(ctx, DayLightAPIUrl(dayLightBaseUrl, lat, lon, date))
+}
+
+/* Build the `sunrise-sunset.org` API url for a location and date. */
+func DayLightAPIUrl(baseUrl string, lat, lon float64, date string) string {
+	return fmt.Sprintf("%s?lat=%f&lng=%f&date=%s&formatted=0", baseUrl, lat, lon, url.QueryEscape(date))
+}
+
+/* The sun times published as subtopics of the daylight topic, times are
+ * formatted as RFC3339 and the day length in seconds. */
+func DayLightMetrics(d DayLightAPIData) []Metric {
+	return []Metric{
+		{Name: "sunrise", Value: d.Sunrise.Format(time.RFC3339)},
+		{Name: "sunset", Value: d.Sunset.Format(time.RFC3339)},
+		{Name: "solar_noon", Value: d.SolarNoon.Format(time.RFC3339)},
+		{Name: "day_length", Value: strconv.Itoa(d.DayLength)},
+	}
+}
+
+/* The daylight status and sun times as a single document for
+ * `DAYLIGHT_FORMAT=json`, times are in RFC3339. */
+type DayLightDocument struct {
+	IsDay                     bool      `json:"is_day"`
+	Phase                     string    `json:"phase"`
+	Lighting                  string    `json:"lighting"`
+	Trend                     string    `json:"trend,omitempty"`
+	Sunrise                   time.Time `json:"sunrise"`
+	Sunset                    time.Time `json:"sunset"`
+	SolarNoon                 time.Time `json:"solar_noon"`
+	DayLength                 int       `json:"day_length"`
+	CivilTwilightBegin        time.Time `json:"civil_twilight_begin"`
+	CivilTwilightEnd          time.Time `json:"civil_twilight_end"`
+	NauticalTwilightBegin     time.Time `json:"nautical_twilight_begin"`
+	NauticalTwilightEnd       time.Time `json:"nautical_twilight_end"`
+	AstronomicalTwilightBegin time.Time `json:"astronomical_twilight_begin"`
+	AstronomicalTwilightEnd   time.Time `json:"astronomical_twilight_end"`
+}
+
+/* Combine the status at `now` and the sun times into a JSON document, the
+ * trend is left out when it is empty. */
+func DayLightJSON(now time.Time, d DayLightAPIData, trend string) (string, error) {
+	payload, err := json.Marshal(DayLightDocument{
+		IsDay:                     IsDayTime(now, d),
+		Phase:                     TwilightPhase(now, d),
+		Lighting:                  LightingWindow(now, d),
+		Trend:                     trend,
+		Sunrise:                   d.Sunrise,
+		Sunset:                    d.Sunset,
+		SolarNoon:                 d.SolarNoon,
+		DayLength:                 d.DayLength,
+		CivilTwilightBegin:        d.CivilTwilightBegin,
+		CivilTwilightEnd:          d.CivilTwilightEnd,
+		NauticalTwilightBegin:     d.NauticalTwilightBegin,
+		NauticalTwilightEnd:       d.NauticalTwilightEnd,
+		AstronomicalTwilightBegin: d.AstronomicalTwilightBegin,
+		AstronomicalTwilightEnd:   d.AstronomicalTwilightEnd,
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("could not serialize the daylight: %w", err)
 	}
 
-	latFromEnv, latExists := os.LookupEnv("DAYLIGHT_LATITUDE")
-	lonFromEnv, lonExists := os.LookupEnv("DAYLIGHT_LONGITUDE")
+	return string(payload), nil
+}
+
+/* The payloads of a flag in every style, the payload for true comes
+ * first. */
+var flagPayloads = map[string][2]string{
+	"yesno":     {"yes", "no"},
+	"onoff":     {"ON", "OFF"},
+	"truefalse": {"true", "false"},
+}
+
+/* Map a flag to its payload in `style`, which is `yesno`, `onoff` as Home
+ * Assistant binary sensors expect, or `truefalse`. */
+func FlagPayload(value bool, style string) (string, error) {
+	payloads, exists := flagPayloads[style]
+
+	if !exists {
+		return "", fmt.Errorf("unknown payload style `%s`, expected `yesno`, `onoff`, or `truefalse`", style)
+	}
+
+	if value {
+		return payloads[0], nil
+	}
+
+	return payloads[1], nil
+}
+
+/* Determine if `now` is between sunrise and sunset. */
+func IsDayTime(now time.Time, d DayLightAPIData) bool {
+	return !now.Before(d.Sunrise) && !now.After(d.Sunset)
+}
+
+/* Determine the phase of light at `now`, one of `day`, `civil_twilight`,
+ * `nautical_twilight`, `astronomical_twilight`, or `night`. */
+func TwilightPhase(now time.Time, d DayLightAPIData) string {
+	inside := func(begin time.Time, end time.Time) bool {
+		return !now.Before(begin) && now.Before(end)
+	}
 
-	if !latExists || !lonExists {
-		log.Fatalln("DayLightLoop needs both `DAYLIGHT_LATITUDE` and `DAYLIGHT_LONGITUDE` set in the environment.")
+	switch {
+	case inside(d.Sunrise, d.Sunset):
+		return "day"
+	case inside(d.CivilTwilightBegin, d.CivilTwilightEnd):
+		return "civil_twilight"
+	case inside(d.NauticalTwilightBegin, d.NauticalTwilightEnd):
+		return "nautical_twilight"
+	case inside(d.AstronomicalTwilightBegin, d.AstronomicalTwilightEnd):
+		return "astronomical_twilight"
+	default:
+		return "night"
 	}
+}
+
+/* How long golden hour lasts after sunrise and before sunset. */
+const goldenHour = time.Hour
 
-	var err error
-	var lat float64
-	var lon float64
+/* Determine the light for photography at `now`, `blue_hour` during civil
+ * twilight, `golden_hour` during the first hour after sunrise and the last
+ * hour before sunset, `daylight` in between, or `night`. */
+func LightingWindow(now time.Time, d DayLightAPIData) string {
+	inside := func(begin time.Time, end time.Time) bool {
+		return !now.Before(begin) && now.Before(end)
+	}
 
-	if lat, err = strconv.ParseFloat(latFromEnv, 32); err != nil {
-		log.Fatalf("DayLightLoop could not parse environment variable `DAYLIGHT_LATITUDE='%s'` as float.\n", latFromEnv)
+	switch {
+	case inside(d.Sunrise, d.Sunrise.Add(goldenHour)), inside(d.Sunset.Add(-goldenHour), d.Sunset):
+		return "golden_hour"
+	case inside(d.Sunrise, d.Sunset):
+		return "daylight"
+	case inside(d.CivilTwilightBegin, d.Sunrise), inside(d.Sunset, d.CivilTwilightEnd):
+		return "blue_hour"
+	default:
+		return "night"
 	}
+}
 
-	if lon, err = strconv.ParseFloat(lonFromEnv, 32); err != nil {
-		log.Fatalf("DayLightLoop could not parse environment variable `DAYLIGHT_LONGITUDE='%s'` as float.\n", lonFromEnv)
+/* Compare the day length of today to the one of yesterday, days are either
+ * `lengthening` or `shortening`, or `steady` when both are as long. */
+func DayLengthTrend(today DayLightAPIData, yesterday DayLightAPIData) string {
+	switch {
+	case today.DayLength > yesterday.DayLength:
+		return "lengthening"
+	case today.DayLength < yesterday.DayLength:
+		return "shortening"
+	default:
+		return "steady"
 	}
+}
 
-	log.Print("DayLightLoop enabled.\n")
+/* Keeps the sun times per date so the API is called once per day, `Fetch`
+ * is usually a call to `FetchDaylight`. */
+type DayLightCache struct {
+	Fetch func(ctx context.Context, date string) (DayLightAPIData, error)
 
-	apiUrl := fmt.Sprintf("https://api.sunrise-sunset.org/json?lat=%f&lng=%f&date=today&formatted=0", lat, lon)
+	entries map[string]DayLightAPIData
+}
+
+/* Number of dates a `DayLightCache` holds on to. */
+const dayLightCacheSize = 7
+
+func NewDayLightCache(fetch func(ctx context.Context, date string) (DayLightAPIData, error)) *DayLightCache {
+	return &DayLightCache{Fetch: fetch, entries: make(map[string]DayLightAPIData)}
+}
+
+/* Return the sun times for `date` in the `YYYY-MM-DD` format, fetching them
+ * when they are not cached yet. The oldest dates are dropped when the cache
+ * is full. */
+func (c *DayLightCache) Get(ctx context.Context, date string) (DayLightAPIData, error) {
+	if data, exists := c.entries[date]; exists {
+		return data, nil
+	}
+
+	data, err := c.Fetch(ctx, date)
+
+	if err != nil {
+		return data, err
+	}
+
+	c.entries[date] = data
+
+	for len(c.entries) > dayLightCacheSize {
+		oldest := date
+
+		for cached := range c.entries {
+			oldest = min(oldest, cached)
+		}
+
+		delete(c.entries, oldest)
+	}
+
+	return data, nil
+}
+
+/* The first midnight after `now` in the timezone of `now`. */
+func NextMidnight(now time.Time) time.Time {
+	year, month, day := now.Date()
+
+	return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+}
+
+/* How long the daylight loop waits after `now`, which is the interval
+ * unless the next midnight comes first so the new day's sun times are
+ * fetched right away. */
+func DayLightWait(now time.Time, interval time.Duration) time.Duration {
+	return min(interval, NextMidnight(now).Sub(now))
+}
+
+/* The settings of the daylight source. */
+type dayLightSettings struct {
+	format string
+	style  string
+}
+
+/* Read and check the settings of the daylight source. */
+func dayLightSettingsFromConfig(cfg SourceConfig) (dayLightSettings, error) {
+	settings := dayLightSettings{format: cfg.Get("DAYLIGHT_FORMAT"), style: cfg.Get("DAYLIGHT_PAYLOAD_STYLE")}
+
+	if settings.format != "" && settings.format != "plain" && settings.format != "json" {
+		return settings, fmt.Errorf("could not use `DAYLIGHT_FORMAT='%s'`, expected `plain` or `json`", settings.format)
+	}
+
+	if _, err := FlagPayload(true, settings.style); err != nil {
+		return settings, fmt.Errorf("could not use `DAYLIGHT_PAYLOAD_STYLE`: %w", err)
+	}
+
+	return settings, nil
+}
+
+/* A loop that fetches the sun times from the `sunrise-sunset.org` API once
+ * per day, right after midnight, and submits the current daylight status
+ * to the topic given in the environment variable `DAYLIGHT_TOPIC` every
+ * interval. */
+func DayLightLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	if errors.Is(cfg.CoordinatesErr, ErrCoordinatesMissing) {
+		dayLightLog.Println("DayLightLoop needs `DAYLIGHT_LATITUDE` and `DAYLIGHT_LONGITUDE`, or `MAGPIE_LATITUDE` and `MAGPIE_LONGITUDE`, set in the environment, disabled.")
+		return
+	}
+
+	if cfg.CoordinatesErr != nil {
+		dayLightLog.Warnf("DayLightLoop could not use its coordinates: %s, disabled.\n", cfg.CoordinatesErr)
+		return
+	}
+
+	settings, err := dayLightSettingsFromConfig(cfg)
+
+	if err != nil {
+		dayLightLog.Warnf("DayLightLoop %s, disabled.\n", err)
+		return
+	}
+
+	dayLightLog.Print("DayLightLoop enabled.\n")
+
+	cache := NewDayLightCache(func(ctx context.Context, date string) (DayLightAPIData, error) {
+		return FetchDaylight(ctx, cfg.Coordinates.Latitude, cfg.Coordinates.Longitude, date)
+	})
 
 	for {
-		apiResult := DayLightAPICall(apiUrl)
+		var apiResult DayLightAPIData
+
+		date := cfg.Now().In(cfg.Location).Format(time.DateOnly)
 
-		var isDayTime string
-		now := time.Now().UTC()
+		if !fetchWithRetry(ctx, cfg, dayLightLog, "DayLightLoop could not fetch daylight", func() error {
+			var err error
 
-		if now.Before(apiResult.Sunrise.UTC()) || now.After(apiResult.Sunset.UTC()) {
-			isDayTime = "no"
+			apiResult, err = cache.Get(ctx, date)
+
+			return err
+		}) {
+			return
+		}
+
+		var trend string
+
+		now := cfg.Now().UTC()
+		yesterday := cfg.Now().In(cfg.Location).AddDate(0, 0, -1).Format(time.DateOnly)
+
+		if yesterdayResult, err := cache.Get(ctx, yesterday); err != nil {
+			FetchErrors.Inc(cfg.Name)
+			dayLightLog.Warnf("DayLightLoop could not fetch daylight of yesterday, skipping trend: %s.\n", err)
 		} else {
-			isDayTime = "yes"
+			trend = DayLengthTrend(apiResult, yesterdayResult)
 		}
 
-		ch <- MqttCronMessage{Retain: true, Topic: topicFromEnv, Payload: fmt.Sprintf("%s", isDayTime)}
+		if settings.format == "json" {
+			payload, err := DayLightJSON(now, apiResult, trend)
+
+			if err != nil {
+				dayLightLog.Warnf("DayLightLoop %s.\n", err)
+			} else if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: payload}) {
+				return
+			}
+
+			if !sleepContext(ctx, DayLightWait(cfg.Now().In(cfg.Location), cfg.Interval)) {
+				return
+			}
 
-		time.Sleep(1 * time.Hour)
+			continue
+		}
+
+		isDayTime, _ := FlagPayload(IsDayTime(now, apiResult), settings.style)
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: isDayTime}) {
+			return
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "phase"), Payload: TwilightPhase(now, apiResult)}) {
+			return
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "lighting"), Payload: LightingWindow(now, apiResult)}) {
+			return
+		}
+
+		for _, metric := range DayLightMetrics(apiResult) {
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, metric.Name), Payload: metric.Value}) {
+				return
+			}
+		}
+
+		if trend != "" {
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "trend"), Payload: trend}) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, DayLightWait(cfg.Now().In(cfg.Location), cfg.Interval)) {
+			return
+		}
 	}
 }
@@ -0,0 +1,477 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* The sun times of Amsterdam on the longest day of 2026. */
+func fixedDayLight() DayLightAPIData {
+	at := func(hour int, minute int, second int) time.Time {
+		return time.Date(2026, 6, 21, hour, minute, second, 0, time.UTC)
+	}
+
+	return DayLightAPIData{
+		Sunrise:               at(3, 18, 12),
+		Sunset:                at(20, 6, 40),
+		SolarNoon:             at(11, 42, 26),
+		DayLength:             60508,
+		CivilTwilightBegin:    at(2, 30, 5),
+		CivilTwilightEnd:      at(20, 54, 47),
+		NauticalTwilightBegin: at(1, 12, 44),
+		NauticalTwilightEnd:   at(22, 12, 8),
+	}
+}
+
+/* Serve `body` as the `sunrise-sunset.org` API until the test ends, the
+ * query of every request is sent on the returned channel when there is
+ * room. */
+func dayLightServer(t *testing.T, body []byte) chan url.Values {
+	t.Helper()
+
+	queries := make(chan url.Values, 16)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case queries <- r.URL.Query():
+		default:
+		}
+
+		w.Write(body)
+	}))
+
+	previous := dayLightBaseUrl
+	dayLightBaseUrl = server.URL
+
+	t.Cleanup(func() {
+		dayLightBaseUrl = previous
+		server.Close()
+	})
+
+	return queries
+}
+
+func TestFetchDaylight(t *testing.T) {
+	body, err := os.ReadFile("testdata/daylight.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := dayLightServer(t, body)
+
+	d, err := FetchDaylight(context.Background(), 52.37, 4.89, "2026-06-21")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := <-queries
+
+	if query.Get("lat") != "52.370000" || query.Get("lng") != "4.890000" || query.Get("date") != "2026-06-21" || query.Get("formatted") != "0" {
+		t.Fatalf("expected the location and date in the query, got %s", query.Encode())
+	}
+
+	for _, c := range []struct {
+		name     string
+		got      time.Time
+		expected time.Time
+	}{
+		{name: "sunrise", got: d.Sunrise, expected: time.Date(2026, 6, 21, 3, 18, 12, 0, time.UTC)},
+		{name: "sunset", got: d.Sunset, expected: time.Date(2026, 6, 21, 20, 6, 40, 0, time.UTC)},
+		{name: "solar noon", got: d.SolarNoon, expected: time.Date(2026, 6, 21, 11, 42, 26, 0, time.UTC)},
+		{name: "civil twilight begin", got: d.CivilTwilightBegin, expected: time.Date(2026, 6, 21, 2, 30, 5, 0, time.UTC)},
+		{name: "nautical twilight end", got: d.NauticalTwilightEnd, expected: time.Date(2026, 6, 21, 22, 12, 8, 0, time.UTC)},
+	} {
+		if !c.got.Equal(c.expected) {
+			t.Errorf("expected %s at %s, got %s", c.name, c.expected, c.got)
+		}
+	}
+
+	if d.DayLength != 60508 {
+		t.Errorf("expected a day length of 60508, got %d", d.DayLength)
+	}
+}
+
+func TestDayLightMetrics(t *testing.T) {
+	expected := []Metric{
+		{Name: "sunrise", Value: "2026-06-21T03:18:12Z"},
+		{Name: "sunset", Value: "2026-06-21T20:06:40Z"},
+		{Name: "solar_noon", Value: "2026-06-21T11:42:26Z"},
+		{Name: "day_length", Value: "60508"},
+	}
+
+	if metrics := DayLightMetrics(fixedDayLight()); !reflect.DeepEqual(metrics, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, metrics)
+	}
+}
+
+func TestTwilightPhaseBoundaries(t *testing.T) {
+	d := fixedDayLight()
+
+	for _, c := range []struct {
+		at    time.Time
+		phase string
+	}{
+		{at: d.NauticalTwilightBegin.Add(-time.Second), phase: "night"},
+		{at: d.NauticalTwilightBegin, phase: "nautical_twilight"},
+		{at: d.CivilTwilightBegin, phase: "civil_twilight"},
+		{at: d.Sunrise.Add(-time.Second), phase: "civil_twilight"},
+		{at: d.Sunrise, phase: "day"},
+		{at: d.Sunset.Add(-time.Second), phase: "day"},
+		{at: d.Sunset, phase: "civil_twilight"},
+		{at: d.CivilTwilightEnd, phase: "nautical_twilight"},
+		{at: d.NauticalTwilightEnd, phase: "night"},
+	} {
+		if phase := TwilightPhase(c.at, d); phase != c.phase {
+			t.Errorf("TwilightPhase(%s) = %s, expected %s", c.at.Format(time.TimeOnly), phase, c.phase)
+		}
+	}
+}
+
+func TestTwilightPhaseAstronomical(t *testing.T) {
+	d := fixedDayLight()
+	d.AstronomicalTwilightBegin = d.NauticalTwilightBegin.Add(-time.Hour)
+	d.AstronomicalTwilightEnd = d.NauticalTwilightEnd.Add(time.Hour)
+
+	for _, c := range []struct {
+		at    time.Time
+		phase string
+	}{
+		{at: d.AstronomicalTwilightBegin.Add(-time.Second), phase: "night"},
+		{at: d.AstronomicalTwilightBegin, phase: "astronomical_twilight"},
+		{at: d.NauticalTwilightEnd, phase: "astronomical_twilight"},
+		{at: d.AstronomicalTwilightEnd, phase: "night"},
+	} {
+		if phase := TwilightPhase(c.at, d); phase != c.phase {
+			t.Errorf("TwilightPhase(%s) = %s, expected %s", c.at.Format(time.TimeOnly), phase, c.phase)
+		}
+	}
+}
+
+func TestDayLightWait(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		now      time.Time
+		expected time.Duration
+	}{
+		{now: time.Date(2026, 6, 20, 12, 0, 0, 0, time.UTC), expected: time.Hour},
+		{now: time.Date(2026, 6, 20, 23, 50, 0, 0, time.UTC), expected: 10 * time.Minute},
+		{now: time.Date(2026, 3, 28, 23, 30, 0, 0, amsterdam), expected: 30 * time.Minute},
+	} {
+		if wait := DayLightWait(c.now, time.Hour); wait != c.expected {
+			t.Errorf("DayLightWait(%s) = %s, expected %s", c.now, wait, c.expected)
+		}
+	}
+}
+
+/* A clock running at real speed from a chosen time. */
+type shiftedClock struct {
+	offset time.Duration
+}
+
+func (c shiftedClock) Now() time.Time {
+	return time.Now().Add(c.offset)
+}
+
+func TestDayLightLoopFetchesTheNewDayAfterMidnight(t *testing.T) {
+	body, err := os.ReadFile("testdata/daylight.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := dayLightServer(t, body)
+
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":       "1",
+		"DAYLIGHT_TOPIC":    "daylight",
+		"DAYLIGHT_INTERVAL": "1h",
+		"MAGPIE_LATITUDE":   "52.37",
+		"MAGPIE_LONGITUDE":  "4.89",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Source("daylight")
+	cfg.Clock = shiftedClock{offset: time.Until(time.Date(2026, 6, 20, 23, 59, 59, 800_000_000, time.UTC))}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		DayLightLoop(ctx, ch, cfg)
+	}()
+
+	stop := discard(ch)
+	defer stop()
+
+	var dates []string
+
+	for len(dates) < 3 {
+		select {
+		case query := <-queries:
+			dates = append(dates, query.Get("date"))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected the sun times of the next day to be fetched after midnight, fetched %v", dates)
+		}
+	}
+
+	cancel()
+	<-done
+
+	if expected := []string{"2026-06-20", "2026-06-19", "2026-06-21"}; !reflect.DeepEqual(dates, expected) {
+		t.Fatalf("expected to fetch %v, got %v", expected, dates)
+	}
+}
+
+func TestDayLightCacheFetchesOncePerDay(t *testing.T) {
+	calls := make(map[string]int)
+
+	cache := NewDayLightCache(func(ctx context.Context, date string) (DayLightAPIData, error) {
+		calls[date]++
+
+		if date == "2026-06-22" && calls[date] == 1 {
+			return DayLightAPIData{}, ErrDayLightUnreachable
+		}
+
+		return fixedDayLight(), nil
+	})
+
+	for _, date := range []string{"2026-06-21", "2026-06-21", "2026-06-20", "2026-06-21", "2026-06-22", "2026-06-22"} {
+		cache.Get(context.Background(), date)
+	}
+
+	if expected := map[string]int{"2026-06-20": 1, "2026-06-21": 1, "2026-06-22": 2}; !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected a single call per day and a retry after a failure, got %v", calls)
+	}
+}
+
+func TestDayLightCacheDropsTheOldestDates(t *testing.T) {
+	calls := 0
+
+	cache := NewDayLightCache(func(ctx context.Context, date string) (DayLightAPIData, error) {
+		calls++
+		return fixedDayLight(), nil
+	})
+
+	for day := 1; day <= dayLightCacheSize+1; day++ {
+		cache.Get(context.Background(), time.Date(2026, 6, day, 0, 0, 0, 0, time.UTC).Format(time.DateOnly))
+	}
+
+	cache.Get(context.Background(), "2026-06-08")
+	cache.Get(context.Background(), "2026-06-01")
+
+	if calls != dayLightCacheSize+2 {
+		t.Fatalf("expected only the oldest date to be fetched again, got %d calls", calls)
+	}
+}
+
+func TestDayLengthTrendFlipsAtTheSolstices(t *testing.T) {
+	dayLengths := map[string]int{
+		"2026-06-19": 60479,
+		"2026-06-20": 60498,
+		"2026-06-21": 60508,
+		"2026-06-22": 60508,
+		"2026-06-23": 60499,
+		"2026-12-20": 27958,
+		"2026-12-21": 27950,
+		"2026-12-22": 27953,
+	}
+
+	cache := NewDayLightCache(func(ctx context.Context, date string) (DayLightAPIData, error) {
+		return DayLightAPIData{DayLength: dayLengths[date]}, nil
+	})
+
+	for _, c := range []struct {
+		yesterday string
+		today     string
+		trend     string
+	}{
+		{yesterday: "2026-06-19", today: "2026-06-20", trend: "lengthening"},
+		{yesterday: "2026-06-20", today: "2026-06-21", trend: "lengthening"},
+		{yesterday: "2026-06-21", today: "2026-06-22", trend: "steady"},
+		{yesterday: "2026-06-22", today: "2026-06-23", trend: "shortening"},
+		{yesterday: "2026-12-20", today: "2026-12-21", trend: "shortening"},
+		{yesterday: "2026-12-21", today: "2026-12-22", trend: "lengthening"},
+	} {
+		yesterday, _ := cache.Get(context.Background(), c.yesterday)
+		today, _ := cache.Get(context.Background(), c.today)
+
+		if trend := DayLengthTrend(today, yesterday); trend != c.trend {
+			t.Errorf("expected %s on %s, got %s", c.trend, c.today, trend)
+		}
+	}
+}
+
+func TestDayLightJSON(t *testing.T) {
+	payload, err := DayLightJSON(time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC), fixedDayLight(), "lengthening")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document map[string]any
+
+	if err := json.Unmarshal([]byte(payload), &document); err != nil {
+		t.Fatalf("expected a JSON object, got %q: %s", payload, err)
+	}
+
+	expected := map[string]any{
+		"is_day":                      true,
+		"phase":                       "day",
+		"lighting":                    "daylight",
+		"trend":                       "lengthening",
+		"sunrise":                     "2026-06-21T03:18:12Z",
+		"sunset":                      "2026-06-21T20:06:40Z",
+		"solar_noon":                  "2026-06-21T11:42:26Z",
+		"day_length":                  float64(60508),
+		"civil_twilight_begin":        "2026-06-21T02:30:05Z",
+		"civil_twilight_end":          "2026-06-21T20:54:47Z",
+		"nautical_twilight_begin":     "2026-06-21T01:12:44Z",
+		"nautical_twilight_end":       "2026-06-21T22:12:08Z",
+		"astronomical_twilight_begin": "0001-01-01T00:00:00Z",
+		"astronomical_twilight_end":   "0001-01-01T00:00:00Z",
+	}
+
+	if !reflect.DeepEqual(document, expected) {
+		t.Fatalf("expected %v, got %v", expected, document)
+	}
+
+	if payload, err = DayLightJSON(time.Date(2026, 6, 21, 23, 0, 0, 0, time.UTC), fixedDayLight(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(payload, `"is_day":false`) || strings.Contains(payload, `"trend"`) {
+		t.Fatalf("expected night without a trend, got %q", payload)
+	}
+}
+
+func TestDayLightInvalidRequestPublishesNothing(t *testing.T) {
+	defer func(jitter func(time.Duration) time.Duration) { retryJitter = jitter }(retryJitter)
+
+	retryJitter = func(time.Duration) time.Duration { return time.Millisecond }
+
+	queries := dayLightServer(t, []byte(`{"results": "", "status": "INVALID_REQUEST"}`))
+
+	if _, err := FetchDaylight(context.Background(), 52.37, 4.89, "2026-06-21"); !errors.Is(err, ErrDayLightStatus) || !strings.Contains(err.Error(), "INVALID_REQUEST") {
+		t.Fatalf("expected ErrDayLightStatus with INVALID_REQUEST, got %v", err)
+	}
+
+	<-queries
+
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":      "1",
+		"DAYLIGHT_TOPIC":   "daylight",
+		"MAGPIE_LATITUDE":  "52.37",
+		"MAGPIE_LONGITUDE": "4.89",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		DayLightLoop(ctx, ch, config.Source("daylight"))
+	}()
+
+	for attempts := 0; attempts < 3; {
+		select {
+		case <-queries:
+			attempts++
+		case m := <-ch:
+			t.Fatalf("expected nothing to be published, got %+v", m)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected the loop to retry, got %d attempts", attempts)
+		}
+	}
+
+	cancel()
+	<-done
+
+	select {
+	case m := <-ch:
+		t.Fatalf("expected nothing to be published, got %+v", m)
+	default:
+	}
+}
+
+func TestFlagPayloadStyles(t *testing.T) {
+	d := fixedDayLight()
+	day := time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2026, 6, 21, 23, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		style string
+		day   string
+		night string
+	}{
+		{style: "yesno", day: "yes", night: "no"},
+		{style: "onoff", day: "ON", night: "OFF"},
+		{style: "truefalse", day: "true", night: "false"},
+	} {
+		if payload, err := FlagPayload(IsDayTime(day, d), c.style); err != nil || payload != c.day {
+			t.Errorf("expected `%s` by day in the %s style, got `%s` and %v", c.day, c.style, payload, err)
+		}
+
+		if payload, err := FlagPayload(IsDayTime(night, d), c.style); err != nil || payload != c.night {
+			t.Errorf("expected `%s` by night in the %s style, got `%s` and %v", c.night, c.style, payload, err)
+		}
+	}
+
+	if _, err := FlagPayload(true, "10"); err == nil {
+		t.Error("expected an unknown style to be refused")
+	}
+
+	if style := EnvDefault("DAYLIGHT_PAYLOAD_STYLE"); style != "yesno" {
+		t.Errorf("expected `yesno` by default, got `%s`", style)
+	}
+}
+
+func TestLightingWindowTransitions(t *testing.T) {
+	d := fixedDayLight()
+
+	for _, c := range []struct {
+		at       time.Time
+		lighting string
+	}{
+		{at: d.CivilTwilightBegin.Add(-time.Second), lighting: "night"},
+		{at: d.CivilTwilightBegin, lighting: "blue_hour"},
+		{at: d.Sunrise.Add(-time.Second), lighting: "blue_hour"},
+		{at: d.Sunrise, lighting: "golden_hour"},
+		{at: d.Sunrise.Add(time.Hour - time.Second), lighting: "golden_hour"},
+		{at: d.Sunrise.Add(time.Hour), lighting: "daylight"},
+		{at: d.Sunset.Add(-time.Hour - time.Second), lighting: "daylight"},
+		{at: d.Sunset.Add(-time.Hour), lighting: "golden_hour"},
+		{at: d.Sunset, lighting: "blue_hour"},
+		{at: d.CivilTwilightEnd.Add(-time.Second), lighting: "blue_hour"},
+		{at: d.CivilTwilightEnd, lighting: "night"},
+	} {
+		if lighting := LightingWindow(c.at, d); lighting != c.lighting {
+			t.Errorf("LightingWindow(%s) = %s, expected %s", c.at.Format(time.TimeOnly), lighting, c.lighting)
+		}
+	}
+}
@@ -1,40 +1,136 @@
 package magpie
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
 	"time"
 )
 
+var dayPhaseLog = NewLogger("dayphase")
+
+/* Offset of the wall-clock time of `t` since midnight. */
+func clockOffset(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+/* Map a time to one of four phases of the day: `night`, `morning`,
+ * `afternoon`, and `evening`. */
+func DayPhaseForTime(t time.Time) string {
+	if t.Hour() < 6 {
+		return "night"
+	} else if t.Hour() < 12 {
+		return "morning"
+	} else if t.Hour() < 18 {
+		return "afternoon"
+	} else {
+		return "evening"
+	}
+}
+
+/* Map a time to one of six phases of the day: `night`, `dawn`, `morning`,
+ * `afternoon`, `dusk`, and `evening`. Dawn is expected to fall before noon
+ * and dusk after it. */
+func DayPhaseSixForTime(t time.Time, dawn TimeWindow, dusk TimeWindow) string {
+	offset := clockOffset(t)
+
+	switch {
+	case dawn.Contains(t):
+		return "dawn"
+	case dusk.Contains(t):
+		return "dusk"
+	case offset < dawn.Start:
+		return "night"
+	case offset < 12*time.Hour:
+		return "morning"
+	case offset < dusk.Start:
+		return "afternoon"
+	default:
+		return "evening"
+	}
+}
+
+/* Parse a window from the environment, falling back to its default. */
+func timeWindowFromEnv(lookup func(string) (string, bool), name string) (TimeWindow, error) {
+	windowFromEnv, windowExists := lookup(name)
+
+	if !windowExists {
+		windowFromEnv = EnvDefault(name)
+	}
+
+	window, err := ParseTimeWindow(windowFromEnv)
+
+	if err != nil {
+		return window, fmt.Errorf("could not parse `%s='%s'`: %w", name, windowFromEnv, err)
+	}
+
+	return window, nil
+}
+
+/* The settings of the dayphase source. */
+type dayPhaseSettings struct {
+	format      string
+	granularity string
+	dawn        TimeWindow
+	dusk        TimeWindow
+}
+
+/* Read and check the settings of the dayphase source. */
+func dayPhaseSettingsFromConfig(cfg SourceConfig) (dayPhaseSettings, error) {
+	var err error
+
+	settings := dayPhaseSettings{format: cfg.Get("DAYPHASE_FORMAT"), granularity: cfg.Get("DAYPHASE_GRANULARITY")}
+
+	if settings.format != "" && settings.format != "plain" && settings.format != "influx" {
+		return settings, fmt.Errorf("could not use `DAYPHASE_FORMAT='%s'`, expected `plain` or `influx`", settings.format)
+	}
+
+	if settings.granularity != "" && settings.granularity != "4" && settings.granularity != "6" {
+		return settings, fmt.Errorf("could not use `DAYPHASE_GRANULARITY='%s'`, expected `4` or `6`", settings.granularity)
+	}
+
+	if settings.dawn, err = timeWindowFromEnv(cfg.Lookup, "DAYPHASE_DAWN"); err != nil {
+		return settings, err
+	}
+
+	if settings.dusk, err = timeWindowFromEnv(cfg.Lookup, "DAYPHASE_DUSK"); err != nil {
+		return settings, err
+	}
+
+	return settings, nil
+}
+
 /* A loop that waits between submitting the current phase of the day
  * to the topic defined in the environment as `DAYPHASE_TOPIC`. */
-func DayPhaseLoop(ch chan MqttCronMessage) {
-	topicFromEnv, topicExists := os.LookupEnv("DAYPHASE_TOPIC")
+func DayPhaseLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	settings, err := dayPhaseSettingsFromConfig(cfg)
 
-	if !topicExists {
-		log.Println("DayPhaseLoop needs `DAYPHASE_TOPIC` set in the environment, disabled.")
+	if err != nil {
+		dayPhaseLog.Warnf("DayPhaseLoop %s, disabled.\n", err)
 		return
 	}
 
-	log.Println("DayPhaseLoop enabled.")
+	dayPhaseLog.Println("DayPhaseLoop enabled.")
 
 	for {
 		var dayphase string
-		now := time.Now().UTC()
-
-		if now.Hour() < 6 {
-			dayphase = "night"
-		} else if now.Hour() < 12 {
-			dayphase = "morning"
-		} else if now.Month() < 18 {
-			dayphase = "afternoon"
+		now := cfg.Now().In(cfg.Location)
+
+		if settings.granularity == "6" {
+			dayphase = DayPhaseSixForTime(now, settings.dawn, settings.dusk)
 		} else {
-			dayphase = "evening"
+			dayphase = DayPhaseForTime(now)
 		}
 
-		ch <- MqttCronMessage{Retain: true, Topic: topicFromEnv, Payload: fmt.Sprintf("dayphase value=%s", dayphase)}
+		if settings.format == "influx" {
+			dayphase = fmt.Sprintf("dayphase value=%s", dayphase)
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: dayphase}) {
+			return
+		}
 
-		time.Sleep(1 * time.Minute)
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
 	}
 }
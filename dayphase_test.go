@@ -0,0 +1,93 @@
+package magpie
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/* Run a source loop with its clock frozen at `now` and return the first
+ * message it sends. */
+func firstMessageAt(t *testing.T, loop func(context.Context, chan MqttCronMessage, SourceConfig), cfg SourceConfig, now time.Time) MqttCronMessage {
+	t.Helper()
+
+	cfg.Clock = FrozenClock{Time: now}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		loop(ctx, ch, cfg)
+	}()
+
+	m := receive(t, ch)
+
+	cancel()
+	<-done
+
+	return m
+}
+
+func TestDayPhaseForTime(t *testing.T) {
+	for _, c := range []struct {
+		hour  int
+		phase string
+	}{
+		{hour: 2, phase: "night"},
+		{hour: 9, phase: "morning"},
+		{hour: 14, phase: "afternoon"},
+		{hour: 21, phase: "evening"},
+	} {
+		at := time.Date(2026, 3, 15, c.hour, 0, 0, 0, time.UTC)
+
+		if phase := DayPhaseForTime(at); phase != c.phase {
+			t.Errorf("DayPhaseForTime(%s) = %s, expected %s", at.Format("15:04"), phase, c.phase)
+		}
+	}
+}
+
+func TestDayPhaseSixForTimeTransitions(t *testing.T) {
+	dawn := TimeWindow{Start: 5 * time.Hour, End: 7 * time.Hour}
+	dusk := TimeWindow{Start: 18 * time.Hour, End: 20 * time.Hour}
+
+	for _, c := range []struct {
+		hour   int
+		minute int
+		phase  string
+	}{
+		{hour: 4, minute: 59, phase: "night"},
+		{hour: 5, minute: 0, phase: "dawn"},
+		{hour: 6, minute: 59, phase: "dawn"},
+		{hour: 7, minute: 0, phase: "morning"},
+		{hour: 11, minute: 59, phase: "morning"},
+		{hour: 12, minute: 0, phase: "afternoon"},
+		{hour: 17, minute: 59, phase: "afternoon"},
+		{hour: 18, minute: 0, phase: "dusk"},
+		{hour: 19, minute: 59, phase: "dusk"},
+		{hour: 20, minute: 0, phase: "evening"},
+		{hour: 23, minute: 59, phase: "evening"},
+		{hour: 0, minute: 0, phase: "night"},
+	} {
+		at := time.Date(2026, 1, 1, c.hour, c.minute, 0, 0, time.UTC)
+
+		if phase := DayPhaseSixForTime(at, dawn, dusk); phase != c.phase {
+			t.Errorf("DayPhaseSixForTime(%s) = %s, expected %s", at.Format("15:04"), phase, c.phase)
+		}
+	}
+}
+
+func TestDayPhaseLoopPublishesThePhaseOnly(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1", "DAYPHASE_TOPIC": "dayphase", "MAGPIE_TIMEZONE": "UTC"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := firstMessageAt(t, DayPhaseLoop, config.Source("dayphase"), time.Date(2026, 3, 15, 14, 0, 0, 0, time.UTC))
+
+	if m.Topic != "dayphase" || m.Payload != "afternoon" {
+		t.Fatalf("expected `afternoon` on `dayphase`, got %+v", m)
+	}
+}
@@ -0,0 +1,52 @@
+package magpie
+
+import "sync"
+
+/* Remembers the last payload of every retained topic so unchanged values are
+ * not published again, the broker already holds them. */
+type RetainedFilter struct {
+	mutex sync.Mutex
+	last  map[string]string
+}
+
+func NewRetainedFilter() *RetainedFilter {
+	return &RetainedFilter{last: make(map[string]string)}
+}
+
+/* Determine if a message has to be published, messages that are not
+ * retained always are. */
+func (f *RetainedFilter) Changed(m MqttCronMessage) bool {
+	if !m.Retain {
+		return true
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	last, exists := f.last[m.Topic]
+
+	return !exists || last != m.Payload
+}
+
+/* Remember the payload of a retained message once every sink published it,
+ * a failed publish is not recorded so the value is sent again. */
+func (f *RetainedFilter) Record(m MqttCronMessage) {
+	if !m.Retain {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.last[m.Topic] = m.Payload
+}
+
+/* Forget every payload so the next value of each retained topic is
+ * published again, done when a broker (re)connects as it may have lost
+ * them in between. */
+func (f *RetainedFilter) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.last = make(map[string]string)
+}
@@ -0,0 +1,85 @@
+package magpie
+
+import "testing"
+
+/* Fails every publish while `down` is set. */
+type flakySink struct {
+	MemorySink
+	down bool
+}
+
+func (s *flakySink) Publish(m MqttCronMessage) error {
+	if s.down {
+		return ErrBrokerOffline
+	}
+
+	return s.MemorySink.Publish(m)
+}
+
+/* Publish messages through `publishMessage` without a prefix. */
+func publishAll(sinks []Sink, retained *RetainedFilter, msgs ...MqttCronMessage) {
+	for _, m := range msgs {
+		publishMessage(m, sinks, "", nil, retained)
+	}
+}
+
+func TestRetainedFilterSkipsRepeatedValue(t *testing.T) {
+	sink := NewMemorySink()
+
+	publishAll([]Sink{sink}, NewRetainedFilter(),
+		MqttCronMessage{Topic: "season", Payload: "winter", Retain: true},
+		MqttCronMessage{Topic: "season", Payload: "winter", Retain: true},
+		MqttCronMessage{Topic: "season", Payload: "spring", Retain: true},
+		MqttCronMessage{Topic: "season", Payload: "spring", Retain: true},
+	)
+
+	messages := sink.Messages()
+
+	if len(messages) != 2 || messages[0].Payload != "winter" || messages[1].Payload != "spring" {
+		t.Fatalf("expected winter and spring once each, got %+v", messages)
+	}
+}
+
+func TestRetainedFilterPassesUnretained(t *testing.T) {
+	sink := NewMemorySink()
+
+	publishAll([]Sink{sink}, NewRetainedFilter(),
+		MqttCronMessage{Topic: "weather/wind", Payload: "3"},
+		MqttCronMessage{Topic: "weather/wind", Payload: "3"},
+	)
+
+	if got := len(sink.Messages()); got != 2 {
+		t.Fatalf("expected both unretained messages, got %d", got)
+	}
+}
+
+func TestRetainedFilterResendsAfterFailedPublish(t *testing.T) {
+	sink := &flakySink{down: true}
+	m := MqttCronMessage{Topic: "season", Payload: "winter", Retain: true}
+	retained := NewRetainedFilter()
+
+	publishAll([]Sink{sink}, retained, m)
+
+	sink.down = false
+
+	publishAll([]Sink{sink}, retained, m, m)
+
+	if got := len(sink.Messages()); got != 1 {
+		t.Fatalf("expected the value once after the broker came back, got %d", got)
+	}
+}
+
+func TestRetainedFilterChangedIsReadOnly(t *testing.T) {
+	retained := NewRetainedFilter()
+	m := MqttCronMessage{Topic: "season", Payload: "winter", Retain: true}
+
+	if !retained.Changed(m) || !retained.Changed(m) {
+		t.Fatal("expected an unrecorded value to stay changed")
+	}
+
+	retained.Record(m)
+
+	if retained.Changed(m) {
+		t.Fatal("expected a recorded value to be unchanged")
+	}
+}
@@ -0,0 +1,412 @@
+package magpie
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/* The device all discovered sensors belong to. */
+type DiscoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+/* Home Assistant MQTT discovery configuration of a single sensor. */
+type DiscoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueId          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	AvailabilityTopic string          `json:"availability_topic,omitempty"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	ValueTemplate     string          `json:"value_template,omitempty"`
+	Device            DiscoveryDevice `json:"device"`
+}
+
+/* A sensor a source publishes, `Metric` is the subtopic below the source's
+ * topic and empty for the topic itself. A sensor with a `Key` is that key
+ * of a JSON object on the topic itself instead. */
+type DiscoverySensor struct {
+	Metric      string
+	DeviceClass string
+	Unit        string
+	Key         string
+}
+
+/* The sensors as keys of a JSON object on the topic, named after their
+ * metric. */
+func jsonSensors(sensors []DiscoverySensor) []DiscoverySensor {
+	var keyed []DiscoverySensor
+
+	for _, sensor := range sensors {
+		sensor.Key = sensor.Metric
+		keyed = append(keyed, sensor)
+	}
+
+	return keyed
+}
+
+/* Build the discovery configuration of the sensors of `source` published
+ * below `topic`, `prefix` is the prefix of the topics of the source and
+ * `availability` the topic magpie announces itself on. */
+func discoveryConfigs(source string, topic string, prefix string, availability string, sensors []DiscoverySensor) []DiscoveryConfig {
+	var configs []DiscoveryConfig
+
+	device := DiscoveryDevice{Identifiers: []string{"magpie"}, Name: "magpie", Manufacturer: "petspalace"}
+
+	for _, sensor := range sensors {
+		var valueTemplate string
+
+		name := source
+		stateTopic := PrefixTopic(prefix, topic)
+
+		if sensor.Metric != "" {
+			name = fmt.Sprintf("%s %s", source, sensor.Metric)
+		}
+
+		if sensor.Key != "" {
+			valueTemplate = fmt.Sprintf("{{ value_json['%s'] }}", sensor.Key)
+		} else if sensor.Metric != "" {
+			stateTopic = PrefixTopic(prefix, buildTopic(topic, sensor.Metric))
+		}
+
+		configs = append(configs, DiscoveryConfig{
+			Name:              name,
+			UniqueId:          "magpie_" + strings.NewReplacer(" ", "_", ".", "_").Replace(name),
+			StateTopic:        stateTopic,
+			AvailabilityTopic: availability,
+			DeviceClass:       sensor.DeviceClass,
+			UnitOfMeasurement: sensor.Unit,
+			ValueTemplate:     valueTemplate,
+			Device:            device,
+		})
+	}
+
+	return configs
+}
+
+/* How the weather source lays out its topics. `Regions` each publish their
+ * stations below their own subtopic when there is more than one, `JSON`
+ * publishes the metrics of a station as a JSON object for
+ * `WEATHER_FORMAT=json`, and `SnowPerStation` is set for providers that
+ * forecast snow along with the station instead of on the topic itself. */
+type WeatherLayout struct {
+	Regions        []string
+	JSON           bool
+	SnowPerStation bool
+}
+
+/* Discovery configuration of the weather source laid out as `layout`,
+ * metrics are named after `names` and the wind speeds are in `windUnit`. */
+func WeatherDiscovery(topic string, prefix string, availability string, names MetricNames, windUnit string, layout WeatherLayout) []DiscoveryConfig {
+	var configs []DiscoveryConfig
+
+	stationSensors := []DiscoverySensor{
+		{Metric: names.Name("humidity"), DeviceClass: "humidity", Unit: "%"},
+		{Metric: names.Name("temperature.ground"), DeviceClass: "temperature", Unit: TemperatureSymbol()},
+		{Metric: names.Name("temperature.10cm"), DeviceClass: "temperature", Unit: TemperatureSymbol()},
+		{Metric: names.Name("temperature.water"), DeviceClass: "temperature", Unit: TemperatureSymbol()},
+		{Metric: names.Name("temperature.apparent"), DeviceClass: "temperature", Unit: TemperatureSymbol()},
+		{Metric: names.Name("wind"), DeviceClass: "wind_speed", Unit: windUnit},
+		{Metric: names.Name("gust"), DeviceClass: "wind_speed", Unit: windUnit},
+		{Metric: names.Name("gust.alert")},
+		{Metric: names.Name("wind.bft"), DeviceClass: "wind_speed", Unit: "Beaufort"},
+		{Metric: names.Name("wind.direction")},
+		{Metric: names.Name("wind.direction.degrees"), Unit: "°"},
+		{Metric: names.Name("pressure"), DeviceClass: "atmospheric_pressure", Unit: "hPa"},
+		{Metric: names.Name("pressure.trend")},
+		{Metric: names.Name("rain"), DeviceClass: "precipitation_intensity", Unit: "mm/h"},
+		{Metric: names.Name("sight"), DeviceClass: "distance", Unit: "m"},
+		{Metric: names.Name("sun"), DeviceClass: "irradiance", Unit: "W/m²"},
+		{Metric: names.Name("timestamp"), DeviceClass: "timestamp"},
+	}
+
+	snowSensors := []DiscoverySensor{
+		{Metric: names.Name("snowfall"), DeviceClass: "distance", Unit: "cm"},
+		{Metric: names.Name("snow.chance"), Unit: "%"},
+	}
+
+	if layout.SnowPerStation {
+		stationSensors = append(stationSensors, snowSensors...)
+		snowSensors = nil
+	}
+
+	if layout.JSON {
+		stationSensors = jsonSensors(stationSensors)
+	}
+
+	stationSensors = append(stationSensors, DiscoverySensor{Metric: names.Name("station_count")})
+
+	if len(layout.Regions) > 1 {
+		for _, region := range layout.Regions {
+			configs = append(configs, discoveryConfigs("weather "+region, buildTopic(topic, region), prefix, availability, stationSensors)...)
+		}
+	} else {
+		configs = append(configs, discoveryConfigs("weather", topic, prefix, availability, stationSensors)...)
+	}
+
+	return append(configs, discoveryConfigs("weather", topic, prefix, availability, snowSensors)...)
+}
+
+/* Discovery configuration of the calendar source. */
+func CalendarDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("calendar", topic, prefix, availability, []DiscoverySensor{
+		{Metric: "week"},
+		{Metric: "yearday"},
+		{Metric: "weekend"},
+		{Metric: "leapyear"},
+	})
+}
+
+/* Discovery configuration of the daylight source, as keys of the JSON
+ * object of `DAYLIGHT_FORMAT=json` when `json` is set. */
+func DayLightDiscovery(topic string, prefix string, availability string, json bool) []DiscoveryConfig {
+	if json {
+		return discoveryConfigs("daylight", topic, prefix, availability, jsonSensors([]DiscoverySensor{
+			{Metric: "is_day"},
+			{Metric: "phase"},
+			{Metric: "lighting"},
+			{Metric: "sunrise", DeviceClass: "timestamp"},
+			{Metric: "sunset", DeviceClass: "timestamp"},
+			{Metric: "solar_noon", DeviceClass: "timestamp"},
+			{Metric: "day_length", DeviceClass: "duration", Unit: "s"},
+			{Metric: "trend"},
+		}))
+	}
+
+	return discoveryConfigs("daylight", topic, prefix, availability, []DiscoverySensor{
+		{},
+		{Metric: "phase"},
+		{Metric: "lighting"},
+		{Metric: "sunrise", DeviceClass: "timestamp"},
+		{Metric: "sunset", DeviceClass: "timestamp"},
+		{Metric: "solar_noon", DeviceClass: "timestamp"},
+		{Metric: "day_length", DeviceClass: "duration", Unit: "s"},
+		{Metric: "trend"},
+	})
+}
+
+/* Discovery configuration of the air quality source. */
+func AirQualityDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("airquality", topic, prefix, availability, []DiscoverySensor{
+		{Metric: "aqi", DeviceClass: "aqi"},
+		{Metric: "category"},
+	})
+}
+
+/* Discovery configuration of the forecast source. */
+func ForecastDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("forecast", topic, prefix, availability, []DiscoverySensor{
+		{Metric: "temperature.min", DeviceClass: "temperature", Unit: TemperatureSymbol()},
+		{Metric: "temperature.max", DeviceClass: "temperature", Unit: TemperatureSymbol()},
+		{Metric: "precipitation_probability", Unit: "%"},
+	})
+}
+
+/* Discovery configuration of the heartbeat source. */
+func HeartbeatDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("heartbeat", topic, prefix, availability, []DiscoverySensor{
+		{DeviceClass: "timestamp"},
+		{Metric: "uptime", DeviceClass: "duration", Unit: "s"},
+	})
+}
+
+/* Discovery configuration of the public holiday source. */
+func HolidayDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("holiday", topic, prefix, availability, []DiscoverySensor{
+		{},
+		{Metric: "name"},
+	})
+}
+
+/* Discovery configuration of the pollen source. */
+func PollenDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	var sensors []DiscoverySensor
+
+	for _, allergen := range []string{"grass", "tree", "weed"} {
+		sensors = append(sensors, DiscoverySensor{Metric: allergen, Unit: "grains/m³"}, DiscoverySensor{Metric: allergen + ".category"})
+	}
+
+	return discoveryConfigs("pollen", topic, prefix, availability, sensors)
+}
+
+/* Discovery configuration of the electricity price source. */
+func PowerPriceDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("powerprice", topic, prefix, availability, []DiscoverySensor{
+		{Unit: "EUR/MWh"},
+	})
+}
+
+/* Discovery configuration of the fuel price source, stations that do not
+ * sell a fuel type leave its sensor unknown. */
+func FuelDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	var sensors []DiscoverySensor
+
+	for _, fuel := range fuelTypes {
+		sensors = append(sensors, DiscoverySensor{Metric: fuel, Unit: "EUR/L"})
+	}
+
+	return discoveryConfigs("fuel", topic, prefix, availability, sensors)
+}
+
+/* Discovery configuration of the exchange rate source, a sensor per
+ * currency in `symbols` expressed in `base`. */
+func FxDiscovery(topic string, prefix string, availability string, base string, symbols []string) []DiscoveryConfig {
+	var sensors []DiscoverySensor
+
+	for _, symbol := range symbols {
+		sensors = append(sensors, DiscoverySensor{Metric: symbol, Unit: fmt.Sprintf("%s/%s", symbol, base)})
+	}
+
+	sensors = append(sensors, DiscoverySensor{Metric: "date", DeviceClass: "date"})
+
+	return discoveryConfigs("fx", topic, prefix, availability, sensors)
+}
+
+/* Discovery configuration of the season source. */
+func SeasonDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("season", topic, prefix, availability, []DiscoverySensor{
+		{},
+		{Metric: "next", DeviceClass: "date"},
+		{Metric: "seconds_until", DeviceClass: "duration", Unit: "s"},
+	})
+}
+
+/* Discovery configuration of the snow source. */
+func SnowDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("snow", topic, prefix, availability, []DiscoverySensor{
+		{DeviceClass: "distance", Unit: "cm"},
+		{Metric: "snowing"},
+	})
+}
+
+/* Discovery configuration of the tide source. */
+func TideDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("tide", topic, prefix, availability, []DiscoverySensor{
+		{Metric: "next_high", DeviceClass: "timestamp"},
+		{Metric: "next_low", DeviceClass: "timestamp"},
+		{Metric: "trend"},
+	})
+}
+
+/* Discovery configuration of the earthquake source. */
+func QuakeDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("quake", topic, prefix, availability, []DiscoverySensor{
+		{Metric: "magnitude"},
+		{Metric: "place"},
+		{Metric: "time", DeviceClass: "timestamp"},
+	})
+}
+
+/* Discovery configuration of the weather warning source. */
+func WeatherWarningDiscovery(topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs("weatherwarning", topic, prefix, availability, []DiscoverySensor{
+		{},
+		{Metric: "description"},
+	})
+}
+
+/* Discovery configuration of the sources that publish a single value on
+ * their topic. */
+func ValueDiscovery(source string, topic string, prefix string, availability string) []DiscoveryConfig {
+	return discoveryConfigs(source, topic, prefix, availability, []DiscoverySensor{{}})
+}
+
+/* Collect the discovery configuration of every enabled source. */
+func Discovery(config Config) ([]DiscoveryConfig, error) {
+	var configs []DiscoveryConfig
+
+	availability := config.AvailabilityTopic
+
+	for _, source := range config.Sources {
+		if !source.Enabled {
+			continue
+		}
+
+		prefix := source.Prefix
+
+		switch source.Name {
+		case "airquality":
+			configs = append(configs, AirQualityDiscovery(source.Topic, prefix, availability)...)
+		case "calendar":
+			configs = append(configs, CalendarDiscovery(source.Topic, prefix, availability)...)
+		case "daylight":
+			settings, err := dayLightSettingsFromConfig(source)
+
+			if err != nil {
+				return nil, err
+			}
+
+			configs = append(configs, DayLightDiscovery(source.Topic, prefix, availability, settings.format == "json")...)
+		case "forecast":
+			configs = append(configs, ForecastDiscovery(source.Topic, prefix, availability)...)
+		case "fuel":
+			configs = append(configs, FuelDiscovery(source.Topic, prefix, availability)...)
+		case "fx":
+			base := strings.ToUpper(strings.TrimSpace(source.Get("FX_BASE")))
+			configs = append(configs, FxDiscovery(source.Topic, prefix, availability, base, ParseFxSymbols(source.Get("FX_SYMBOLS")))...)
+		case "heartbeat":
+			configs = append(configs, HeartbeatDiscovery(source.Topic, prefix, availability)...)
+		case "holiday":
+			configs = append(configs, HolidayDiscovery(source.Topic, prefix, availability)...)
+		case "pollen":
+			configs = append(configs, PollenDiscovery(source.Topic, prefix, availability)...)
+		case "powerprice":
+			configs = append(configs, PowerPriceDiscovery(source.Topic, prefix, availability)...)
+		case "season":
+			configs = append(configs, SeasonDiscovery(source.Topic, prefix, availability)...)
+		case "snow":
+			configs = append(configs, SnowDiscovery(source.Topic, prefix, availability)...)
+		case "quake":
+			configs = append(configs, QuakeDiscovery(source.Topic, prefix, availability)...)
+		case "tide":
+			configs = append(configs, TideDiscovery(source.Topic, prefix, availability)...)
+		case "weather":
+			settings, err := weatherSettingsFromConfig(source)
+
+			if err != nil {
+				return nil, err
+			}
+
+			layout := WeatherLayout{JSON: settings.format == "json", SnowPerStation: source.Get("WEATHER_PROVIDER") == "openmeteo"}
+
+			if !layout.SnowPerStation && source.Get("WEATHER_STATION_CODE") == "" {
+				layout.Regions = ParseWeatherRegions(source.Get("WEATHER_REGION"))
+			}
+
+			configs = append(configs, WeatherDiscovery(source.Topic, prefix, availability, settings.metricNames, WindUnits[settings.windUnit], layout)...)
+		case "weatherwarning":
+			configs = append(configs, WeatherWarningDiscovery(source.Topic, prefix, availability)...)
+		default:
+			configs = append(configs, ValueDiscovery(source.Name, source.Topic, prefix, availability)...)
+		}
+	}
+
+	return configs, nil
+}
+
+/* Turn discovery configuration into retained messages on
+ * `<discoveryPrefix>/sensor/<unique_id>/config`. */
+func DiscoveryMessages(configs []DiscoveryConfig, discoveryPrefix string) ([]MqttCronMessage, error) {
+	var msgs []MqttCronMessage
+
+	for _, config := range configs {
+		payload, err := json.Marshal(config)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not serialize the discovery of `%s`: %w", config.Name, err)
+		}
+
+		msgs = append(msgs, MqttCronMessage{
+			Topic:    fmt.Sprintf("%s/sensor/%s/config", discoveryPrefix, config.UniqueId),
+			Payload:  string(payload),
+			Retain:   true,
+			Critical: true,
+			Absolute: true,
+		})
+	}
+
+	return msgs, nil
+}
@@ -0,0 +1,113 @@
+package magpie
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+/* The discovery configuration by name. */
+func discoveryByName(configs []DiscoveryConfig) map[string]DiscoveryConfig {
+	byName := make(map[string]DiscoveryConfig)
+
+	for _, config := range configs {
+		byName[config.Name] = config
+	}
+
+	return byName
+}
+
+func TestWeatherDiscoveryPerRegion(t *testing.T) {
+	configs := discoveryByName(WeatherDiscovery("weather", "home", "home/magpie/status", MetricNames{}, "m/s", WeatherLayout{Regions: []string{"utrecht", "den-haag"}}))
+
+	if humidity := configs["weather utrecht humidity"]; humidity.StateTopic != "home/weather/utrecht/humidity" || humidity.UniqueId != "magpie_weather_utrecht_humidity" {
+		t.Errorf("expected the humidity of utrecht below its region, got %+v", humidity)
+	}
+
+	if count := configs["weather den-haag station_count"]; count.StateTopic != "home/weather/den-haag/station_count" {
+		t.Errorf("expected the station count of den-haag below its region, got %+v", count)
+	}
+
+	if snowfall := configs["weather snowfall"]; snowfall.StateTopic != "home/weather/snowfall" || snowfall.UnitOfMeasurement != "cm" {
+		t.Errorf("expected the national snowfall on the topic itself, got %+v", snowfall)
+	}
+
+	if _, exists := configs["weather humidity"]; exists {
+		t.Error("expected no humidity outside of the regions")
+	}
+}
+
+func TestWeatherDiscoveryJSON(t *testing.T) {
+	configs := discoveryByName(WeatherDiscovery("weather", "home", "", MetricNames{}, "m/s", WeatherLayout{JSON: true, SnowPerStation: true}))
+
+	temperature := configs["weather temperature.ground"]
+
+	if temperature.StateTopic != "home/weather" || temperature.ValueTemplate != "{{ value_json['temperature.ground'] }}" {
+		t.Errorf("expected the temperature out of the JSON object, got %+v", temperature)
+	}
+
+	if snowfall := configs["weather snowfall"]; snowfall.ValueTemplate != "{{ value_json['snowfall'] }}" {
+		t.Errorf("expected the snowfall out of the JSON object, got %+v", snowfall)
+	}
+
+	if count := configs["weather station_count"]; count.StateTopic != "home/weather/station_count" || count.ValueTemplate != "" {
+		t.Errorf("expected the station count on its own subtopic, got %+v", count)
+	}
+
+	payload, err := json.Marshal(temperature)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]any
+
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields["device_class"] != "temperature" || fields["value_template"] != "{{ value_json['temperature.ground'] }}" {
+		t.Errorf("expected the device class and value template in the JSON, got %s", payload)
+	}
+}
+
+func TestDayLightDiscovery(t *testing.T) {
+	plain := discoveryByName(DayLightDiscovery("daylight", "home", "", false))
+
+	if daylight := plain["daylight"]; daylight.StateTopic != "home/daylight" || daylight.ValueTemplate != "" {
+		t.Errorf("expected the flag on the topic itself, got %+v", daylight)
+	}
+
+	if sunrise := plain["daylight sunrise"]; sunrise.StateTopic != "home/daylight/sunrise" || sunrise.DeviceClass != "timestamp" {
+		t.Errorf("expected the sunrise on its subtopic, got %+v", sunrise)
+	}
+
+	keyed := discoveryByName(DayLightDiscovery("daylight", "home", "", true))
+
+	if sunrise := keyed["daylight sunrise"]; sunrise.StateTopic != "home/daylight" || sunrise.ValueTemplate != "{{ value_json['sunrise'] }}" {
+		t.Errorf("expected the sunrise out of the JSON object, got %+v", sunrise)
+	}
+}
+
+func TestDiscoveryFollowsWeatherSettings(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":    "1",
+		"MQTT_PREFIX":    "home",
+		"WEATHER_TOPIC":  "weather",
+		"WEATHER_REGION": "utrecht,den-haag",
+		"WEATHER_FORMAT": "json",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := Discovery(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if humidity := discoveryByName(configs)["weather utrecht humidity"]; humidity.StateTopic != "home/weather/utrecht" || humidity.ValueTemplate != "{{ value_json['humidity'] }}" {
+		t.Errorf("expected the humidity out of the JSON object of utrecht, got %+v", humidity)
+	}
+}
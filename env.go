@@ -0,0 +1,304 @@
+package magpie
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+/* Description of an environment variable magpie recognizes. Variables that
+ * belong to a source name it in `Source`, the values of secrets are never
+ * shown. */
+type EnvVar struct {
+	Name        string
+	Source      string
+	Default     string
+	Description string
+	Secret      bool
+}
+
+/* Every environment variable magpie recognizes. */
+var EnvVars = []EnvVar{
+	{Name: "MAGPIE_CONFIG", Description: "YAML file with settings, variables in the environment take precedence."},
+	{Name: "MQTT_HOST", Description: "MQTT broker to publish to, such as `tcp://127.0.0.1:1883`, several are separated by commas."},
+	{Name: "MQTT_HOSTS", Description: "Comma-separated MQTT brokers to publish to as well as `MQTT_HOST`."},
+	{Name: "MQTT_USERNAME", Description: "Username to authenticate with the MQTT broker."},
+	{Name: "MQTT_PASSWORD", Description: "Password to authenticate with the MQTT broker.", Secret: true},
+	{Name: "MQTT_CLIENT_ID", Description: "Client ID to connect with, defaults to `magpie-<hostname>`."},
+	{Name: "MQTT_AVAILABILITY_TOPIC", Description: "Topic announcing `online` or `offline`, defaults to `<prefix>/magpie/status`."},
+	{Name: "MQTT_RECONNECT_INTERVAL", Default: "1m", Description: "Longest wait between attempts to reconnect to the MQTT broker."},
+	{Name: "MQTT_QOS", Default: "0", Description: "Default quality of service for publishes, `0`, `1`, or `2`."},
+	{Name: "MQTT_QUEUE_SIZE", Default: "100", Description: "Messages queued for publishing while the broker is slow, `0` disables the queue."},
+	{Name: "MQTT_QUEUE_POLICY", Default: "block", Description: "What a full queue does with new messages, `block` the source or `drop-oldest`."},
+	{Name: "MQTT_RETAIN_DEFAULT", Description: "Whether every source retains its messages, overrides the source defaults."},
+	{Name: "MQTT_PREFIX", Default: "home.arpa", Description: "Prefix for all published topics, leading and trailing slashes are dropped."},
+	{Name: "SOCKET_PATH", Description: "Unix domain socket to write messages to as lines of JSON."},
+	{Name: "STDOUT_SINK", Description: "Set to `1` to also write messages to stdout as lines of JSON."},
+	{Name: "MAGPIE_DRY_RUN", Description: "Set to `1` to log messages instead of publishing them, without connecting to any sink."},
+	{Name: "MAGPIE_METRICS_ADDR", Description: "Address such as `:9090` to serve `/healthz` and Prometheus `/metrics` on."},
+	{Name: "MAGPIE_ERRORS_INTERVAL", Default: "5m", Description: "Time between publishes of the failed calls per source to `magpie/errors/<source>`."},
+	{Name: "MAGPIE_STALE_MULTIPLIER", Default: "3", Description: "Times its interval after which a source without updates is `yes` on `magpie/<source>/stale`, `0` switches the watchdog off."},
+	{Name: "STRICT_TOPICS", Description: "Set to `1` to refuse to start when source topics overlap."},
+	{Name: "QUIET_HOURS", Description: "Window in `HH:MM-HH:MM` during which only critical messages are published."},
+	{Name: "QUIET_HOURS_TIMEZONE", Description: "Timezone `QUIET_HOURS` is expressed in, overrides `MAGPIE_TIMEZONE`."},
+	{Name: "MAGPIE_ROUND_DECIMALS", Description: "Decimals to round numeric payloads to, such as `1`, numbers are published as they are when unset."},
+	{Name: "MAGPIE_TEMPERATURE_UNIT", Default: "c", Description: "Unit temperatures are published in, `c` for Celsius or `f` for Fahrenheit."},
+	{Name: "MAGPIE_TOPIC_STYLE", Default: "dotted", Description: "Either `dotted` metric subtopics such as `temperature.ground` or `nested` ones such as `temperature/ground`."},
+	{Name: "MAGPIE_TIMEZONE", Default: "UTC", Description: "Timezone for sources based on the time of day, such as `Europe/Amsterdam`."},
+	{Name: "BACKOFF_MAX", Default: "5m", Description: "Longest wait between retries."},
+	{Name: "MAGPIE_START_JITTER", Default: "10s", Description: "Longest random wait before the first update of a source, `0s` starts them all at once."},
+	{Name: "MAGPIE_PUBLISH_CONFIG", Description: "Set to `1` to publish the configuration summary to `magpie/config`."},
+	{Name: "MAGPIE_HTTP_TIMEOUT", Default: "10s", Description: "Timeout for every outbound API call."},
+	{Name: "MAGPIE_LOG_FORMAT", Default: "plain", Description: "Either `plain` text logs or one `json` object per line."},
+	{Name: "MAGPIE_LOG_LEVEL", Default: "info", Description: "Lowest level that is logged, `debug`, `info`, `warn`, or `error`."},
+	{Name: "MAGPIE_FORCE_REPUBLISH", Description: "Set to `1` to publish retained values again even when they did not change."},
+	{Name: "MAX_RUNTIME", Description: "Duration such as `30s` after which magpie shuts down."},
+	{Name: "HASS_DISCOVERY", Default: "false", Description: "Whether to publish Home Assistant discovery configuration for the enabled sources."},
+	{Name: "HASS_DISCOVERY_PREFIX", Default: "homeassistant", Description: "Topic prefix Home Assistant listens to for discovery."},
+	{Name: "MAGPIE_LATITUDE", Description: "Latitude used by sources that do not set their own."},
+	{Name: "MAGPIE_LONGITUDE", Description: "Longitude used by sources that do not set their own."},
+	{Name: "AIRQUALITY_TOPIC", Source: "airquality", Description: "Topic for the air quality source, enables it."},
+	{Name: "AIRQUALITY_ENABLED", Source: "airquality", Default: "true", Description: "Whether the air quality source runs once its topic is set, `false` switches it off."},
+	{Name: "AIRQUALITY_PREFIX", Source: "airquality", Description: "Prefix for the topics of the air quality source, overrides `MQTT_PREFIX`."},
+	{Name: "AIRQUALITY_ROUND_DECIMALS", Source: "airquality", Description: "Decimals to round the numbers of the air quality source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "AIRQUALITY_INTERVAL", Source: "airquality", Default: "1h", Description: "Time between updates of the airquality source."},
+	{Name: "AIRQUALITY_START_DELAY", Source: "airquality", Description: "Wait before the first update of the airquality source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "AIRQUALITY_LATITUDE", Source: "airquality", Description: "Latitude of the location for the air quality."},
+	{Name: "AIRQUALITY_LONGITUDE", Source: "airquality", Description: "Longitude of the location for the air quality."},
+	{Name: "AIRQUALITY_TOKEN", Source: "airquality", Description: "API token for `waqi.info`.", Secret: true},
+	{Name: "AIRQUALITY_RETAIN", Source: "airquality", Default: "false", Description: "Whether the airquality source retains its messages."},
+	{Name: "CALENDAR_TOPIC", Source: "calendar", Description: "Topic for the calendar source, enables it."},
+	{Name: "CALENDAR_ENABLED", Source: "calendar", Default: "true", Description: "Whether the calendar source runs once its topic is set, `false` switches it off."},
+	{Name: "CALENDAR_PREFIX", Source: "calendar", Description: "Prefix for the topics of the calendar source, overrides `MQTT_PREFIX`."},
+	{Name: "CALENDAR_ROUND_DECIMALS", Source: "calendar", Description: "Decimals to round the numbers of the calendar source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "CALENDAR_INTERVAL", Source: "calendar", Default: "5m", Description: "Time between updates of the calendar source."},
+	{Name: "CALENDAR_START_DELAY", Source: "calendar", Description: "Wait before the first update of the calendar source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "CALENDAR_TIMEZONE", Source: "calendar", Description: "Timezone for the calendar, overrides `MAGPIE_TIMEZONE`."},
+	{Name: "CALENDAR_RETAIN", Source: "calendar", Default: "true", Description: "Whether the calendar source retains its messages."},
+	{Name: "DAYLIGHT_TOPIC", Source: "daylight", Description: "Topic for the daylight source, enables it."},
+	{Name: "DAYLIGHT_ENABLED", Source: "daylight", Default: "true", Description: "Whether the daylight source runs once its topic is set, `false` switches it off."},
+	{Name: "DAYLIGHT_PREFIX", Source: "daylight", Description: "Prefix for the topics of the daylight source, overrides `MQTT_PREFIX`."},
+	{Name: "DAYLIGHT_ROUND_DECIMALS", Source: "daylight", Description: "Decimals to round the numbers of the daylight source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "DAYLIGHT_INTERVAL", Source: "daylight", Default: "5m", Description: "Time between updates of the daylight source."},
+	{Name: "DAYLIGHT_START_DELAY", Source: "daylight", Description: "Wait before the first update of the daylight source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "DAYLIGHT_LATITUDE", Source: "daylight", Description: "Latitude of the location for daylight."},
+	{Name: "DAYLIGHT_LONGITUDE", Source: "daylight", Description: "Longitude of the location for daylight."},
+	{Name: "DAYLIGHT_PAYLOAD_STYLE", Source: "daylight", Default: "yesno", Description: "Payload of the day flag, `yesno`, `onoff`, or `truefalse`."},
+	{Name: "DAYLIGHT_FORMAT", Source: "daylight", Default: "plain", Description: "Either `plain` subtopics or a single `json` document on the topic."},
+	{Name: "DAYLIGHT_TIMEZONE", Source: "daylight", Description: "Timezone whose midnight starts a new day for daylight, overrides `MAGPIE_TIMEZONE`."},
+	{Name: "DAYLIGHT_RETAIN", Source: "daylight", Default: "true", Description: "Whether the daylight source retains its messages."},
+	{Name: "DAYPHASE_TOPIC", Source: "dayphase", Description: "Topic for the dayphase source, enables it."},
+	{Name: "DAYPHASE_ENABLED", Source: "dayphase", Default: "true", Description: "Whether the dayphase source runs once its topic is set, `false` switches it off."},
+	{Name: "DAYPHASE_PREFIX", Source: "dayphase", Description: "Prefix for the topics of the dayphase source, overrides `MQTT_PREFIX`."},
+	{Name: "DAYPHASE_ROUND_DECIMALS", Source: "dayphase", Description: "Decimals to round the numbers of the dayphase source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "DAYPHASE_INTERVAL", Source: "dayphase", Default: "1m", Description: "Time between updates of the dayphase source."},
+	{Name: "DAYPHASE_START_DELAY", Source: "dayphase", Description: "Wait before the first update of the dayphase source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "DAYPHASE_FORMAT", Source: "dayphase", Default: "plain", Description: "Either the `plain` phase or the `influx` line `dayphase value=<phase>`."},
+	{Name: "DAYPHASE_GRANULARITY", Source: "dayphase", Default: "4", Description: "Either `4` phases, or `6` phases including dawn and dusk."},
+	{Name: "DAYPHASE_DAWN", Source: "dayphase", Default: "05:00-07:00", Description: "Window of dawn for `DAYPHASE_GRANULARITY=6`."},
+	{Name: "DAYPHASE_DUSK", Source: "dayphase", Default: "18:00-20:00", Description: "Window of dusk for `DAYPHASE_GRANULARITY=6`."},
+	{Name: "DAYPHASE_TIMEZONE", Source: "dayphase", Description: "Timezone for the dayphase, overrides `MAGPIE_TIMEZONE`."},
+	{Name: "DAYPHASE_RETAIN", Source: "dayphase", Default: "true", Description: "Whether the dayphase source retains its messages."},
+	{Name: "FORECAST_TOPIC", Source: "forecast", Description: "Topic for the forecast source, enables it."},
+	{Name: "FORECAST_ENABLED", Source: "forecast", Default: "true", Description: "Whether the forecast source runs once its topic is set, `false` switches it off."},
+	{Name: "FORECAST_PREFIX", Source: "forecast", Description: "Prefix for the topics of the forecast source, overrides `MQTT_PREFIX`."},
+	{Name: "FORECAST_ROUND_DECIMALS", Source: "forecast", Description: "Decimals to round the numbers of the forecast source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "FORECAST_INTERVAL", Source: "forecast", Default: "1h", Description: "Time between updates of the forecast source."},
+	{Name: "FORECAST_START_DELAY", Source: "forecast", Description: "Wait before the first update of the forecast source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "FORECAST_LATITUDE", Source: "forecast", Description: "Latitude of the location for the forecast."},
+	{Name: "FORECAST_LONGITUDE", Source: "forecast", Description: "Longitude of the location for the forecast."},
+	{Name: "FORECAST_RETAIN", Source: "forecast", Default: "true", Description: "Whether the forecast source retains its messages."},
+	{Name: "FX_TOPIC", Source: "fx", Description: "Topic for the exchange rate source, enables it."},
+	{Name: "FX_ENABLED", Source: "fx", Default: "true", Description: "Whether the exchange rate source runs once its topic is set, `false` switches it off."},
+	{Name: "FX_PREFIX", Source: "fx", Description: "Prefix for the topics of the exchange rate source, overrides `MQTT_PREFIX`."},
+	{Name: "FX_ROUND_DECIMALS", Source: "fx", Description: "Decimals to round the numbers of the exchange rate source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "FX_INTERVAL", Source: "fx", Default: "24h", Description: "Time between updates of the fx source."},
+	{Name: "FX_START_DELAY", Source: "fx", Description: "Wait before the first update of the fx source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "FX_BASE", Source: "fx", Default: "EUR", Description: "Currency the rates are expressed in, such as `EUR` or `USD`."},
+	{Name: "FX_SYMBOLS", Source: "fx", Description: "Comma-separated currencies to publish the rates of, such as `USD,GBP`."},
+	{Name: "FX_RETAIN", Source: "fx", Default: "true", Description: "Whether the fx source retains its messages."},
+	{Name: "FUEL_TOPIC", Source: "fuel", Description: "Topic for the fuel price source, enables it."},
+	{Name: "FUEL_ENABLED", Source: "fuel", Default: "true", Description: "Whether the fuel price source runs once its topic is set, `false` switches it off."},
+	{Name: "FUEL_PREFIX", Source: "fuel", Description: "Prefix for the topics of the fuel price source, overrides `MQTT_PREFIX`."},
+	{Name: "FUEL_ROUND_DECIMALS", Source: "fuel", Description: "Decimals to round the numbers of the fuel price source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "FUEL_INTERVAL", Source: "fuel", Default: "6h", Description: "Time between updates of the fuel source."},
+	{Name: "FUEL_START_DELAY", Source: "fuel", Description: "Wait before the first update of the fuel source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "FUEL_STATION", Source: "fuel", Description: "Tankerkönig id of the station to publish the fuel prices of."},
+	{Name: "FUEL_API_KEY", Source: "fuel", Description: "API key for `tankerkoenig.de`.", Secret: true},
+	{Name: "FUEL_RETAIN", Source: "fuel", Default: "true", Description: "Whether the fuel source retains its messages."},
+	{Name: "HEARTBEAT_TOPIC", Source: "heartbeat", Description: "Topic for the heartbeat source, enables it."},
+	{Name: "HEARTBEAT_ENABLED", Source: "heartbeat", Default: "true", Description: "Whether the heartbeat source runs once its topic is set, `false` switches it off."},
+	{Name: "HEARTBEAT_PREFIX", Source: "heartbeat", Description: "Prefix for the topics of the heartbeat source, overrides `MQTT_PREFIX`."},
+	{Name: "HEARTBEAT_ROUND_DECIMALS", Source: "heartbeat", Description: "Decimals to round the numbers of the heartbeat source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "HEARTBEAT_INTERVAL", Source: "heartbeat", Default: "60s", Description: "Time between updates of the heartbeat source."},
+	{Name: "HEARTBEAT_START_DELAY", Source: "heartbeat", Description: "Wait before the first update of the heartbeat source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "HEARTBEAT_UPTIME", Source: "heartbeat", Default: "false", Description: "Whether to also publish the uptime in seconds to `<topic>/uptime`."},
+	{Name: "HEARTBEAT_RETAIN", Source: "heartbeat", Default: "false", Description: "Whether the heartbeat source retains its messages."},
+	{Name: "HOLIDAY_TOPIC", Source: "holiday", Description: "Topic for the public holiday source, enables it."},
+	{Name: "HOLIDAY_ENABLED", Source: "holiday", Default: "true", Description: "Whether the public holiday source runs once its topic is set, `false` switches it off."},
+	{Name: "HOLIDAY_PREFIX", Source: "holiday", Description: "Prefix for the topics of the public holiday source, overrides `MQTT_PREFIX`."},
+	{Name: "HOLIDAY_ROUND_DECIMALS", Source: "holiday", Description: "Decimals to round the numbers of the public holiday source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "HOLIDAY_INTERVAL", Source: "holiday", Default: "1h", Description: "Time between updates of the holiday source."},
+	{Name: "HOLIDAY_START_DELAY", Source: "holiday", Description: "Wait before the first update of the holiday source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "HOLIDAY_COUNTRY", Source: "holiday", Description: "Two letter country code such as `NL` to follow the public holidays of."},
+	{Name: "HOLIDAY_TIMEZONE", Source: "holiday", Description: "Timezone whose midnight starts a new day for holidays, overrides `MAGPIE_TIMEZONE`."},
+	{Name: "HOLIDAY_RETAIN", Source: "holiday", Default: "true", Description: "Whether the holiday source retains its messages."},
+	{Name: "HTTPJSON_TOPIC", Source: "httpjson", Description: "Topic for the HTTP JSON source, enables it."},
+	{Name: "HTTPJSON_ENABLED", Source: "httpjson", Default: "true", Description: "Whether the HTTP JSON source runs once its topic is set, `false` switches it off."},
+	{Name: "HTTPJSON_PREFIX", Source: "httpjson", Description: "Prefix for the topics of the HTTP JSON source, overrides `MQTT_PREFIX`."},
+	{Name: "HTTPJSON_ROUND_DECIMALS", Source: "httpjson", Description: "Decimals to round the numbers of the HTTP JSON source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "HTTPJSON_INTERVAL", Source: "httpjson", Default: "5m", Description: "Time between updates of the httpjson source."},
+	{Name: "HTTPJSON_START_DELAY", Source: "httpjson", Description: "Wait before the first update of the httpjson source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "HTTPJSON_URL", Source: "httpjson", Description: "URL of the JSON document to fetch, may hold credentials.", Secret: true},
+	{Name: "HTTPJSON_PATH", Source: "httpjson", Description: "Path of the value to publish such as `current.values[0].temperature`."},
+	{Name: "HTTPJSON_RETAIN", Source: "httpjson", Default: "true", Description: "Whether the httpjson source retains its messages."},
+	{Name: "POLLEN_TOPIC", Source: "pollen", Description: "Topic for the pollen source, enables it."},
+	{Name: "POLLEN_ENABLED", Source: "pollen", Default: "true", Description: "Whether the pollen source runs once its topic is set, `false` switches it off."},
+	{Name: "POLLEN_PREFIX", Source: "pollen", Description: "Prefix for the topics of the pollen source, overrides `MQTT_PREFIX`."},
+	{Name: "POLLEN_ROUND_DECIMALS", Source: "pollen", Description: "Decimals to round the numbers of the pollen source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "POLLEN_INTERVAL", Source: "pollen", Default: "6h", Description: "Time between updates of the pollen source."},
+	{Name: "POLLEN_START_DELAY", Source: "pollen", Description: "Wait before the first update of the pollen source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "POLLEN_LATITUDE", Source: "pollen", Description: "Latitude of the location for pollen."},
+	{Name: "POLLEN_LONGITUDE", Source: "pollen", Description: "Longitude of the location for pollen."},
+	{Name: "POLLEN_RETAIN", Source: "pollen", Default: "true", Description: "Whether the pollen source retains its messages."},
+	{Name: "POWERPRICE_TOPIC", Source: "powerprice", Description: "Topic for the electricity price source, enables it."},
+	{Name: "POWERPRICE_ENABLED", Source: "powerprice", Default: "true", Description: "Whether the electricity price source runs once its topic is set, `false` switches it off."},
+	{Name: "POWERPRICE_PREFIX", Source: "powerprice", Description: "Prefix for the topics of the electricity price source, overrides `MQTT_PREFIX`."},
+	{Name: "POWERPRICE_ROUND_DECIMALS", Source: "powerprice", Description: "Decimals to round the numbers of the electricity price source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "POWERPRICE_INTERVAL", Source: "powerprice", Default: "5m", Description: "Time between updates of the powerprice source."},
+	{Name: "POWERPRICE_START_DELAY", Source: "powerprice", Description: "Wait before the first update of the powerprice source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "POWERPRICE_ZONE", Source: "powerprice", Default: "NL", Description: "Day-ahead bidding zone such as `NL`, `BE`, or `DE-LU`."},
+	{Name: "POWERPRICE_TIMEZONE", Source: "powerprice", Description: "Timezone whose days the hourly prices cover, overrides `MAGPIE_TIMEZONE`."},
+	{Name: "POWERPRICE_RETAIN", Source: "powerprice", Default: "true", Description: "Whether the powerprice source retains its messages."},
+	{Name: "QUAKE_TOPIC", Source: "quake", Description: "Topic for the earthquake source, enables it."},
+	{Name: "QUAKE_ENABLED", Source: "quake", Default: "true", Description: "Whether the earthquake source runs once its topic is set, `false` switches it off."},
+	{Name: "QUAKE_PREFIX", Source: "quake", Description: "Prefix for the topics of the earthquake source, overrides `MQTT_PREFIX`."},
+	{Name: "QUAKE_ROUND_DECIMALS", Source: "quake", Description: "Decimals to round the numbers of the earthquake source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "QUAKE_INTERVAL", Source: "quake", Default: "15m", Description: "Time between updates of the quake source."},
+	{Name: "QUAKE_START_DELAY", Source: "quake", Description: "Wait before the first update of the quake source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "QUAKE_RADIUS_KM", Source: "quake", Default: "500", Description: "Distance in kilometers from the location within which earthquakes are published."},
+	{Name: "QUAKE_MIN_MAGNITUDE", Source: "quake", Default: "2.5", Description: "Smallest magnitude of the earthquakes that are published."},
+	{Name: "QUAKE_LATITUDE", Source: "quake", Description: "Latitude of the location for earthquakes."},
+	{Name: "QUAKE_LONGITUDE", Source: "quake", Description: "Longitude of the location for earthquakes."},
+	{Name: "QUAKE_RETAIN", Source: "quake", Default: "true", Description: "Whether the quake source retains its messages."},
+	{Name: "SEASON_TOPIC", Source: "season", Description: "Topic for the season source, enables it."},
+	{Name: "SEASON_ENABLED", Source: "season", Default: "true", Description: "Whether the season source runs once its topic is set, `false` switches it off."},
+	{Name: "SEASON_PREFIX", Source: "season", Description: "Prefix for the topics of the season source, overrides `MQTT_PREFIX`."},
+	{Name: "SEASON_ROUND_DECIMALS", Source: "season", Description: "Decimals to round the numbers of the season source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "SEASON_INTERVAL", Source: "season", Default: "1h", Description: "Time between updates of the season source."},
+	{Name: "SEASON_START_DELAY", Source: "season", Description: "Wait before the first update of the season source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "SEASON_MODE", Source: "season", Default: "meteorological", Description: "Either `meteorological`, `astronomical`, or `custom`."},
+	{Name: "SEASON_BOUNDARIES", Source: "season", Description: "Start dates of the seasons as `MM-DD,MM-DD,MM-DD,MM-DD` for `SEASON_MODE=custom`."},
+	{Name: "SEASON_HEMISPHERE", Source: "season", Default: "north", Description: "Either `north` or `south`, the names of the seasons are swapped on the southern hemisphere."},
+	{Name: "SEASON_TIMEZONE", Source: "season", Description: "Timezone for the season, overrides `MAGPIE_TIMEZONE`."},
+	{Name: "SEASON_RETAIN", Source: "season", Default: "true", Description: "Whether the season source retains its messages."},
+	{Name: "SNOW_TOPIC", Source: "snow", Description: "Topic for the snow source, enables it."},
+	{Name: "SNOW_ENABLED", Source: "snow", Default: "true", Description: "Whether the snow source runs once its topic is set, `false` switches it off."},
+	{Name: "SNOW_PREFIX", Source: "snow", Description: "Prefix for the topics of the snow source, overrides `MQTT_PREFIX`."},
+	{Name: "SNOW_ROUND_DECIMALS", Source: "snow", Description: "Decimals to round the numbers of the snow source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "SNOW_INTERVAL", Source: "snow", Default: "1h", Description: "Time between updates of the snow source."},
+	{Name: "SNOW_START_DELAY", Source: "snow", Description: "Wait before the first update of the snow source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "SNOW_LATITUDE", Source: "snow", Description: "Latitude of the location for snow."},
+	{Name: "SNOW_LONGITUDE", Source: "snow", Description: "Longitude of the location for snow."},
+	{Name: "SNOW_RETAIN", Source: "snow", Default: "true", Description: "Whether the snow source retains its messages."},
+	{Name: "TIDE_TOPIC", Source: "tide", Description: "Topic for the tide source, enables it."},
+	{Name: "TIDE_ENABLED", Source: "tide", Default: "true", Description: "Whether the tide source runs once its topic is set, `false` switches it off."},
+	{Name: "TIDE_PREFIX", Source: "tide", Description: "Prefix for the topics of the tide source, overrides `MQTT_PREFIX`."},
+	{Name: "TIDE_ROUND_DECIMALS", Source: "tide", Description: "Decimals to round the numbers of the tide source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "TIDE_INTERVAL", Source: "tide", Default: "15m", Description: "Time between updates of the tide source."},
+	{Name: "TIDE_START_DELAY", Source: "tide", Description: "Wait before the first update of the tide source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "TIDE_STATION", Source: "tide", Description: "NOAA CO-OPS station id such as `9414290` to predict the tides of."},
+	{Name: "TIDE_RETAIN", Source: "tide", Default: "true", Description: "Whether the tide source retains its messages."},
+	{Name: "UVINDEX_TOPIC", Source: "uvindex", Description: "Topic for the UV index source, enables it."},
+	{Name: "UVINDEX_ENABLED", Source: "uvindex", Default: "true", Description: "Whether the UV index source runs once its topic is set, `false` switches it off."},
+	{Name: "UVINDEX_PREFIX", Source: "uvindex", Description: "Prefix for the topics of the UV index source, overrides `MQTT_PREFIX`."},
+	{Name: "UVINDEX_ROUND_DECIMALS", Source: "uvindex", Description: "Decimals to round the numbers of the UV index source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "UVINDEX_INTERVAL", Source: "uvindex", Default: "30m", Description: "Time between updates of the uvindex source."},
+	{Name: "UVINDEX_START_DELAY", Source: "uvindex", Description: "Wait before the first update of the uvindex source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "UVINDEX_LATITUDE", Source: "uvindex", Description: "Latitude of the location for the UV index."},
+	{Name: "UVINDEX_LONGITUDE", Source: "uvindex", Description: "Longitude of the location for the UV index."},
+	{Name: "UVINDEX_RETAIN", Source: "uvindex", Default: "false", Description: "Whether the uvindex source retains its messages."},
+	{Name: "WEATHER_TOPIC", Source: "weather", Description: "Topic for the weather source, enables it."},
+	{Name: "WEATHER_ENABLED", Source: "weather", Default: "true", Description: "Whether the weather source runs once its topic is set, `false` switches it off."},
+	{Name: "WEATHER_PREFIX", Source: "weather", Description: "Prefix for the topics of the weather source, overrides `MQTT_PREFIX`."},
+	{Name: "WEATHER_ROUND_DECIMALS", Source: "weather", Description: "Decimals to round the numbers of the weather source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "WEATHER_INTERVAL", Source: "weather", Default: "5m", Description: "Time between updates of the weather source."},
+	{Name: "WEATHER_START_DELAY", Source: "weather", Description: "Wait before the first update of the weather source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "WEATHER_PROVIDER", Source: "weather", Default: "buienradar", Description: "Either `buienradar` for Dutch stations or `openmeteo` for the coordinates anywhere."},
+	{Name: "WEATHER_LATITUDE", Source: "weather", Description: "Latitude of the location for `WEATHER_PROVIDER=openmeteo`."},
+	{Name: "WEATHER_LONGITUDE", Source: "weather", Description: "Longitude of the location for `WEATHER_PROVIDER=openmeteo`."},
+	{Name: "WEATHER_REGION", Source: "weather", Description: "Lowercased and dashed `buienradar.nl` regions, such as `den-haag,utrecht`."},
+	{Name: "WEATHER_STATION_CODE", Source: "weather", Description: "Exact `buienradar.nl` station code such as `6344`, overrides `WEATHER_REGION`."},
+	{Name: "WEATHER_METRIC_NAMES", Source: "weather", Description: "Renamed metric subtopics as `metric=name,metric=name`."},
+	{Name: "WEATHER_WIND_ARROW", Source: "weather", Default: "false", Description: "Whether to publish the wind direction as an arrow."},
+	{Name: "WEATHER_WIND_UNIT", Source: "weather", Default: "ms", Description: "Unit of the wind and gust speed, `ms`, `kmh`, or `bft` for the Beaufort scale."},
+	{Name: "WEATHER_WIND_BEAUFORT", Source: "weather", Default: "false", Description: "Whether to also publish the Beaufort number of the wind."},
+	{Name: "WEATHER_GUST_THRESHOLD", Source: "weather", Description: "Gust speed in m/s above which `gust.alert` is `yes`, publishes it when set."},
+	{Name: "WEATHER_FORMAT", Source: "weather", Default: "plain", Description: "Either `plain` subtopics per metric or a single `json` object on the topic."},
+	{Name: "WEATHER_DEDUP", Source: "weather", Default: "false", Description: "Whether to skip stations whose measurement did not change since the last update."},
+	{Name: "WEATHER_PRESSURE_THRESHOLD", Source: "weather", Default: "1", Description: "Change in hPa over the last readings above which the pressure is `rising` or `falling`."},
+	{Name: "WEATHER_FEED_URL", Source: "weather", Default: "https://data.buienradar.nl/1.0/feed/xml", Description: "URL of the `buienradar.nl` XML feed, such as a mirror."},
+	{Name: "WEATHER_RETAIN", Source: "weather", Default: "false", Description: "Whether the weather source retains its messages."},
+	{Name: "WEATHERWARNING_TOPIC", Source: "weatherwarning", Description: "Topic for the weather warning source, enables it."},
+	{Name: "WEATHERWARNING_ENABLED", Source: "weatherwarning", Default: "true", Description: "Whether the weather warning source runs once its topic is set, `false` switches it off."},
+	{Name: "WEATHERWARNING_PREFIX", Source: "weatherwarning", Description: "Prefix for the topics of the weather warning source, overrides `MQTT_PREFIX`."},
+	{Name: "WEATHERWARNING_ROUND_DECIMALS", Source: "weatherwarning", Description: "Decimals to round the numbers of the weather warning source to, overrides `MAGPIE_ROUND_DECIMALS`."},
+	{Name: "WEATHERWARNING_INTERVAL", Source: "weatherwarning", Default: "15m", Description: "Time between updates of the weatherwarning source."},
+	{Name: "WEATHERWARNING_START_DELAY", Source: "weatherwarning", Description: "Wait before the first update of the weatherwarning source, replaces the random `MAGPIE_START_JITTER`."},
+	{Name: "WEATHERWARNING_REGION", Source: "weatherwarning", Description: "Dutch province to follow the KNMI warnings of, such as `Noord-Holland`."},
+	{Name: "WEATHERWARNING_RETAIN", Source: "weatherwarning", Default: "true", Description: "Whether the weatherwarning source retains its messages."},
+}
+
+/* Look up the default of a recognized environment variable. */
+func EnvDefault(name string) string {
+	for _, v := range EnvVars {
+		if v.Name == name {
+			return v.Default
+		}
+	}
+
+	return ""
+}
+
+/* Determine if a variable is recognized. */
+func EnvKnown(name string) bool {
+	for _, v := range EnvVars {
+		if v.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+/* Parse a duration through `lookup`, falling back to its default. */
+func DurationFromEnv(lookup func(string) (string, bool), name string) (time.Duration, error) {
+	durationFromEnv, durationExists := lookup(name)
+
+	if !durationExists {
+		durationFromEnv = EnvDefault(name)
+	}
+
+	duration, err := time.ParseDuration(durationFromEnv)
+
+	if err != nil {
+		return 0, fmt.Errorf("could not parse `%s='%s'` as duration", name, durationFromEnv)
+	}
+
+	return duration, nil
+}
+
+/* Write a table of every recognized environment variable, its default,
+ * and its description. */
+func WriteEnv(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tDEFAULT\tDESCRIPTION")
+
+	for _, v := range EnvVars {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Name, v.Default, v.Description)
+	}
+
+	return tw.Flush()
+}
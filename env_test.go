@@ -0,0 +1,38 @@
+package magpie
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteEnvListsEveryVariable(t *testing.T) {
+	var buffer bytes.Buffer
+
+	if err := WriteEnv(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+
+	if len(lines) != len(EnvVars)+1 {
+		t.Fatalf("expected a header and %d variables, got %d lines", len(EnvVars), len(lines))
+	}
+
+	if fields := strings.Fields(lines[0]); !slices.Equal(fields, []string{"NAME", "DEFAULT", "DESCRIPTION"}) {
+		t.Fatalf("expected a header, got %q", lines[0])
+	}
+
+	for idx, v := range EnvVars {
+		line := lines[idx+1]
+
+		if !strings.HasPrefix(line, v.Name+" ") || !strings.Contains(line, v.Description) {
+			t.Errorf("expected `%s` with its description, got %q", v.Name, line)
+		}
+
+		if v.Default != "" && !strings.Contains(line, " "+v.Default+" ") {
+			t.Errorf("expected `%s` with its default `%s`, got %q", v.Name, v.Default, line)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var forecastLog = NewLogger("forecast")
+
+/* Hourly forecast from the `open-meteo.com` forecast API, values at the
+ * same index belong to the same hour and are null when unknown. */
+type ForecastAPIHourly struct {
+	Time                     []string   `json:"time"`
+	Temperature              []*float64 `json:"temperature_2m"`
+	PrecipitationProbability []*float64 `json:"precipitation_probability"`
+}
+
+/* Result from the `open-meteo.com` forecast API. */
+type ForecastAPIResult struct {
+	Error  bool              `json:"error"`
+	Reason string            `json:"reason"`
+	Hourly ForecastAPIHourly `json:"hourly"`
+}
+
+/* The lowest and highest temperature in °C and the highest chance of
+ * precipitation in percent over the forecasted hours, the chance is nil
+ * when none of the hours has one. */
+type Forecast struct {
+	TemperatureMin           float64
+	TemperatureMax           float64
+	PrecipitationProbability *float64
+}
+
+/* Find the lowest and highest of the values that are present, reports
+ * false when none are. */
+func forecastRange(values []*float64) (float64, float64, bool) {
+	var low, high float64
+	var present bool
+
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+
+		if !present || *value < low {
+			low = *value
+		}
+
+		if !present || *value > high {
+			high = *value
+		}
+
+		present = true
+	}
+
+	return low, high, present
+}
+
+/* Parse a response of the `open-meteo.com` forecast API into the forecast
+ * over all hours in it. */
+func ParseForecast(body []byte) (Forecast, error) {
+	var apiResult ForecastAPIResult
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return Forecast{}, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if apiResult.Error {
+		return Forecast{}, fmt.Errorf("the response was an error: %s", apiResult.Reason)
+	}
+
+	var forecast Forecast
+	var present bool
+
+	if forecast.TemperatureMin, forecast.TemperatureMax, present = forecastRange(apiResult.Hourly.Temperature); !present {
+		return Forecast{}, errors.New("the response has no temperatures")
+	}
+
+	if _, probability, present := forecastRange(apiResult.Hourly.PrecipitationProbability); present {
+		forecast.PrecipitationProbability = &probability
+	}
+
+	return forecast, nil
+}
+
+/* Call the `open-meteo.com` forecast API and return the forecast. */
+func ForecastAPICall(ctx context.Context, apiUrl string) (Forecast, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return Forecast{}, err
+	}
+
+	return ParseForecast(body)
+}
+
+/* A loop that waits between calls to the `open-meteo.com` forecast API and
+ * submits the lowest and highest temperature and the highest chance of
+ * precipitation over the next 24 hours to subtopics of the topic given in
+ * the environment variable `FORECAST_TOPIC`, the chance is left out when the
+ * API has none. */
+func ForecastLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	if errors.Is(cfg.CoordinatesErr, ErrCoordinatesMissing) {
+		forecastLog.Println("ForecastLoop needs `FORECAST_LATITUDE` and `FORECAST_LONGITUDE`, or `MAGPIE_LATITUDE` and `MAGPIE_LONGITUDE`, set in the environment, disabled.")
+		return
+	}
+
+	if cfg.CoordinatesErr != nil {
+		forecastLog.Warnf("ForecastLoop could not use its coordinates: %s, disabled.\n", cfg.CoordinatesErr)
+		return
+	}
+
+	forecastLog.Println("ForecastLoop enabled.")
+
+	apiUrl := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%f&longitude=%f&hourly=temperature_2m,precipitation_probability&forecast_hours=24", cfg.Coordinates.Latitude, cfg.Coordinates.Longitude)
+
+	for {
+		var forecast Forecast
+
+		if !fetchWithRetry(ctx, cfg, forecastLog, "ForecastLoop could not fetch the forecast", func() error {
+			var err error
+
+			forecast, err = ForecastAPICall(ctx, apiUrl)
+
+			return err
+		}) {
+			return
+		}
+
+		metrics := []Metric{
+			{Name: "temperature.min", Value: strconv.FormatFloat(forecast.TemperatureMin, 'f', -1, 64)},
+			{Name: "temperature.max", Value: strconv.FormatFloat(forecast.TemperatureMax, 'f', -1, 64)},
+		}
+
+		if forecast.PrecipitationProbability != nil {
+			metrics = append(metrics, Metric{Name: "precipitation_probability", Value: strconv.FormatFloat(*forecast.PrecipitationProbability, 'f', -1, 64)})
+		}
+
+		metrics = ConvertTemperatureMetrics(metrics)
+
+		for _, metric := range metrics {
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, metric.Name), Payload: metric.Value}) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package magpie
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseForecast(t *testing.T) {
+	body, err := os.ReadFile("testdata/forecast.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forecast, err := ParseForecast(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if forecast.TemperatureMin != 12.8 || forecast.TemperatureMax != 14.6 {
+		t.Fatalf("expected 12.8 to 14.6, got %f to %f", forecast.TemperatureMin, forecast.TemperatureMax)
+	}
+
+	if forecast.PrecipitationProbability == nil || *forecast.PrecipitationProbability != 60 {
+		t.Fatalf("expected a precipitation probability of 60, got %v", forecast.PrecipitationProbability)
+	}
+}
+
+func TestParseForecastWithoutPrecipitationProbability(t *testing.T) {
+	forecast, err := ParseForecast([]byte(`{"hourly": {"time": ["2026-10-16T12:00", "2026-10-16T13:00"], "temperature_2m": [12.8, 13.1], "precipitation_probability": [null, null]}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if forecast.PrecipitationProbability != nil {
+		t.Fatalf("expected no precipitation probability, got %f", *forecast.PrecipitationProbability)
+	}
+}
+
+func TestParseForecastRefusesResponsesWithoutTemperatures(t *testing.T) {
+	for _, c := range []struct {
+		body string
+		err  string
+	}{
+		{body: `{"error": true, "reason": "Cannot initialize WeatherVariable from invalid String value"}`, err: "invalid String value"},
+		{body: `{"hourly": {"time": ["2026-10-16T12:00"], "temperature_2m": [null], "precipitation_probability": [10]}}`, err: "no temperatures"},
+		{body: `{"hourly": []}`, err: "could not parse"},
+	} {
+		if _, err := ParseForecast([]byte(c.body)); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected an error about %s, got %v", c.err, err)
+		}
+	}
+}
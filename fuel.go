@@ -0,0 +1,148 @@
+package magpie
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+var fuelLog = NewLogger("fuel")
+
+/* The fuel types of the Tankerkönig API in the order they are published. */
+var fuelTypes = []string{"e5", "e10", "diesel"}
+
+/* Price of a fuel type in EUR per liter, the API reports `false` instead of
+ * a price for fuel types a station does not sell. */
+type FuelAPIPrice struct {
+	Value    float64
+	Reported bool
+}
+
+func (p *FuelAPIPrice) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("false")) || bytes.Equal(data, []byte("null")) {
+		*p = FuelAPIPrice{}
+		return nil
+	}
+
+	if err := json.Unmarshal(data, &p.Value); err != nil {
+		return err
+	}
+
+	p.Reported = true
+
+	return nil
+}
+
+/* Prices of a single station, `Status` is one of `open`, `closed`, or
+ * `no prices`. */
+type FuelAPIStation struct {
+	Status string       `json:"status"`
+	E5     FuelAPIPrice `json:"e5"`
+	E10    FuelAPIPrice `json:"e10"`
+	Diesel FuelAPIPrice `json:"diesel"`
+}
+
+/* Result from the prices endpoint of the Tankerkönig API keyed by station
+ * id, `Message` explains why the call was not `Ok`. */
+type FuelAPIResult struct {
+	Ok      bool                      `json:"ok"`
+	Message string                    `json:"message"`
+	Prices  map[string]FuelAPIStation `json:"prices"`
+}
+
+/* Parse the prices of `station` from a response of the Tankerkönig API,
+ * keyed by fuel type. Fuel types the station does not report are left
+ * out. */
+func ParseFuelPrices(body []byte, station string) (map[string]float64, error) {
+	var apiResult FuelAPIResult
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return nil, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if !apiResult.Ok {
+		return nil, fmt.Errorf("the API refused the call: %s", apiResult.Message)
+	}
+
+	stationResult, stationExists := apiResult.Prices[station]
+
+	if !stationExists {
+		return nil, fmt.Errorf("could not find station `%s` in the response", station)
+	}
+
+	prices := make(map[string]float64)
+
+	for fuel, price := range map[string]FuelAPIPrice{
+		"e5":     stationResult.E5,
+		"e10":    stationResult.E10,
+		"diesel": stationResult.Diesel,
+	} {
+		if price.Reported {
+			prices[fuel] = price.Value
+		}
+	}
+
+	return prices, nil
+}
+
+/* Call the Tankerkönig API and return the prices of `station`. */
+func FuelAPICall(ctx context.Context, apiUrl string, station string) (map[string]float64, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFuelPrices(body, station)
+}
+
+/* A loop that waits between calls to the Tankerkönig API and submits the
+ * price of every fuel type the station in the environment variable
+ * `FUEL_STATION` reports to `<topic>/<fuel>` of the topic given in
+ * `FUEL_TOPIC`. */
+func FuelLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	keyFromEnv, keyExists := cfg.Lookup("FUEL_API_KEY")
+	stationFromEnv, stationExists := cfg.Lookup("FUEL_STATION")
+
+	if !keyExists || !stationExists {
+		fuelLog.Println("FuelLoop needs `FUEL_API_KEY` and `FUEL_STATION` set in the environment, disabled.")
+		return
+	}
+
+	fuelLog.Println("FuelLoop enabled.")
+
+	apiUrl := fmt.Sprintf("https://creativecommons.tankerkoenig.de/json/prices.php?ids=%s&apikey=%s", url.QueryEscape(stationFromEnv), url.QueryEscape(keyFromEnv))
+
+	for {
+		var prices map[string]float64
+
+		if !fetchWithRetry(ctx, cfg, fuelLog, "FuelLoop could not fetch the fuel prices", func() error {
+			var err error
+
+			prices, err = FuelAPICall(ctx, apiUrl, stationFromEnv)
+
+			return err
+		}) {
+			return
+		}
+
+		for _, fuel := range fuelTypes {
+			price, reported := prices[fuel]
+
+			if !reported {
+				continue
+			}
+
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, fuel), Payload: strconv.FormatFloat(price, 'f', -1, 64)}) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
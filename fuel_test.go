@@ -0,0 +1,57 @@
+package magpie
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFuelPrices(t *testing.T) {
+	body, err := os.ReadFile("testdata/fuel.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		station string
+		prices  map[string]float64
+	}{
+		{station: "474e5046-deaf-4f9b-9a32-9797b778f047", prices: map[string]float64{"e5": 1.789, "e10": 1.729, "diesel": 1.659}},
+		{station: "4429a7d9-fb2d-4c29-8cfe-2ca90323f9f8", prices: map[string]float64{"e5": 1.809, "diesel": 1.689}},
+		{station: "278130b1-e062-4a0f-80cc-19e486b4c024", prices: map[string]float64{}},
+	} {
+		prices, err := ParseFuelPrices(body, c.station)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(prices, c.prices) {
+			t.Errorf("ParseFuelPrices(%s) = %v, expected %v", c.station, prices, c.prices)
+		}
+	}
+}
+
+func TestParseFuelPricesRefusesFailedCalls(t *testing.T) {
+	body, err := os.ReadFile("testdata/fuel.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		body    []byte
+		station string
+		err     string
+	}{
+		{body: body, station: "unknown", err: "station `unknown`"},
+		{body: []byte(`{"ok": false, "message": "apikey nicht angegeben, falsch, oder im falschen Format"}`), station: "474e5046-deaf-4f9b-9a32-9797b778f047", err: "apikey nicht angegeben"},
+		{body: []byte(`{"ok": true, "prices": {"474e5046-deaf-4f9b-9a32-9797b778f047": {"e5": "cheap"}}}`), station: "474e5046-deaf-4f9b-9a32-9797b778f047", err: "could not parse"},
+	} {
+		if _, err := ParseFuelPrices(c.body, c.station); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected an error about %s, got %v", c.err, err)
+		}
+	}
+}
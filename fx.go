@@ -0,0 +1,166 @@
+package magpie
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var fxLog = NewLogger("fx")
+
+/* The daily euro foreign exchange reference rates of the ECB. */
+const fxFeedUrl = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+/* A single rate as units of `Currency` per euro. */
+type FxAPIRate struct {
+	Currency string `xml:"currency,attr"`
+	Rate     string `xml:"rate,attr"`
+}
+
+/* The rates of the working day in `Time` as `YYYY-MM-DD`. */
+type FxAPIDay struct {
+	Time  string      `xml:"time,attr"`
+	Rates []FxAPIRate `xml:"Cube"`
+}
+
+type FxAPIResult struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Day     FxAPIDay `xml:"Cube>Cube"`
+}
+
+/* Parse the ECB feed into the date of its rates and the rate of every
+ * currency per euro, the euro itself included. */
+func ParseFxRates(body []byte) (string, map[string]float64, error) {
+	var apiResult FxAPIResult
+
+	if err := xml.Unmarshal(body, &apiResult); err != nil {
+		return "", nil, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if apiResult.Day.Time == "" || len(apiResult.Day.Rates) == 0 {
+		return "", nil, errors.New("could not find any rates in the response")
+	}
+
+	rates := map[string]float64{"EUR": 1}
+
+	for _, rate := range apiResult.Day.Rates {
+		value, err := strconv.ParseFloat(rate.Rate, 64)
+
+		if err != nil || value <= 0 {
+			return "", nil, fmt.Errorf("could not parse `%s` as rate of `%s`", rate.Rate, rate.Currency)
+		}
+
+		rates[rate.Currency] = value
+	}
+
+	return apiResult.Day.Time, rates, nil
+}
+
+/* Split a comma-separated list of currencies such as `usd, gbp` into
+ * uppercased codes. */
+func ParseFxSymbols(value string) []string {
+	var symbols []string
+
+	for _, symbol := range strings.Split(value, ",") {
+		if symbol = strings.ToUpper(strings.TrimSpace(symbol)); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	return symbols
+}
+
+/* Convert rates per euro into rates per `base` for every currency in
+ * `symbols`, rounded to 6 decimals. */
+func FxCrossRates(rates map[string]float64, base string, symbols []string) (map[string]float64, error) {
+	baseRate, baseExists := rates[base]
+
+	if !baseExists {
+		return nil, fmt.Errorf("could not find a rate of `%s`", base)
+	}
+
+	crossRates := make(map[string]float64)
+
+	for _, symbol := range symbols {
+		rate, rateExists := rates[symbol]
+
+		if !rateExists {
+			return nil, fmt.Errorf("could not find a rate of `%s`", symbol)
+		}
+
+		crossRates[symbol] = math.Round(rate/baseRate*1e6) / 1e6
+	}
+
+	return crossRates, nil
+}
+
+/* Call the ECB feed and return the date and rates per euro. */
+func FxAPICall(ctx context.Context, apiUrl string) (string, map[string]float64, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return ParseFxRates(body)
+}
+
+/* A loop that waits between calls to the ECB feed and submits the rate of
+ * every currency in the environment variable `FX_SYMBOLS` in units per
+ * `FX_BASE` to `<topic>/<symbol>` of the topic given in `FX_TOPIC`. Rates
+ * are only submitted when the ECB published a new day, there are none on
+ * weekends and holidays. */
+func FxLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	base := strings.ToUpper(strings.TrimSpace(cfg.Get("FX_BASE")))
+	symbols := ParseFxSymbols(cfg.Get("FX_SYMBOLS"))
+
+	if len(symbols) == 0 {
+		fxLog.Println("FxLoop needs `FX_SYMBOLS` set in the environment, disabled.")
+		return
+	}
+
+	fxLog.Println("FxLoop enabled.")
+
+	var published string
+
+	for {
+		var date string
+		var rates map[string]float64
+
+		if !fetchWithRetry(ctx, cfg, fxLog, "FxLoop could not fetch the exchange rates", func() error {
+			var err error
+
+			date, rates, err = FxAPICall(ctx, fxFeedUrl)
+
+			return err
+		}) {
+			return
+		}
+
+		if date == published {
+			fxLog.Debugf("FxLoop has no new rates since %s, skipping interval.\n", date)
+		} else if crossRates, err := FxCrossRates(rates, base, symbols); err != nil {
+			fxLog.Warnf("FxLoop could not use `FX_BASE='%s'` and `FX_SYMBOLS`, skipping interval: %s.\n", base, err)
+		} else {
+			for _, symbol := range symbols {
+				if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, symbol), Payload: strconv.FormatFloat(crossRates[symbol], 'f', -1, 64)}) {
+					return
+				}
+			}
+
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "date"), Payload: date}) {
+				return
+			}
+
+			published = date
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package magpie
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFxRates(t *testing.T) {
+	body, err := os.ReadFile("testdata/fx.xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date, rates, err := ParseFxRates(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]float64{"EUR": 1, "USD": 1.165, "JPY": 172.45, "GBP": 0.87, "CHF": 0.932}
+
+	if date != "2026-10-15" || !reflect.DeepEqual(rates, expected) {
+		t.Fatalf("expected %v of 2026-10-15, got %v of %s", expected, rates, date)
+	}
+
+	for _, c := range []struct {
+		body string
+		err  string
+	}{
+		{body: "<html>", err: "could not parse"},
+		{body: `<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01"><Cube></Cube></gesmes:Envelope>`, err: "could not find any rates"},
+		{body: `<Envelope><Cube><Cube time="2026-10-15"><Cube currency="USD" rate="n/a"/></Cube></Cube></Envelope>`, err: "rate of `USD`"},
+	} {
+		if _, _, err := ParseFxRates([]byte(c.body)); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected an error about %s for %q, got %v", c.err, c.body, err)
+		}
+	}
+}
+
+func TestParseFxSymbols(t *testing.T) {
+	if symbols := ParseFxSymbols(" usd, gbp,,JPY "); !reflect.DeepEqual(symbols, []string{"USD", "GBP", "JPY"}) {
+		t.Fatalf("expected USD, GBP, and JPY, got %v", symbols)
+	}
+
+	if symbols := ParseFxSymbols(""); len(symbols) != 0 {
+		t.Fatalf("expected no symbols, got %v", symbols)
+	}
+}
+
+func TestFxCrossRates(t *testing.T) {
+	rates := map[string]float64{"EUR": 1, "USD": 1.165, "JPY": 172.45, "GBP": 0.87}
+
+	for _, c := range []struct {
+		base     string
+		symbols  []string
+		expected map[string]float64
+	}{
+		{base: "EUR", symbols: []string{"USD", "GBP"}, expected: map[string]float64{"USD": 1.165, "GBP": 0.87}},
+		{base: "USD", symbols: []string{"EUR", "JPY"}, expected: map[string]float64{"EUR": 0.858369, "JPY": 148.025751}},
+		{base: "GBP", symbols: []string{"GBP", "USD"}, expected: map[string]float64{"GBP": 1, "USD": 1.33908}},
+	} {
+		crossRates, err := FxCrossRates(rates, c.base, c.symbols)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(crossRates, c.expected) {
+			t.Errorf("FxCrossRates(%s, %v) = %v, expected %v", c.base, c.symbols, crossRates, c.expected)
+		}
+	}
+
+	for _, c := range []struct {
+		base    string
+		symbols []string
+	}{
+		{base: "XAU", symbols: []string{"USD"}},
+		{base: "EUR", symbols: []string{"USD", "XAU"}},
+	} {
+		if _, err := FxCrossRates(rates, c.base, c.symbols); err == nil || !strings.Contains(err.Error(), "`XAU`") {
+			t.Errorf("expected an error about `XAU`, got %v", err)
+		}
+	}
+}
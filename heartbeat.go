@@ -0,0 +1,65 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var heartbeatLog = NewLogger("heartbeat")
+
+/* The heartbeat payload, the current time in RFC3339. */
+func HeartbeatPayload(now time.Time) string {
+	return now.UTC().Format(time.RFC3339)
+}
+
+/* The time magpie has been running in whole seconds. */
+func HeartbeatUptime(start time.Time, now time.Time) string {
+	return strconv.FormatInt(int64(now.Sub(start)/time.Second), 10)
+}
+
+/* Read and check whether the heartbeat source submits the uptime. */
+func heartbeatUptimeFromConfig(cfg SourceConfig) (bool, error) {
+	uptimeFromEnv := cfg.Get("HEARTBEAT_UPTIME")
+
+	uptime, err := strconv.ParseBool(uptimeFromEnv)
+
+	if err != nil {
+		return false, fmt.Errorf("could not parse `HEARTBEAT_UPTIME='%s'` as boolean", uptimeFromEnv)
+	}
+
+	return uptime, nil
+}
+
+/* Publishes the current time as a sign of life, and optionally the uptime
+ * since magpie started to `<topic>/uptime`. Both pass quiet hours as they tell magpie is
+ * alive. */
+func HeartbeatLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	uptime, err := heartbeatUptimeFromConfig(cfg)
+
+	if err != nil {
+		heartbeatLog.Warnf("HeartbeatLoop %s, disabled.\n", err)
+		return
+	}
+
+	heartbeatLog.Println("HeartbeatLoop enabled.")
+
+	for {
+		now := cfg.Now()
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Critical: true, Topic: cfg.Topic, Payload: HeartbeatPayload(now)}) {
+			return
+		}
+
+		if uptime {
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Critical: true, Topic: buildTopic(cfg.Topic, "uptime"), Payload: HeartbeatUptime(cfg.Started, now)}) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
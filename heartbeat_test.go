@@ -0,0 +1,49 @@
+package magpie
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatLoopCountsUptimeFromStart(t *testing.T) {
+	started := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1", "HEARTBEAT_TOPIC": "heartbeat", "HEARTBEAT_UPTIME": "true"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg SourceConfig
+
+	for _, source := range NewSources(config, started) {
+		if source.Name() == "heartbeat" {
+			cfg = source.Config()
+		}
+	}
+
+	cfg.Clock = FrozenClock{Time: started.Add(90 * time.Minute)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		HeartbeatLoop(ctx, ch, cfg)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if m := receive(t, ch); m.Topic != "heartbeat" || m.Payload != "2026-01-01T13:30:00Z" || !m.Critical {
+		t.Fatalf("expected the current time as a critical message, got %+v", m)
+	}
+
+	if m := receive(t, ch); m.Topic != "heartbeat/uptime" || m.Payload != "5400" || !m.Critical {
+		t.Fatalf("expected an uptime of 5400 seconds since the start, got %+v", m)
+	}
+}
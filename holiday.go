@@ -0,0 +1,122 @@
+package magpie
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var holidayLog = NewLogger("holiday")
+
+/* A public holiday from the `date.nager.at` API, holidays that are not
+ * `Global` only apply to some regions of the country. */
+type Holiday struct {
+	Date      string `json:"date"`
+	LocalName string `json:"localName"`
+	Name      string `json:"name"`
+	Global    bool   `json:"global"`
+}
+
+/* Parse a response of the `date.nager.at` API into the holidays of a year.
+ * Countries without holidays get an empty response. */
+func ParseHolidays(body []byte) ([]Holiday, error) {
+	var holidays []Holiday
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+
+	if err := json.Unmarshal(body, &holidays); err != nil {
+		return nil, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	return holidays, nil
+}
+
+/* The nationwide holiday on `date` in the `YYYY-MM-DD` format, reports
+ * false when there is none. */
+func HolidayOn(holidays []Holiday, date string) (Holiday, bool) {
+	for _, holiday := range holidays {
+		if holiday.Global && holiday.Date == date {
+			return holiday, true
+		}
+	}
+
+	return Holiday{}, false
+}
+
+/* Call the `date.nager.at` API and return the holidays of `country` in
+ * `year`. */
+func HolidayAPICall(ctx context.Context, country string, year int) ([]Holiday, error) {
+	body, err := httpGet(ctx, fmt.Sprintf("https://date.nager.at/api/v3/PublicHolidays/%d/%s", year, url.PathEscape(country)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseHolidays(body)
+}
+
+/* A loop that fetches the holidays of the country in `HOLIDAY_COUNTRY` once
+ * per day and submits whether today is a public holiday, `yes` or `no`, to
+ * the topic given in the environment variable `HOLIDAY_TOPIC` every
+ * interval, and its name to `<topic>/name`. */
+func HolidayLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	country := strings.ToUpper(strings.TrimSpace(cfg.Get("HOLIDAY_COUNTRY")))
+
+	if country == "" {
+		holidayLog.Println("HolidayLoop needs `HOLIDAY_COUNTRY` set in the environment to a country code such as `NL`, disabled.")
+		return
+	}
+
+	holidayLog.Println("HolidayLoop enabled.")
+
+	var holidays []Holiday
+	var fetched string
+
+	for {
+		now := cfg.Now().In(cfg.Location)
+		date := now.Format(time.DateOnly)
+
+		if fetched != date {
+			if !fetchWithRetry(ctx, cfg, holidayLog, "HolidayLoop could not fetch the holidays", func() error {
+				var err error
+
+				holidays, err = HolidayAPICall(ctx, country, now.Year())
+
+				return err
+			}) {
+				return
+			}
+
+			if len(holidays) == 0 {
+				holidayLog.Printf("HolidayLoop found no holidays for `%s` in %d.\n", country, now.Year())
+			}
+
+			fetched = date
+		}
+
+		isHoliday := "no"
+		holiday, exists := HolidayOn(holidays, date)
+
+		if exists {
+			isHoliday = "yes"
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: isHoliday}) {
+			return
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "name"), Payload: holiday.Name}) {
+			return
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package magpie
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseHolidays(t *testing.T) {
+	body, err := os.ReadFile("testdata/holidays.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holidays, err := ParseHolidays(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(holidays) != 4 {
+		t.Fatalf("expected 4 holidays, got %d", len(holidays))
+	}
+
+	if holiday, found := HolidayOn(holidays, "2026-04-27"); !found || holiday.LocalName != "Koningsdag" || holiday.Name != "King's Day" {
+		t.Errorf("expected King's Day on 2026-04-27, got %+v", holiday)
+	}
+
+	if holiday, found := HolidayOn(holidays, "2026-05-05"); found {
+		t.Errorf("expected a regional holiday to be left out, got %+v", holiday)
+	}
+
+	if holiday, found := HolidayOn(holidays, "2026-04-28"); found {
+		t.Errorf("expected no holiday on 2026-04-28, got %+v", holiday)
+	}
+}
+
+func TestParseHolidaysWithoutHolidays(t *testing.T) {
+	for _, body := range []string{"", " \n", "[]"} {
+		holidays, err := ParseHolidays([]byte(body))
+
+		if err != nil || len(holidays) != 0 {
+			t.Errorf("expected no holidays for %q, got %+v and %v", body, holidays, err)
+		}
+
+		if _, found := HolidayOn(holidays, "2026-01-01"); found {
+			t.Errorf("expected no holiday for %q", body)
+		}
+	}
+
+	if _, err := ParseHolidays([]byte(`{"status": 404}`)); err == nil {
+		t.Error("expected an object to be refused")
+	}
+}
@@ -0,0 +1,82 @@
+package magpie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/* The client used for every outbound API call, the timeout is set from
+ * `MAGPIE_HTTP_TIMEOUT` on startup. */
+var HttpClient = &http.Client{Timeout: 10 * time.Second}
+
+/* Returned when an API responds with a status other than `2xx`, wrapped
+ * with the status and the start of the body. */
+var ErrHttpStatus = errors.New("the response status was not successful")
+
+/* Longest part of the body of an unsuccessful response kept in its
+ * error. */
+const httpSnippetLength = 200
+
+/* Check that the response has a `2xx` status, otherwise describe the status
+ * and the start of `body`. */
+func checkHttpStatus(res *http.Response, body []byte) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	snippet := strings.Join(strings.Fields(string(body)), " ")
+
+	if len(snippet) > httpSnippetLength {
+		snippet = snippet[:httpSnippetLength] + "..."
+	}
+
+	return fmt.Errorf("%w, got `%s` with `%s`", ErrHttpStatus, res.Status, snippet)
+}
+
+/* Leave the url out of an error of the `net/url` or `net/http` packages,
+ * it can contain tokens. */
+func withoutUrl(err error) error {
+	var urlErr *url.Error
+
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
+
+/* Request `apiUrl` with the shared client and return the response body,
+ * responses without a `2xx` status are an error. */
+func httpGet(ctx context.Context, apiUrl string) ([]byte, error) {
+	var err error
+	var req *http.Request
+	var res *http.Response
+
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, apiUrl, nil); err != nil {
+		return nil, fmt.Errorf("could not create the request: %w", withoutUrl(err))
+	}
+
+	if res, err = HttpClient.Do(req); err != nil {
+		return nil, fmt.Errorf("could not communicate with `%s`: %w", req.URL.Host, withoutUrl(err))
+	}
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read the response: %w", err)
+	}
+
+	if err := checkHttpStatus(res, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
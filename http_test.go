@@ -0,0 +1,154 @@
+package magpie
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/* Fails every request as if the upstream could not be reached. */
+type failingTransport struct {
+	attempts atomic.Int32
+}
+
+func (f *failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	f.attempts.Add(1)
+
+	return nil, errors.New("connection refused")
+}
+
+func TestLoopKeepsRunningWhenFetchesFail(t *testing.T) {
+	defer func(jitter func(time.Duration) time.Duration) { retryJitter = jitter }(retryJitter)
+	defer func(client *http.Client) { HttpClient = client }(HttpClient)
+
+	transport := &failingTransport{}
+
+	retryJitter = func(time.Duration) time.Duration { return time.Millisecond }
+	HttpClient = &http.Client{Transport: transport}
+
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":    "1",
+		"HTTPJSON_TOPIC": "json",
+		"HTTPJSON_URL":   "http://upstream.invalid/",
+		"HTTPJSON_PATH":  "$.value",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Source("httpjson")
+	cfg.Name = "test-http-failing"
+	before := FetchErrors.Counts()[cfg.Name]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		HttpJsonLoop(ctx, make(chan MqttCronMessage), cfg)
+	}()
+
+	deadline := time.After(time.Second)
+
+	for transport.attempts.Load() < 3 {
+		select {
+		case <-done:
+			t.Fatal("expected the loop to keep running after a failed fetch")
+		case <-deadline:
+			t.Fatal("expected the loop to retry the failed fetch")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-done
+
+	if failures := FetchErrors.Counts()[cfg.Name] - before; failures < 3 {
+		t.Fatalf("expected every failed fetch to be counted, got %d", failures)
+	}
+}
+
+func TestHttpGetTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { HttpClient.Timeout = timeout }(HttpClient.Timeout)
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	HttpClient.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+
+	if _, err := httpGet(context.Background(), server.URL); err == nil {
+		t.Fatal("expected a response slower than the timeout to be an error")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the call to give up after the timeout, took %s", elapsed)
+	}
+}
+
+func TestApiCallsRefuseUnsuccessfulStatus(t *testing.T) {
+	for _, c := range []struct {
+		code   int
+		body   string
+		status string
+	}{
+		{code: http.StatusNotFound, body: "<html>\n  <h1>Not Found</h1>\n</html>", status: "404 Not Found"},
+		{code: http.StatusInternalServerError, body: strings.Repeat("error ", 100), status: "500 Internal Server Error"},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.code)
+			io.WriteString(w, c.body)
+		}))
+
+		calls := map[string]func() error{
+			"httpGet": func() error {
+				_, err := httpGet(context.Background(), server.URL)
+				return err
+			},
+			"WeatherAPICall": func() error {
+				_, err := WeatherAPICall(context.Background(), server.URL)
+				return err
+			},
+			"DayLightAPICall": func() error {
+				_, err := DayLightAPICall(context.Background(), server.URL)
+				return err
+			},
+		}
+
+		for name, call := range calls {
+			err := call()
+
+			if !errors.Is(err, ErrHttpStatus) || !strings.Contains(err.Error(), c.status) {
+				t.Errorf("expected %s to return ErrHttpStatus with `%s`, got %v", name, c.status, err)
+			}
+		}
+
+		err := calls["httpGet"]()
+
+		if c.code == http.StatusNotFound && !strings.Contains(err.Error(), "`<html> <h1>Not Found</h1> </html>`") {
+			t.Errorf("expected the body on a single line, got %v", err)
+		}
+
+		if c.code == http.StatusInternalServerError && (!strings.HasSuffix(err.Error(), "...`") || len(err.Error()) > 2*httpSnippetLength) {
+			t.Errorf("expected the body to be truncated, got %v", err)
+		}
+
+		server.Close()
+	}
+}
@@ -0,0 +1,197 @@
+package magpie
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var httpJsonLog = NewLogger("httpjson")
+
+/* Split a path such as `$.current.values[0].temperature` into its keys and
+ * array indices, the leading `$` is optional. */
+func ParseJsonPath(path string) ([]any, error) {
+	var segments []any
+
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+
+			if end < 0 {
+				return nil, fmt.Errorf("could not parse `%s` as path, `[` is not closed", path)
+			}
+
+			index, err := strconv.Atoi(rest[1:end])
+
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("could not parse `%s` as path, `%s` is not an array index", path, rest[1:end])
+			}
+
+			segments = append(segments, index)
+			rest = rest[end+1:]
+
+			continue
+		}
+
+		end := strings.IndexAny(rest, ".[")
+
+		if end < 0 {
+			end = len(rest)
+		}
+
+		if end == 0 {
+			return nil, fmt.Errorf("could not parse `%s` as path, a key is empty", path)
+		}
+
+		segments = append(segments, rest[:end])
+		rest = rest[end:]
+	}
+
+	return segments, nil
+}
+
+/* Follow the segments of a path through a decoded JSON document, keys
+ * descend into objects and indices into arrays. */
+func JsonPathLookup(document any, segments []any) (any, error) {
+	value := document
+
+	for _, segment := range segments {
+		switch segment := segment.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+
+			if !ok {
+				return nil, fmt.Errorf("could not find key `%s`, the value is not an object", segment)
+			}
+
+			if value, ok = object[segment]; !ok {
+				return nil, fmt.Errorf("could not find key `%s`", segment)
+			}
+		case int:
+			array, ok := value.([]any)
+
+			if !ok {
+				return nil, fmt.Errorf("could not find index `%d`, the value is not an array", segment)
+			}
+
+			if segment >= len(array) {
+				return nil, fmt.Errorf("could not find index `%d`, the array has %d values", segment, len(array))
+			}
+
+			value = array[segment]
+		}
+	}
+
+	return value, nil
+}
+
+/* Format a value of a decoded JSON document as payload, strings are used as
+ * they are, numbers keep the digits of the document, and objects and arrays
+ * are serialized again. Null has no payload. */
+func JsonPayload(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", errors.New("the value is null")
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	default:
+		payload, err := json.Marshal(value)
+
+		if err != nil {
+			return "", fmt.Errorf("could not serialize the value: %w", err)
+		}
+
+		return string(payload), nil
+	}
+}
+
+/* Extract the payload of the value at the path in a JSON document. */
+func ExtractJsonPath(body []byte, segments []any) (string, error) {
+	var document any
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&document); err != nil {
+		return "", fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	value, err := JsonPathLookup(document, segments)
+
+	if err != nil {
+		return "", err
+	}
+
+	return JsonPayload(value)
+}
+
+/* Read and check the path into the document of the HTTP JSON source, which
+ * is empty when `HTTPJSON_PATH` is not set. */
+func httpJsonPathFromConfig(cfg SourceConfig) ([]any, error) {
+	pathFromEnv := cfg.Get("HTTPJSON_PATH")
+
+	if pathFromEnv == "" {
+		return nil, nil
+	}
+
+	return ParseJsonPath(pathFromEnv)
+}
+
+/* A loop that waits between fetching the JSON document at the URL given in
+ * the environment variable `HTTPJSON_URL` and submits the value at
+ * `HTTPJSON_PATH` in it to the topic given in `HTTPJSON_TOPIC`. */
+func HttpJsonLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	urlFromEnv := cfg.Get("HTTPJSON_URL")
+	pathFromEnv := cfg.Get("HTTPJSON_PATH")
+
+	if urlFromEnv == "" || pathFromEnv == "" {
+		httpJsonLog.Println("HttpJsonLoop needs `HTTPJSON_URL` and `HTTPJSON_PATH` set in the environment, disabled.")
+		return
+	}
+
+	segments, err := httpJsonPathFromConfig(cfg)
+
+	if err != nil {
+		httpJsonLog.Warnf("HttpJsonLoop %s, disabled.\n", err)
+		return
+	}
+
+	httpJsonLog.Println("HttpJsonLoop enabled.")
+
+	for {
+		var body []byte
+
+		if !fetchWithRetry(ctx, cfg, httpJsonLog, "HttpJsonLoop could not fetch the document", func() error {
+			var err error
+
+			body, err = httpGet(ctx, urlFromEnv)
+
+			return err
+		}) {
+			return
+		}
+
+		if payload, err := ExtractJsonPath(body, segments); err != nil {
+			httpJsonLog.Warnf("HttpJsonLoop could not use `HTTPJSON_PATH='%s'`, skipping interval: %s.\n", pathFromEnv, err)
+		} else if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: payload}) {
+			return
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package magpie
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/* Write log lines to a buffer until the returned function restores the
+ * output, only read the buffer afterwards. */
+func captureLog() (*bytes.Buffer, func()) {
+	var buffer bytes.Buffer
+
+	logMutex.Lock()
+	previous, previousPlain := logOutput, log.Writer()
+	logOutput = &buffer
+	log.SetOutput(&buffer)
+	logMutex.Unlock()
+
+	return &buffer, func() {
+		logMutex.Lock()
+		logOutput = previous
+		log.SetOutput(previousPlain)
+		logMutex.Unlock()
+	}
+}
+
+func TestParseJsonPath(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		segments []any
+		valid    bool
+	}{
+		{path: "$.current.values[0].temperature", segments: []any{"current", "values", 0, "temperature"}, valid: true},
+		{path: "current", segments: []any{"current"}, valid: true},
+		{path: "$.values[", valid: false},
+		{path: "$.values[-1]", valid: false},
+		{path: "$.a..b", valid: false},
+	} {
+		segments, err := ParseJsonPath(c.path)
+
+		if (err == nil) != c.valid {
+			t.Errorf("ParseJsonPath(%q) returned %v, expected valid to be %t", c.path, err, c.valid)
+		} else if c.valid && !reflect.DeepEqual(segments, c.segments) {
+			t.Errorf("ParseJsonPath(%q) = %#v, expected %#v", c.path, segments, c.segments)
+		}
+	}
+}
+
+func TestHttpJsonLoopKeepsTheUrlOutOfTheLog(t *testing.T) {
+	defer func(jitter func(time.Duration) time.Duration) { retryJitter = jitter }(retryJitter)
+
+	retryJitter = func(time.Duration) time.Duration { return 0 }
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		io.WriteString(w, `{"current": {"values": [20.5, 21]}}`)
+	}))
+	defer server.Close()
+
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":    "1",
+		"HTTPJSON_TOPIC": "json",
+		"HTTPJSON_URL":   server.URL + "/?token=secret-token",
+		"HTTPJSON_PATH":  "$.current.values[1]",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer, restore := captureLog()
+	defer restore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		HttpJsonLoop(ctx, ch, config.Source("httpjson"))
+	}()
+
+	m := receive(t, ch)
+
+	cancel()
+	<-done
+	restore()
+
+	if m.Topic != "json" || m.Payload != "21" {
+		t.Fatalf("expected `21` on `json`, got %+v", m)
+	}
+
+	if !strings.Contains(buffer.String(), "could not fetch the document") {
+		t.Fatalf("expected the failed fetch to be logged, got %q", buffer.String())
+	}
+
+	if strings.Contains(buffer.String(), "secret-token") {
+		t.Fatalf("expected the url to be left out of the log, got %q", buffer.String())
+	}
+}
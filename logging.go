@@ -0,0 +1,178 @@
+package magpie
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* A single log line in the `json` format. */
+type LogEntry struct {
+	Ts     time.Time `json:"ts"`
+	Level  string    `json:"level"`
+	Source string    `json:"source"`
+	Topic  string    `json:"topic,omitempty"`
+	Msg    string    `json:"msg"`
+}
+
+/* Severity of a log line, lines below the configured level are not
+ * written. */
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l LogLevel) String() string {
+	return logLevelNames[l]
+}
+
+/* Parse a level from its name, one of `debug`, `info`, `warn`, or
+ * `error`. */
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if levelName == name {
+			return LogLevel(level), nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("could not use `MAGPIE_LOG_LEVEL='%s'`, expected `debug`, `info`, `warn`, or `error`", name)
+}
+
+var (
+	logMutex  sync.Mutex
+	logFormat           = "plain"
+	logLevel            = LevelInfo
+	logOutput io.Writer = os.Stderr
+)
+
+/* Parse how log lines are written, either `plain` text or one `json`
+ * object per line. An empty format is `plain`. */
+func ParseLogFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return "plain", nil
+	case "plain", "json":
+		return format, nil
+	}
+
+	return "", fmt.Errorf("could not use `MAGPIE_LOG_FORMAT='%s'`, expected `plain` or `json`", format)
+}
+
+/* Select how log lines are written, see `ParseLogFormat`. */
+func SetLogFormat(format string) error {
+	format, err := ParseLogFormat(format)
+
+	if err != nil {
+		return err
+	}
+
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	logFormat = format
+
+	return nil
+}
+
+/* Only write log lines at `level` or above. */
+func SetLogLevel(level LogLevel) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	logLevel = level
+}
+
+/* Writes log lines with the name of the source, and optionally a topic,
+ * attached. */
+type Logger struct {
+	Source string
+	topic  string
+}
+
+func NewLogger(source string) *Logger {
+	return &Logger{Source: source}
+}
+
+/* A copy of the logger that attaches `topic` to its lines. */
+func (l *Logger) Topic(topic string) *Logger {
+	return &Logger{Source: l.Source, topic: topic}
+}
+
+/* Format a log line without its trailing newline. */
+func (l *Logger) entry(level LogLevel, msg string) LogEntry {
+	return LogEntry{Ts: time.Now().UTC(), Level: level.String(), Source: l.Source, Topic: l.topic, Msg: strings.TrimSuffix(msg, "\n")}
+}
+
+func (l *Logger) output(level LogLevel, msg string) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	if level < logLevel {
+		return
+	}
+
+	if logFormat != "json" {
+		log.Print(msg)
+		return
+	}
+
+	line, err := json.Marshal(l.entry(level, msg))
+
+	if err != nil {
+		log.Print(msg)
+		return
+	}
+
+	logOutput.Write(append(line, '\n'))
+}
+
+func (l *Logger) Debugf(format string, v ...any) {
+	l.output(LevelDebug, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Print(v ...any) {
+	l.output(LevelInfo, fmt.Sprint(v...))
+}
+
+func (l *Logger) Printf(format string, v ...any) {
+	l.output(LevelInfo, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Println(v ...any) {
+	l.output(LevelInfo, fmt.Sprintln(v...))
+}
+
+func (l *Logger) Warnf(format string, v ...any) {
+	l.output(LevelWarn, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Warnln(v ...any) {
+	l.output(LevelWarn, fmt.Sprintln(v...))
+}
+
+func (l *Logger) Errorf(format string, v ...any) {
+	l.output(LevelError, fmt.Sprintf(format, v...))
+}
+
+/* Log the line and exit with status `1`. */
+func (l *Logger) Fatalf(format string, v ...any) {
+	l.output(LevelError, fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
+
+/* Log the line and exit with status `1`. */
+func (l *Logger) Fatalln(v ...any) {
+	l.output(LevelError, fmt.Sprintln(v...))
+	os.Exit(1)
+}
@@ -0,0 +1,144 @@
+package magpie
+
+import (
+	"bufio"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+/* Use the log `format` until the test ends. */
+func useLogFormat(t *testing.T, format string) {
+	t.Helper()
+
+	logMutex.Lock()
+	previous := logFormat
+	logMutex.Unlock()
+
+	if err := SetLogFormat(format); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		SetLogFormat(previous)
+	})
+}
+
+func TestJsonLogLinesAreObjects(t *testing.T) {
+	useLogFormat(t, "json")
+
+	buffer, restore := captureLog()
+	defer restore()
+
+	logger := NewLogger("weather")
+
+	logger.Println("WeatherLoop enabled.")
+	logger.Topic("weather/wind").Warnf("could not publish `%s`\n", "3 \"m/s\"")
+
+	restore()
+
+	var entries []LogEntry
+
+	scanner := bufio.NewScanner(buffer)
+
+	for scanner.Scan() {
+		var entry LogEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("expected a json object per line, got %q: %s", scanner.Text(), err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(entries))
+	}
+
+	for _, c := range []struct {
+		entry LogEntry
+		level string
+		topic string
+		msg   string
+	}{
+		{entry: entries[0], level: "info", topic: "", msg: "WeatherLoop enabled."},
+		{entry: entries[1], level: "warn", topic: "weather/wind", msg: "could not publish `3 \"m/s\"`"},
+	} {
+		if c.entry.Source != "weather" || c.entry.Level != c.level || c.entry.Topic != c.topic || c.entry.Msg != c.msg {
+			t.Errorf("expected %s `%s` on `%s` from weather, got %+v", c.level, c.msg, c.topic, c.entry)
+		}
+
+		if time.Since(c.entry.Ts) > time.Minute {
+			t.Errorf("expected the time of the line, got %s", c.entry.Ts)
+		}
+	}
+}
+
+func TestSetLogFormatRefusesUnknownFormats(t *testing.T) {
+	if err := SetLogFormat("xml"); err == nil {
+		t.Fatal("expected `xml` to be refused")
+	}
+}
+
+func TestLinesBelowTheLogLevelAreSuppressed(t *testing.T) {
+	useLogFormat(t, "json")
+
+	logMutex.Lock()
+	previous := logLevel
+	logMutex.Unlock()
+
+	defer SetLogLevel(previous)
+
+	level, err := ParseLogLevel("warn")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetLogLevel(level)
+
+	buffer, restore := captureLog()
+	defer restore()
+
+	logger := NewLogger("season")
+
+	logger.Debugf("published `%s`\n", "autumn")
+	logger.Println("SeasonLoop enabled.")
+	logger.Warnf("could not fetch\n")
+	logger.Errorf("could not connect\n")
+
+	restore()
+
+	var levels []string
+
+	scanner := bufio.NewScanner(buffer)
+
+	for scanner.Scan() {
+		var entry LogEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		levels = append(levels, entry.Level)
+	}
+
+	if expected := []string{"warn", "error"}; !slices.Equal(levels, expected) {
+		t.Fatalf("expected only %v to be written, got %v", expected, levels)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for _, name := range []string{"debug", "info", "warn", "error"} {
+		level, err := ParseLogLevel(name)
+
+		if err != nil || level.String() != name {
+			t.Errorf("ParseLogLevel(%s) = %s, %v", name, level, err)
+		}
+	}
+
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("expected `verbose` to be refused")
+	}
+}
@@ -0,0 +1,379 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Wait for `d` unless the context is done first, reports whether the full
+ * wait passed. */
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+/* Send messages in order until the context is done, reports whether all of
+ * them were sent. */
+func SendMessages(ctx context.Context, ch chan MqttCronMessage, msgs ...MqttCronMessage) bool {
+	for _, m := range msgs {
+		if !sendMessage(ctx, ch, m) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/* Send a message unless the context is done first, reports whether the
+ * message was sent. */
+func sendMessage(ctx context.Context, ch chan MqttCronMessage, m MqttCronMessage) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- m:
+		return true
+	}
+}
+
+/* Parse the interval of a source from `<source>_INTERVAL`, falling back to
+ * its default. Intervals have to be positive. */
+func intervalFromEnv(lookup func(string) (string, bool), source string) (time.Duration, error) {
+	name := fmt.Sprintf("%s_INTERVAL", source)
+
+	interval, err := DurationFromEnv(lookup, name)
+
+	if err == nil && interval <= 0 {
+		err = fmt.Errorf("`%s` has to be positive", name)
+	}
+
+	return interval, err
+}
+
+/* Pick a random wait up to `max` before the first iteration of a source.
+ * Replaceable for deterministic tests. */
+var startJitter = func(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return rand.N(max + 1)
+}
+
+/* Resolve the wait before the first iteration of a source from
+ * `<source>_START_DELAY`, falling back to a random wait up to
+ * `jitterMax` so sources do not all start at once. */
+func startDelayFromEnv(lookup func(string) (string, bool), source string, jitterMax time.Duration) (time.Duration, error) {
+	name := fmt.Sprintf("%s_START_DELAY", source)
+
+	if _, delayExists := lookup(name); !delayExists {
+		return startJitter(jitterMax), nil
+	}
+
+	delay, err := DurationFromEnv(lookup, name)
+
+	if err == nil && delay < 0 {
+		err = fmt.Errorf("`%s` can not be negative", name)
+	}
+
+	return delay, err
+}
+
+/* The loop of every source by name, each is started with the settings of
+ * its source once it is enabled. */
+var SourceLoops = map[string]func(context.Context, chan MqttCronMessage, SourceConfig){
+	"airquality":     AirQualityLoop,
+	"calendar":       CalendarLoop,
+	"daylight":       DayLightLoop,
+	"dayphase":       DayPhaseLoop,
+	"forecast":       ForecastLoop,
+	"fuel":           FuelLoop,
+	"fx":             FxLoop,
+	"heartbeat":      HeartbeatLoop,
+	"holiday":        HolidayLoop,
+	"httpjson":       HttpJsonLoop,
+	"pollen":         PollenLoop,
+	"powerprice":     PowerPriceLoop,
+	"quake":          QuakeLoop,
+	"season":         SeasonLoop,
+	"snow":           SnowLoop,
+	"tide":           TideLoop,
+	"uvindex":        UVIndexLoop,
+	"weather":        WeatherLoop,
+	"weatherwarning": WeatherWarningLoop,
+}
+
+/* Checks of the settings specific to a source, run for every enabled source
+ * while the configuration is read so mistakes are reported on startup and a
+ * reload with mistakes keeps the current configuration. */
+var sourceValidators = map[string]func(SourceConfig) error{
+	"daylight": func(cfg SourceConfig) error {
+		_, err := dayLightSettingsFromConfig(cfg)
+		return err
+	},
+	"dayphase": func(cfg SourceConfig) error {
+		_, err := dayPhaseSettingsFromConfig(cfg)
+		return err
+	},
+	"heartbeat": func(cfg SourceConfig) error {
+		_, err := heartbeatUptimeFromConfig(cfg)
+		return err
+	},
+	"httpjson": func(cfg SourceConfig) error {
+		_, err := httpJsonPathFromConfig(cfg)
+		return err
+	},
+	"quake": func(cfg SourceConfig) error {
+		_, _, err := quakeSettingsFromConfig(cfg)
+		return err
+	},
+	"season": func(cfg SourceConfig) error {
+		_, err := seasonSettingsFromConfig(cfg)
+		return err
+	},
+	"weather": func(cfg SourceConfig) error {
+		_, err := weatherSettingsFromConfig(cfg)
+		return err
+	},
+}
+
+/* Sources that compute their messages instead of fetching them from an
+ * upstream, they can not go stale. */
+var computedSources = map[string]bool{
+	"calendar":  true,
+	"dayphase":  true,
+	"heartbeat": true,
+	"season":    true,
+}
+
+/* A source of messages, only enabled sources are run. `Run` returns once
+ * the context is done and can be called again afterwards. A running source
+ * whose `Settings` differ after a reload is restarted. */
+type Source interface {
+	Name() string
+	Enabled() bool
+	Settings() string
+	Config() SourceConfig
+	Run(ctx context.Context, ch chan MqttCronMessage)
+}
+
+/* A source that runs its loop from `SourceLoops` with its settings. */
+type loopSource struct {
+	cfg      SourceConfig
+	loop     func(context.Context, chan MqttCronMessage, SourceConfig)
+	settings string
+}
+
+func (s loopSource) Name() string {
+	return s.cfg.Name
+}
+
+func (s loopSource) Enabled() bool {
+	return s.cfg.Enabled
+}
+
+func (s loopSource) Settings() string {
+	return s.settings
+}
+
+func (s loopSource) Config() SourceConfig {
+	return s.cfg
+}
+
+/* Run the loop after the start delay of the source, its messages are
+ * passed on with the name of the source attached, their topic below the
+ * prefix of the source, and numeric payloads rounded. */
+func (s loopSource) Run(ctx context.Context, ch chan MqttCronMessage) {
+	NewLogger(s.cfg.Name).Debugf("%s starts in %s.\n", s.cfg.Name, s.cfg.StartDelay)
+
+	if !sleepContext(ctx, s.cfg.StartDelay) {
+		return
+	}
+
+	named := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for m := range named {
+			m.Source = s.cfg.Name
+			m.Payload = RoundPayload(m.Payload, s.cfg.RoundDecimals)
+
+			if !m.Absolute {
+				m.Topic = PrefixTopic(s.cfg.Prefix, m.Topic)
+				m.Absolute = true
+			}
+
+			sendMessage(ctx, ch, m)
+		}
+	}()
+
+	s.loop(ctx, named, s.cfg)
+
+	close(named)
+	<-done
+}
+
+/* The sources of the configuration in the order of the registry, the
+ * settings of a source include the settings of magpie itself. `started` is
+ * when magpie started. */
+func NewSources(config Config, started time.Time) []Source {
+	var sources []Source
+
+	summary := SummarizeConfig(config)
+	settings := make(map[string]string)
+
+	for _, source := range summary.Sources {
+		settings[source.Name] = fmt.Sprintf("%s; %s", formatSettings(source.Settings), formatSettings(summary.Settings))
+	}
+
+	for _, cfg := range config.Sources {
+		cfg.Started = started
+
+		if loop, exists := SourceLoops[cfg.Name]; exists {
+			sources = append(sources, loopSource{cfg: cfg, loop: loop, settings: settings[cfg.Name]})
+		}
+	}
+
+	return sources
+}
+
+/* Explain why a source is not enabled, either its topic is missing or it
+ * is switched off with `<SOURCE>_ENABLED`. */
+func disabledReason(source Source) string {
+	name := strings.ToUpper(source.Name())
+
+	if s, ok := source.(loopSource); ok && s.cfg.Topic != "" {
+		return fmt.Sprintf("%s is switched off with `%s_ENABLED=false`, disabled.", source.Name(), name)
+	}
+
+	return fmt.Sprintf("%s needs `%s_TOPIC` set in the environment, disabled.", source.Name(), name)
+}
+
+/* A source started by a `Supervisor`. */
+type supervisedSource struct {
+	source  Source
+	started time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+/* The settings of a running source and when it was started. */
+type RunningSource struct {
+	Config  SourceConfig
+	Started time.Time
+}
+
+/* Runs the enabled sources and, when given new sources on a reload, stops
+ * the ones that were disabled or whose settings changed and starts the ones
+ * that are new. Sources that did not change keep running. */
+type Supervisor struct {
+	ch chan MqttCronMessage
+
+	mu      sync.Mutex
+	running map[string]*supervisedSource
+	applied bool
+}
+
+func NewSupervisor(ch chan MqttCronMessage) *Supervisor {
+	return &Supervisor{ch: ch, running: make(map[string]*supervisedSource)}
+}
+
+/* Bring the running sources in line with `sources`, returns the names of
+ * the sources that were stopped and started. Sources run until they are
+ * stopped or the context is done. Why a source is disabled is only logged
+ * the first time and when it was running before. */
+func (s *Supervisor) Apply(ctx context.Context, sources []Source) (stopped []string, started []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]Source)
+
+	for _, source := range sources {
+		if source.Enabled() {
+			wanted[source.Name()] = source
+		}
+	}
+
+	for name, running := range s.running {
+		if next, isWanted := wanted[name]; isWanted && next.Settings() == running.source.Settings() {
+			continue
+		}
+
+		running.cancel()
+		<-running.done
+
+		delete(s.running, name)
+		stopped = append(stopped, name)
+	}
+
+	sort.Strings(stopped)
+
+	for _, source := range sources {
+		if _, isRunning := s.running[source.Name()]; isRunning {
+			continue
+		}
+
+		if !source.Enabled() {
+			if !s.applied || slices.Contains(stopped, source.Name()) {
+				NewLogger(source.Name()).Println(disabledReason(source))
+			}
+
+			continue
+		}
+
+		sourceCtx, cancel := context.WithCancel(ctx)
+		running := &supervisedSource{source: source, started: time.Now(), cancel: cancel, done: make(chan struct{})}
+
+		go func() {
+			defer close(running.done)
+			source.Run(sourceCtx, s.ch)
+		}()
+
+		s.running[source.Name()] = running
+		started = append(started, source.Name())
+	}
+
+	s.applied = true
+
+	return stopped, started
+}
+
+/* The sources that run since the last `Apply` in order of their name. */
+func (s *Supervisor) Running() []RunningSource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sources []RunningSource
+
+	for _, running := range s.running {
+		sources = append(sources, RunningSource{Config: running.source.Config(), Started: running.started})
+	}
+
+	sort.Slice(sources, func(i int, j int) bool {
+		return sources[i].Config.Name < sources[j].Config.Name
+	})
+
+	return sources
+}
+
+/* Wait for every running source to return, which they do once the context
+ * they were started with is done. */
+func (s *Supervisor) Wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, running := range s.running {
+		<-running.done
+	}
+}
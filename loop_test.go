@@ -0,0 +1,384 @@
+package magpie
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* Read and drop messages from `ch` until the returned function is called. */
+func discard(ch chan MqttCronMessage) func() {
+	stop := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ch:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
+
+func TestSendMessagesSendsInOrder(t *testing.T) {
+	ch := make(chan MqttCronMessage, 2)
+
+	if !SendMessages(context.Background(), ch, MqttCronMessage{Topic: "a"}, MqttCronMessage{Topic: "b"}) {
+		t.Fatal("expected every message to be sent")
+	}
+
+	if first, second := <-ch, <-ch; first.Topic != "a" || second.Topic != "b" {
+		t.Fatalf("expected `a` and `b` in order, got %+v and %+v", first, second)
+	}
+}
+
+func TestSendMessagesStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if SendMessages(ctx, make(chan MqttCronMessage), MqttCronMessage{Topic: "a"}) {
+		t.Fatal("expected nothing to be sent once the context is done")
+	}
+}
+
+func TestSupervisorSourcesStopOnceCancelled(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":         "1",
+		"MAGPIE_START_JITTER": "0s",
+		"SEASON_TOPIC":        "season",
+		"DAYPHASE_TOPIC":      "dayphase",
+		"HEARTBEAT_TOPIC":     "heartbeat",
+		"CALENDAR_TOPIC":      "calendar",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan MqttCronMessage)
+	defer discard(ch)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	supervisor := NewSupervisor(ch)
+
+	if _, started := supervisor.Apply(ctx, NewSources(config, time.Now())); len(started) != 4 {
+		t.Fatalf("expected 4 sources to start, got %v", started)
+	}
+
+	cancel()
+
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		supervisor.Wait()
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected every source to stop promptly once cancelled")
+	}
+}
+
+func TestLoopsReturnOnceCancelledWhileWaiting(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":        "1",
+		"SEASON_TOPIC":       "season",
+		"SEASON_INTERVAL":    "1h",
+		"DAYPHASE_TOPIC":     "dayphase",
+		"DAYPHASE_INTERVAL":  "1h",
+		"HEARTBEAT_TOPIC":    "heartbeat",
+		"HEARTBEAT_INTERVAL": "1h",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"season", "dayphase", "heartbeat"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := make(chan MqttCronMessage)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			SourceLoops[name](ctx, ch, config.Source(name))
+		}()
+
+		receive(t, ch)
+		stop := discard(ch)
+
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("expected the %s loop to return within its interval once cancelled", name)
+		}
+
+		stop()
+	}
+}
+
+func TestIntervalFromEnv(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		expected time.Duration
+		valid    bool
+	}{
+		{settings: map[string]string{}, expected: 5 * time.Minute, valid: true},
+		{settings: map[string]string{"WEATHER_INTERVAL": "90s"}, expected: 90 * time.Second, valid: true},
+		{settings: map[string]string{"WEATHER_INTERVAL": "0s"}, valid: false},
+		{settings: map[string]string{"WEATHER_INTERVAL": "-1m"}, valid: false},
+		{settings: map[string]string{"WEATHER_INTERVAL": "often"}, valid: false},
+	} {
+		interval, err := intervalFromEnv(mapLookup(c.settings), "WEATHER")
+
+		if (err == nil) != c.valid {
+			t.Errorf("intervalFromEnv(%v) returned %v, expected valid to be %t", c.settings, err, c.valid)
+		} else if c.valid && interval != c.expected {
+			t.Errorf("intervalFromEnv(%v) = %s, expected %s", c.settings, interval, c.expected)
+		}
+	}
+}
+
+/* A source that reports on `runs` when it is run and then waits for its
+ * context. */
+type fakeSource struct {
+	name    string
+	enabled bool
+	runs    chan string
+}
+
+func (s fakeSource) Name() string {
+	return s.name
+}
+
+func (s fakeSource) Enabled() bool {
+	return s.enabled
+}
+
+func (s fakeSource) Settings() string {
+	return ""
+}
+
+func (s fakeSource) Config() SourceConfig {
+	return SourceConfig{Name: s.name, Enabled: s.enabled}
+}
+
+func (s fakeSource) Run(ctx context.Context, ch chan MqttCronMessage) {
+	s.runs <- s.name
+	<-ctx.Done()
+}
+
+func TestSupervisorStartsOnlyEnabledSources(t *testing.T) {
+	runs := make(chan string, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	supervisor := NewSupervisor(make(chan MqttCronMessage))
+
+	_, started := supervisor.Apply(ctx, []Source{
+		fakeSource{name: "fake", enabled: true, runs: runs},
+		fakeSource{name: "idle", enabled: false, runs: runs},
+	})
+
+	if !slices.Equal(started, []string{"fake"}) {
+		t.Fatalf("expected only `fake` to be started, got %v", started)
+	}
+
+	select {
+	case name := <-runs:
+		if name != "fake" {
+			t.Fatalf("expected `fake` to run, got `%s`", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected `fake` to run")
+	}
+
+	if running := supervisor.Running(); len(running) != 1 || running[0].Config.Name != "fake" {
+		t.Fatalf("expected only `fake` to be running, got %+v", running)
+	}
+
+	cancel()
+	supervisor.Wait()
+
+	select {
+	case name := <-runs:
+		t.Fatalf("expected `%s` to not run", name)
+	default:
+	}
+}
+
+func TestSourcesPublishBelowTheirPrefix(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":         "1",
+		"MQTT_PREFIX":         "home",
+		"MAGPIE_START_JITTER": "0s",
+		"SEASON_TOPIC":        "season",
+		"SEASON_PREFIX":       "garden",
+		"CALENDAR_TOPIC":      "calendar",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	supervisor := NewSupervisor(ch)
+
+	supervisor.Apply(ctx, NewSources(config, time.Now()))
+
+	prefixes := make(map[string]string)
+
+	for len(prefixes) < 2 {
+		m := receive(t, ch)
+
+		if !m.Absolute {
+			t.Fatalf("expected the prefix to be applied by the source, got %+v", m)
+		}
+
+		prefix, _, _ := strings.Cut(m.Topic, "/")
+		prefixes[m.Source] = prefix
+	}
+
+	stop := discard(ch)
+
+	cancel()
+	supervisor.Wait()
+	stop()
+
+	if expected := map[string]string{"season": "garden", "calendar": "home"}; !reflect.DeepEqual(prefixes, expected) {
+		t.Fatalf("expected %v, got %v", expected, prefixes)
+	}
+}
+
+func TestStartDelayFromEnv(t *testing.T) {
+	defer func(jitter func(time.Duration) time.Duration) { startJitter = jitter }(startJitter)
+
+	startJitter = func(max time.Duration) time.Duration { return max / 2 }
+
+	for _, c := range []struct {
+		settings map[string]string
+		expected time.Duration
+		valid    bool
+	}{
+		{settings: map[string]string{}, expected: 15 * time.Second, valid: true},
+		{settings: map[string]string{"SEASON_START_DELAY": "2m"}, expected: 2 * time.Minute, valid: true},
+		{settings: map[string]string{"SEASON_START_DELAY": "0s"}, expected: 0, valid: true},
+		{settings: map[string]string{"SEASON_START_DELAY": "-1s"}, valid: false},
+		{settings: map[string]string{"SEASON_START_DELAY": "later"}, valid: false},
+	} {
+		delay, err := startDelayFromEnv(mapLookup(c.settings), "SEASON", 30*time.Second)
+
+		if (err == nil) != c.valid || (c.valid && delay != c.expected) {
+			t.Errorf("startDelayFromEnv(%v) = %s, %v, expected %s and valid to be %t", c.settings, delay, err, c.expected, c.valid)
+		}
+	}
+}
+
+func TestSourceWaitsForItsStartDelay(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{
+		"STDOUT_SINK":        "1",
+		"SEASON_TOPIC":       "season",
+		"SEASON_START_DELAY": "200ms",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	supervisor := NewSupervisor(ch)
+
+	start := time.Now()
+
+	supervisor.Apply(ctx, NewSources(config, start))
+
+	receive(t, ch)
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected the first message after the start delay, got it after %s", elapsed)
+	}
+
+	stop := discard(ch)
+
+	cancel()
+	supervisor.Wait()
+	stop()
+}
+
+func TestSupervisorReloadTogglesSources(t *testing.T) {
+	ch := make(chan MqttCronMessage)
+	defer discard(ch)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	supervisor := NewSupervisor(ch)
+
+	running := func() []string {
+		var names []string
+
+		for _, source := range supervisor.Running() {
+			names = append(names, source.Config.Name)
+		}
+
+		return names
+	}
+
+	for _, c := range []struct {
+		settings map[string]string
+		stopped  []string
+		started  []string
+		running  []string
+	}{
+		{
+			settings: map[string]string{"SEASON_TOPIC": "season", "CALENDAR_TOPIC": "calendar"},
+			started:  []string{"calendar", "season"},
+			running:  []string{"calendar", "season"},
+		},
+		{
+			settings: map[string]string{"SEASON_TOPIC": "season", "SEASON_ENABLED": "false", "CALENDAR_TOPIC": "calendar"},
+			stopped:  []string{"season"},
+			running:  []string{"calendar"},
+		},
+		{
+			settings: map[string]string{"SEASON_TOPIC": "season", "CALENDAR_TOPIC": "calendar"},
+			started:  []string{"season"},
+			running:  []string{"calendar", "season"},
+		},
+		{
+			settings: map[string]string{"SEASON_TOPIC": "season", "CALENDAR_TOPIC": "calendar", "CALENDAR_INTERVAL": "10m"},
+			stopped:  []string{"calendar"},
+			started:  []string{"calendar"},
+			running:  []string{"calendar", "season"},
+		},
+	} {
+		c.settings["STDOUT_SINK"] = "1"
+		c.settings["MAGPIE_START_JITTER"] = "0s"
+
+		config, err := ConfigFromLookup(mapLookup(c.settings))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stopped, started := supervisor.Apply(ctx, NewSources(config, time.Now()))
+
+		if !slices.Equal(stopped, c.stopped) || !slices.Equal(started, c.started) || !slices.Equal(running(), c.running) {
+			t.Fatalf("expected %v to stop, %v to start, and %v to run for %v, got %v, %v, and %v", c.stopped, c.started, c.running, c.settings, stopped, started, running())
+		}
+	}
+
+	cancel()
+	supervisor.Wait()
+}
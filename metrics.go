@@ -0,0 +1,177 @@
+package magpie
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/* A named value published to a subtopic of a source's topic. */
+type Metric struct {
+	Name  string
+	Value string
+}
+
+/* Renames the metric suffixes of a source's topics, metrics that are not
+ * renamed keep their name. */
+type MetricNames map[string]string
+
+/* Parse renames in the `metric=name,metric=name` format, every metric has
+ * to be one of `known`. */
+func ParseMetricNames(spec string, known []string) (MetricNames, error) {
+	names := make(MetricNames)
+
+	if strings.TrimSpace(spec) == "" {
+		return names, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		metric, name, found := strings.Cut(strings.TrimSpace(pair), "=")
+
+		if !found || metric == "" || name == "" {
+			return nil, fmt.Errorf("could not parse `%s` as `metric=name`", pair)
+		}
+
+		isKnown := false
+
+		for _, k := range known {
+			isKnown = isKnown || k == metric
+		}
+
+		if !isKnown {
+			return nil, fmt.Errorf("unknown metric `%s`, expected one of `%s`", metric, strings.Join(known, "`, `"))
+		}
+
+		names[metric] = name
+	}
+
+	return names, nil
+}
+
+/* The name to use for a metric. */
+func (n MetricNames) Name(metric string) string {
+	if name, exists := n[metric]; exists {
+		return name
+	}
+
+	return metric
+}
+
+/* Resolve the decimals the numbers of a source are rounded to from
+ * `<source>_ROUND_DECIMALS`, falling back to `MAGPIE_ROUND_DECIMALS`. It is
+ * `-1` when neither is set and numbers are published as they are. */
+func roundDecimalsFromEnv(lookup func(string) (string, bool), source string) (int, error) {
+	for _, name := range []string{fmt.Sprintf("%s_ROUND_DECIMALS", source), "MAGPIE_ROUND_DECIMALS"} {
+		if decimalsFromEnv, decimalsExists := lookup(name); decimalsExists {
+			decimals, err := strconv.Atoi(decimalsFromEnv)
+
+			if err != nil || decimals < 0 {
+				return -1, fmt.Errorf("could not parse `%s='%s'` as a non-negative number of decimals", name, decimalsFromEnv)
+			}
+
+			return decimals, nil
+		}
+	}
+
+	return -1, nil
+}
+
+/* Round a payload that is a number to `decimals`, trailing zeroes are
+ * dropped. Other payloads and a negative `decimals` leave it as it is. */
+func RoundPayload(payload string, decimals int) string {
+	if decimals < 0 {
+		return payload
+	}
+
+	number, err := strconv.ParseFloat(payload, 64)
+
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return payload
+	}
+
+	scale := math.Pow10(decimals)
+
+	return strconv.FormatFloat(math.Round(number*scale)/scale, 'f', -1, 64)
+}
+
+var (
+	temperatureUnitMutex sync.Mutex
+	temperatureUnit      = "c"
+)
+
+/* Parse the unit temperatures are published in, either `c` for Celsius or
+ * `f` for Fahrenheit. An empty unit is `c`. */
+func ParseTemperatureUnit(unit string) (string, error) {
+	switch unit {
+	case "":
+		return "c", nil
+	case "c", "f":
+		return unit, nil
+	}
+
+	return "", fmt.Errorf("could not use `MAGPIE_TEMPERATURE_UNIT='%s'`, expected `c` or `f`", unit)
+}
+
+/* Select the unit temperatures are published in, see
+ * `ParseTemperatureUnit`, safe to change while sources publish. */
+func SetTemperatureUnit(unit string) error {
+	unit, err := ParseTemperatureUnit(unit)
+
+	if err != nil {
+		return err
+	}
+
+	temperatureUnitMutex.Lock()
+	defer temperatureUnitMutex.Unlock()
+
+	temperatureUnit = unit
+
+	return nil
+}
+
+/* The unit temperatures are currently published in. */
+func currentTemperatureUnit() string {
+	temperatureUnitMutex.Lock()
+	defer temperatureUnitMutex.Unlock()
+
+	return temperatureUnit
+}
+
+/* The symbol of the unit temperatures are published in. */
+func TemperatureSymbol() string {
+	if currentTemperatureUnit() == "f" {
+		return "°F"
+	}
+
+	return "°C"
+}
+
+/* Convert a temperature in °C to °F. */
+func CelsiusToFahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
+
+/* Convert the temperatures in °C among `metrics`, the ones named
+ * `temperature` or below it, to the selected unit. Fahrenheit is rounded to
+ * a tenth, other metrics are left as they are. */
+func ConvertTemperatureMetrics(metrics []Metric) []Metric {
+	if currentTemperatureUnit() == "c" {
+		return metrics
+	}
+
+	var converted []Metric
+
+	for _, metric := range metrics {
+		if metric.Name == "temperature" || strings.HasPrefix(metric.Name, "temperature.") {
+			if c, err := strconv.ParseFloat(metric.Value, 64); err == nil {
+				metric.Value = strconv.FormatFloat(math.Round(CelsiusToFahrenheit(c)*10)/10, 'f', -1, 64)
+			}
+		}
+
+		converted = append(converted, metric)
+	}
+
+	return converted
+}
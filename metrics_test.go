@@ -0,0 +1,112 @@
+package magpie
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetricNames(t *testing.T) {
+	names, err := ParseMetricNames(" temperature.ground=temperature , humidity=rh", WeatherMetrics)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for metric, expected := range map[string]string{"temperature.ground": "temperature", "humidity": "rh", "wind": "wind"} {
+		if name := names.Name(metric); name != expected {
+			t.Errorf("expected `%s` to be named `%s`, got `%s`", metric, expected, name)
+		}
+	}
+
+	for _, spec := range []string{"temperature.ground", "=rh", "humidity=", "dewpoint=dew"} {
+		if _, err := ParseMetricNames(spec, WeatherMetrics); err == nil {
+			t.Errorf("expected `%s` to be refused", spec)
+		}
+	}
+}
+
+func TestRoundPayload(t *testing.T) {
+	for _, c := range []struct {
+		payload  string
+		decimals int
+		expected string
+	}{
+		{payload: "8.37", decimals: 1, expected: "8.4"},
+		{payload: "8.35", decimals: 0, expected: "8"},
+		{payload: "-2.25", decimals: 1, expected: "-2.3"},
+		{payload: "1013.20", decimals: 1, expected: "1013.2"},
+		{payload: "3.40", decimals: 2, expected: "3.4"},
+		{payload: "8.37", decimals: -1, expected: "8.37"},
+		{payload: "3.40", decimals: -1, expected: "3.40"},
+		{payload: "ZW", decimals: 1, expected: "ZW"},
+		{payload: "2026-01-15T14:50:00+01:00", decimals: 1, expected: "2026-01-15T14:50:00+01:00"},
+		{payload: "NaN", decimals: 1, expected: "NaN"},
+		{payload: "", decimals: 1, expected: ""},
+	} {
+		if payload := RoundPayload(c.payload, c.decimals); payload != c.expected {
+			t.Errorf("RoundPayload(%q, %d) = %q, expected %q", c.payload, c.decimals, payload, c.expected)
+		}
+	}
+}
+
+func TestRoundDecimalsFromEnv(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		expected int
+		valid    bool
+	}{
+		{settings: map[string]string{}, expected: -1, valid: true},
+		{settings: map[string]string{"MAGPIE_ROUND_DECIMALS": "2"}, expected: 2, valid: true},
+		{settings: map[string]string{"MAGPIE_ROUND_DECIMALS": "2", "WEATHER_ROUND_DECIMALS": "0"}, expected: 0, valid: true},
+		{settings: map[string]string{"WEATHER_ROUND_DECIMALS": "-1"}, valid: false},
+		{settings: map[string]string{"MAGPIE_ROUND_DECIMALS": "two"}, valid: false},
+	} {
+		decimals, err := roundDecimalsFromEnv(mapLookup(c.settings), "WEATHER")
+
+		if (err == nil) != c.valid || (c.valid && decimals != c.expected) {
+			t.Errorf("roundDecimalsFromEnv(%v) = %d, %v, expected %d and valid to be %t", c.settings, decimals, err, c.expected, c.valid)
+		}
+	}
+}
+
+func TestConvertTemperatureMetricsToFahrenheit(t *testing.T) {
+	defer SetTemperatureUnit(temperatureUnit)
+
+	metrics := []Metric{
+		{Name: "temperature.ground", Value: "1.4"},
+		{Name: "temperature.apparent", Value: "-40"},
+		{Name: "temperature", Value: "100"},
+		{Name: "temperature.water", Value: ""},
+		{Name: "humidity", Value: "87"},
+		{Name: "wind", Value: "3.40"},
+	}
+
+	if err := SetTemperatureUnit("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	if converted := ConvertTemperatureMetrics(metrics); !reflect.DeepEqual(converted, metrics) || TemperatureSymbol() != "°C" {
+		t.Fatalf("expected Celsius to leave the metrics alone, got %+v", converted)
+	}
+
+	if err := SetTemperatureUnit("f"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Metric{
+		{Name: "temperature.ground", Value: "34.5"},
+		{Name: "temperature.apparent", Value: "-40"},
+		{Name: "temperature", Value: "212"},
+		{Name: "temperature.water", Value: ""},
+		{Name: "humidity", Value: "87"},
+		{Name: "wind", Value: "3.40"},
+	}
+
+	if converted := ConvertTemperatureMetrics(metrics); !reflect.DeepEqual(converted, expected) || TemperatureSymbol() != "°F" {
+		t.Fatalf("expected %+v, got %+v", expected, converted)
+	}
+
+	if err := SetTemperatureUnit("k"); err == nil {
+		t.Fatal("expected `k` to be refused")
+	}
+}
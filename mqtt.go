@@ -1,9 +1,318 @@
 package magpie
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang"
+)
+
+var messageLog = NewLogger("magpie")
+
 /* Message passed along between *Loop and MessageLoop through a channel,
- * *Loop determines the data and where it goes. */
+ * *Loop determines the data and where it goes. Critical messages, such as
+ * status and errors, are published even during quiet hours. `Qos` raises
+ * the quality of service above the configured default. Absolute messages
+ * are published to their topic without the prefix. `Source` names the
+ * source that sent the message. */
 type MqttCronMessage struct {
-	Topic   string
-	Payload string
-	Retain  bool
+	Source   string
+	Topic    string
+	Payload  string
+	Retain   bool
+	Critical bool
+	Absolute bool
+	Qos      byte
+}
+
+/* Parse a quality of service level, which is one of `0`, `1`, or `2`. */
+func ParseQos(value string) (byte, error) {
+	switch value {
+	case "0", "1", "2":
+		return value[0] - '0', nil
+	default:
+		return 0, fmt.Errorf("could not parse `%s` as quality of service, expected `0`, `1`, or `2`", value)
+	}
+}
+
+/* Drop the leading and trailing slashes of a prefix, a leading slash would
+ * make brokers publish below an empty top level. */
+func NormalizePrefix(prefix string) string {
+	return strings.Trim(prefix, "/")
+}
+
+/* Put `topic` below `prefix`, an empty prefix leaves the topic as is. */
+func PrefixTopic(prefix string, topic string) string {
+	if prefix == "" {
+		return topic
+	}
+
+	return fmt.Sprintf("%s/%s", prefix, topic)
+}
+
+/* Resolve the prefix of a source from `<source>_PREFIX`, falling back to
+ * the global prefix. An empty `<source>_PREFIX` publishes the topics of the
+ * source as they are. */
+func ResolvePrefix(lookup func(string) (string, bool), source string, global string) string {
+	if prefixFromEnv, prefixExists := lookup(fmt.Sprintf("%s_PREFIX", source)); prefixExists {
+		return NormalizePrefix(prefixFromEnv)
+	}
+
+	return global
+}
+
+/* The topic announcing whether magpie is `online` or `offline`, taken from
+ * `MQTT_AVAILABILITY_TOPIC` and defaulting to `<prefix>/magpie/status`. */
+func AvailabilityTopic(lookup func(string) (string, bool), prefix string) string {
+	if topicFromEnv, topicExists := lookup("MQTT_AVAILABILITY_TOPIC"); topicExists {
+		return topicFromEnv
+	}
+
+	return PrefixTopic(prefix, "magpie/status")
+}
+
+/* Resolve whether a source retains its messages from `<source>_RETAIN`,
+ * falling back to `MQTT_RETAIN_DEFAULT` and then to the source's own
+ * default. */
+func ResolveRetain(lookup func(string) (string, bool), source string, sourceDefault bool) (bool, error) {
+	for _, name := range []string{fmt.Sprintf("%s_RETAIN", source), "MQTT_RETAIN_DEFAULT"} {
+		if retainFromEnv, retainExists := lookup(name); retainExists {
+			retain, err := strconv.ParseBool(retainFromEnv)
+
+			if err != nil {
+				return false, fmt.Errorf("could not parse `%s='%s'` as boolean", name, retainFromEnv)
+			}
+
+			return retain, nil
+		}
+	}
+
+	return sourceDefault, nil
+}
+
+/* The brokers to publish to from the comma-separated `MQTT_HOST` and
+ * `MQTT_HOSTS` through `lookup`, in order and without duplicates. */
+func BrokerHosts(lookup func(string) (string, bool)) []string {
+	var hosts []string
+
+	seen := make(map[string]bool)
+
+	for _, name := range []string{"MQTT_HOST", "MQTT_HOSTS"} {
+		valueFromEnv, _ := lookup(name)
+
+		for _, host := range strings.Split(valueFromEnv, ",") {
+			host = strings.TrimSpace(host)
+
+			if host == "" || seen[host] {
+				continue
+			}
+
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+/* Resolve the client ID from `MQTT_CLIENT_ID` through `lookup`, falling back
+ * to `magpie-<hostname>` and then to `magpie-<random>` so several instances
+ * can share a broker. */
+func ClientId(lookup func(string) (string, bool), hostname func() (string, error)) string {
+	if idFromEnv, idExists := lookup("MQTT_CLIENT_ID"); idExists && idFromEnv != "" {
+		return idFromEnv
+	}
+
+	if host, err := hostname(); err == nil && host != "" {
+		return fmt.Sprintf("magpie-%s", host)
+	}
+
+	return fmt.Sprintf("magpie-%08x", rand.Uint32())
+}
+
+/* Announce magpie as `online` along with its version and the sources it
+ * runs, done on every (re)connect as the will has announced it `offline` in
+ * between. */
+func announceOnline(c mqtt.Client, config Config, host string) {
+	messageLog.Printf("magpie connected to MQTT server `%s`.\n", host)
+
+	if token := c.Publish(config.AvailabilityTopic, 0, true, "online"); token.Wait() && token.Error() != nil {
+		messageLog.Warnln("Error announcing availability to MQTT server.")
+	}
+
+	if token := c.Publish(PrefixTopic(config.Prefix, "magpie/version"), 0, true, VersionString()); token.Wait() && token.Error() != nil {
+		messageLog.Warnln("Error announcing version to MQTT server.")
+	}
+
+	sources, err := json.Marshal(ActiveSourcesFromConfig(config))
+
+	if err != nil {
+		messageLog.Warnf("magpie could not serialize the active sources: %s.\n", err)
+		return
+	}
+
+	if token := c.Publish(PrefixTopic(config.Prefix, "magpie/sources"), 0, true, sources); token.Wait() && token.Error() != nil {
+		messageLog.Warnln("Error announcing sources to MQTT server.")
+	}
+}
+
+/* Build the client options for the broker at `host`, with the credentials
+ * of the configuration when present. A retained `offline` is registered as will on
+ * the availability topic. Lost connections are reconnected waiting at most
+ * the reconnect interval between attempts, magpie announces itself again
+ * once reconnected and resets the retained filter when given so every value
+ * is published again. */
+func MqttClientOptions(config Config, host string, retained *RetainedFilter) *mqtt.ClientOptions {
+	opts := mqtt.NewClientOptions().AddBroker(host).SetClientID(config.ClientId)
+	opts.SetKeepAlive(2 * time.Second)
+	opts.SetPingTimeout(1 * time.Second)
+	opts.SetWill(config.AvailabilityTopic, "offline", 0, true)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(config.ReconnectInterval)
+
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		if retained != nil {
+			retained.Reset()
+		}
+
+		announceOnline(c, config, host)
+	})
+
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		messageLog.Warnf("magpie lost the connection to MQTT server `%s`, reconnecting: %s.\n", host, err)
+	})
+
+	opts.SetReconnectingHandler(func(c mqtt.Client, opts *mqtt.ClientOptions) {
+		messageLog.Printf("magpie reconnecting to MQTT server `%s`.\n", host)
+	})
+
+	if (config.Username == "") != (config.Password == "") {
+		messageLog.Warnln("magpie has only one of `MQTT_USERNAME` and `MQTT_PASSWORD` set in the environment, authentication may fail.")
+	}
+
+	if config.Username != "" {
+		opts.SetUsername(config.Username)
+	}
+
+	if config.Password != "" {
+		opts.SetPassword(config.Password)
+	}
+
+	return opts
+}
+
+/* Returned by sinks whose broker is not connected, the message is dropped
+ * for that broker only. */
+var ErrBrokerOffline = errors.New("not connected to the MQTT server")
+
+/* Publishes messages through `Publisher` with at least `Qos` as quality of
+ * service. Messages are dropped while its broker is not connected so a
+ * broker that is down does not hold up the others. */
+type MqttSink struct {
+	Publisher Publisher
+	Qos       byte
+}
+
+/* Publish to the broker at `host` through the paho client `c`. */
+func NewMqttSink(c mqtt.Client, host string, qos byte) *MqttSink {
+	return &MqttSink{Publisher: NewPahoPublisher(c, host), Qos: qos}
+}
+
+func (s *MqttSink) Publish(m MqttCronMessage) error {
+	return s.Publisher.Publish(m.Topic, max(s.Qos, m.Qos), m.Retain, m.Payload)
+}
+
+/* Publish a single message to every sink with the topic prefixed unless the
+ * message is absolute. Retained messages whose payload did not change are
+ * skipped when a filter is given, which only records a payload once every
+ * sink took it. The message counts as published when at least one sink took
+ * it, every sink that did not counts as a failed publish. */
+func publishMessage(m MqttCronMessage, sinks []Sink, prefix string, quiet *QuietHours, retained *RetainedFilter) {
+	if quiet != nil && !quiet.Allows(m, time.Now()) {
+		return
+	}
+
+	if !m.Absolute {
+		m.Topic = PrefixTopic(prefix, m.Topic)
+	}
+
+	if retained != nil && !retained.Changed(m) {
+		messageLog.Topic(m.Topic).Debugf("MessageLoop skipped unchanged topic='%s'\n", m.Topic)
+		return
+	}
+
+	source := m.Source
+
+	if source == "" {
+		source = "magpie"
+	}
+
+	failed, published := false, false
+
+	for _, sink := range sinks {
+		err := sink.Publish(m)
+
+		if errors.Is(err, ErrBrokerOffline) {
+			messageLog.Topic(m.Topic).Debugf("MessageLoop dropped topic='%s': %s.\n", m.Topic, err)
+		} else if err != nil {
+			messageLog.Warnf("MessageLoop could not publish message to %T: %s.\n", sink, err)
+		}
+
+		if err != nil {
+			FailedPublishes.Inc(source)
+		}
+
+		failed = failed || err != nil
+		published = published || err == nil
+	}
+
+	if retained != nil && !failed {
+		retained.Record(m)
+	}
+
+	if !published {
+		return
+	}
+
+	PublishedMessages.Inc(source)
+
+	messageLog.Topic(m.Topic).Debugf("MessageLoop published topic='%s',payload='%s'\n", m.Topic, m.Payload)
+}
+
+/* Listens on a channel to submit messages to every sink with the topic
+ * prefixed. When `quiet` is given it is asked for the quiet hours in effect
+ * for every message, non-critical messages inside of them are dropped. When
+ * a retained filter is given unchanged retained messages are. Once the
+ * context is done the messages already waiting on the channel are published
+ * before returning. */
+func MessageLoop(ctx context.Context, ch chan MqttCronMessage, sinks []Sink, prefix string, quiet func() *QuietHours, retained *RetainedFilter) {
+	publish := func(m MqttCronMessage) {
+		if quiet == nil {
+			publishMessage(m, sinks, prefix, nil, retained)
+		} else {
+			publishMessage(m, sinks, prefix, quiet(), retained)
+		}
+	}
+
+	for {
+		select {
+		case m := <-ch:
+			publish(m)
+		case <-ctx.Done():
+			for {
+				select {
+				case m := <-ch:
+					publish(m)
+				default:
+					return
+				}
+			}
+		}
+	}
 }
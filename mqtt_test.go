@@ -0,0 +1,367 @@
+package magpie
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang"
+)
+
+/* A token of a publish that completed right away. */
+type doneToken struct{}
+
+func (doneToken) Wait() bool {
+	return true
+}
+
+func (doneToken) WaitTimeout(time.Duration) bool {
+	return true
+}
+
+func (doneToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+
+	return ch
+}
+
+func (doneToken) Error() error {
+	return nil
+}
+
+/* The publish of a message as the client received it. */
+type clientPublish struct {
+	Topic   string
+	Qos     byte
+	Retain  bool
+	Payload any
+}
+
+/* Records what is published through it while `connected` is set, every
+ * other method of the client is left unimplemented. */
+type recordingClient struct {
+	mqtt.Client
+
+	mu        sync.Mutex
+	connected bool
+	published []clientPublish
+}
+
+func (c *recordingClient) IsConnectionOpen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.connected
+}
+
+func (c *recordingClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.published = append(c.published, clientPublish{Topic: topic, Qos: qos, Retain: retained, Payload: payload})
+
+	return doneToken{}
+}
+
+func TestMessageLoopDrainsOnceDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ch := make(chan MqttCronMessage, 3)
+	sink := NewMemorySink()
+
+	<-ctx.Done()
+
+	for _, payload := range []string{"1", "2", "3"} {
+		ch <- MqttCronMessage{Topic: "heartbeat", Payload: payload}
+	}
+
+	MessageLoop(ctx, ch, []Sink{sink}, "", nil, nil)
+
+	if messages := sink.Messages(); len(messages) != 3 || messages[2].Payload != "3" {
+		t.Fatalf("expected the waiting messages to be published before returning, got %+v", messages)
+	}
+}
+
+func TestMqttClientOptionsApplyCredentials(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"MQTT_HOST": "tcp://127.0.0.1:1883", "MQTT_USERNAME": "magpie", "MQTT_PASSWORD": "secret"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := MqttClientOptions(config, "tcp://127.0.0.1:1883", nil)
+
+	if opts.Username != "magpie" || opts.Password != "secret" {
+		t.Fatalf("expected the credentials to be applied, got `%s` and `%s`", opts.Username, opts.Password)
+	}
+
+	if config, err = ConfigFromLookup(mapLookup(map[string]string{"MQTT_HOST": "tcp://127.0.0.1:1883"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if opts := MqttClientOptions(config, "tcp://127.0.0.1:1883", nil); opts.Username != "" || opts.Password != "" {
+		t.Fatalf("expected no credentials without them in the environment, got `%s` and `%s`", opts.Username, opts.Password)
+	}
+}
+
+func TestMqttClientOptionsRegisterWill(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"MQTT_HOST": "tcp://127.0.0.1:1883", "MQTT_PREFIX": "home"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := MqttClientOptions(config, "tcp://127.0.0.1:1883", nil)
+
+	if !opts.WillEnabled || opts.WillTopic != "home/magpie/status" || string(opts.WillPayload) != "offline" || !opts.WillRetained {
+		t.Fatalf("expected a retained `offline` will on `home/magpie/status`, got `%s` with `%s`", opts.WillTopic, opts.WillPayload)
+	}
+}
+
+func TestMqttSinkPublishesWithTheConfiguredQos(t *testing.T) {
+	client := &recordingClient{connected: true}
+	sink := NewMqttSink(client, "tcp://127.0.0.1:1883", 1)
+
+	for _, m := range []MqttCronMessage{
+		{Topic: "home/season", Payload: "winter", Retain: true},
+		{Topic: "home/magpie/status", Payload: "online", Qos: 2},
+	} {
+		if err := sink.Publish(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []clientPublish{
+		{Topic: "home/season", Qos: 1, Retain: true, Payload: "winter"},
+		{Topic: "home/magpie/status", Qos: 2, Payload: "online"},
+	}
+
+	if !reflect.DeepEqual(client.published, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, client.published)
+	}
+}
+
+func TestResolveRetain(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		expected bool
+	}{
+		{settings: map[string]string{}, expected: true},
+		{settings: map[string]string{"MQTT_RETAIN_DEFAULT": "false"}, expected: false},
+		{settings: map[string]string{"MQTT_RETAIN_DEFAULT": "false", "SEASON_RETAIN": "true"}, expected: true},
+		{settings: map[string]string{"MQTT_RETAIN_DEFAULT": "true", "SEASON_RETAIN": "0"}, expected: false},
+	} {
+		retain, err := ResolveRetain(mapLookup(c.settings), "SEASON", true)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if retain != c.expected {
+			t.Errorf("expected retain to be %t for %v, got %t", c.expected, c.settings, retain)
+		}
+	}
+
+	if _, err := ResolveRetain(mapLookup(map[string]string{"SEASON_RETAIN": "sometimes"}), "SEASON", true); err == nil {
+		t.Fatal("expected a retain that is not a boolean to be refused")
+	}
+}
+
+func TestClientId(t *testing.T) {
+	hostname := func() (string, error) {
+		return "pantry", nil
+	}
+
+	noHostname := func() (string, error) {
+		return "", errors.New("no hostname")
+	}
+
+	if id := ClientId(mapLookup(map[string]string{"MQTT_CLIENT_ID": "kitchen"}), hostname); id != "kitchen" {
+		t.Errorf("expected the client id of the environment, got `%s`", id)
+	}
+
+	if id := ClientId(mapLookup(map[string]string{"MQTT_CLIENT_ID": ""}), hostname); id != "magpie-pantry" {
+		t.Errorf("expected the hostname as suffix, got `%s`", id)
+	}
+
+	first := ClientId(mapLookup(nil), noHostname)
+	second := ClientId(mapLookup(nil), noHostname)
+
+	if !regexp.MustCompile(`^magpie-[0-9a-f]{8}$`).MatchString(first) || first == second {
+		t.Errorf("expected a random suffix without a hostname, got `%s` and `%s`", first, second)
+	}
+}
+
+func TestMqttClientOptionsReconnect(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"MQTT_HOST": "tcp://127.0.0.1:1883", "MQTT_PREFIX": "home", "MQTT_RECONNECT_INTERVAL": "30s"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := MqttClientOptions(config, "tcp://127.0.0.1:1883", nil)
+
+	if !opts.AutoReconnect || opts.MaxReconnectInterval != 30*time.Second {
+		t.Fatalf("expected to reconnect waiting at most 30s, got %t and %s", opts.AutoReconnect, opts.MaxReconnectInterval)
+	}
+
+	if opts.OnConnect == nil || opts.OnConnectionLost == nil || opts.OnReconnecting == nil {
+		t.Fatal("expected handlers for connecting, losing the connection, and reconnecting")
+	}
+
+	client := &recordingClient{connected: true}
+
+	opts.OnConnect(client)
+
+	if len(client.published) == 0 || client.published[0] != (clientPublish{Topic: "home/magpie/status", Retain: true, Payload: "online"}) {
+		t.Fatalf("expected a retained `online` on `home/magpie/status` once connected, got %+v", client.published)
+	}
+
+	sources := client.published[len(client.published)-1]
+
+	if sources.Topic != "home/magpie/sources" || !sources.Retain || string(sources.Payload.([]byte)) != `{"count":0,"sources":[]}` {
+		t.Fatalf("expected the retained active sources on `home/magpie/sources`, got %+v", sources)
+	}
+}
+
+func TestMqttClientOptionsRepublishRetainedOnReconnect(t *testing.T) {
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"MQTT_HOST": "tcp://127.0.0.1:1883"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := NewMemorySink()
+	retained := NewRetainedFilter()
+	m := MqttCronMessage{Topic: "season", Payload: "winter", Retain: true}
+
+	publishAll([]Sink{sink}, retained, m, m)
+
+	MqttClientOptions(config, "tcp://127.0.0.1:1883", retained).OnConnect(&recordingClient{connected: true})
+
+	publishAll([]Sink{sink}, retained, m, m)
+
+	if got := len(sink.Messages()); got != 2 {
+		t.Fatalf("expected the unchanged value once before and once after reconnecting, got %d", got)
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	for _, c := range []struct {
+		prefix   string
+		expected string
+	}{
+		{prefix: "", expected: ""},
+		{prefix: "/", expected: ""},
+		{prefix: "/home.arpa/", expected: "home.arpa"},
+		{prefix: "//home/garden//", expected: "home/garden"},
+		{prefix: "home.arpa", expected: "home.arpa"},
+	} {
+		if prefix := NormalizePrefix(c.prefix); prefix != c.expected {
+			t.Errorf("NormalizePrefix(%q) = %q, expected %q", c.prefix, prefix, c.expected)
+		}
+	}
+
+	if topic := PrefixTopic(NormalizePrefix(""), "weather"); topic != "weather" {
+		t.Errorf("expected no leading slash without a prefix, got `%s`", topic)
+	}
+
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Prefix != "home.arpa" {
+		t.Errorf("expected `home.arpa` by default, got `%s`", config.Prefix)
+	}
+}
+
+func TestResolvePrefix(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		expected string
+	}{
+		{settings: map[string]string{}, expected: "home.arpa"},
+		{settings: map[string]string{"WEATHER_PREFIX": "outside"}, expected: "outside"},
+		{settings: map[string]string{"WEATHER_PREFIX": "/garden/weather/"}, expected: "garden/weather"},
+		{settings: map[string]string{"WEATHER_PREFIX": ""}, expected: ""},
+		{settings: map[string]string{"DAYLIGHT_PREFIX": "outside"}, expected: "home.arpa"},
+	} {
+		if prefix := ResolvePrefix(mapLookup(c.settings), "WEATHER", "home.arpa"); prefix != c.expected {
+			t.Errorf("expected `%s` for %v, got `%s`", c.expected, c.settings, prefix)
+		}
+	}
+}
+
+func TestMessageLoopFansOutToEverySink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch := make(chan MqttCronMessage)
+	local, cloud := NewMemorySink(), NewMemorySink()
+	offline := &flakySink{down: true}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		MessageLoop(ctx, ch, []Sink{local, offline, cloud}, "home", nil, nil)
+	}()
+
+	for _, payload := range []string{"spring", "summer", "autumn"} {
+		ch <- MqttCronMessage{Topic: "season", Payload: payload, Retain: true}
+	}
+
+	cancel()
+	<-done
+
+	expected := []MqttCronMessage{
+		{Topic: "home/season", Payload: "spring", Retain: true},
+		{Topic: "home/season", Payload: "summer", Retain: true},
+		{Topic: "home/season", Payload: "autumn", Retain: true},
+	}
+
+	for name, sink := range map[string]*MemorySink{"local": local, "cloud": cloud} {
+		if messages := sink.Messages(); !reflect.DeepEqual(messages, expected) {
+			t.Errorf("expected the %s broker to receive every message, got %+v", name, messages)
+		}
+	}
+
+	if messages := offline.Messages(); len(messages) != 0 {
+		t.Errorf("expected nothing to reach the offline broker, got %+v", messages)
+	}
+}
+
+func TestMqttSinkDropsMessagesWhileOffline(t *testing.T) {
+	client := &recordingClient{connected: false}
+	sink := NewMqttSink(client, "tcp://cloud:1883", 0)
+
+	if err := sink.Publish(MqttCronMessage{Topic: "season", Payload: "winter"}); !errors.Is(err, ErrBrokerOffline) {
+		t.Fatalf("expected the broker to be offline, got %v", err)
+	}
+
+	if len(client.published) != 0 {
+		t.Fatalf("expected nothing to be published while offline, got %+v", client.published)
+	}
+}
+
+func TestBrokerHosts(t *testing.T) {
+	for _, c := range []struct {
+		settings map[string]string
+		hosts    []string
+	}{
+		{settings: map[string]string{}, hosts: nil},
+		{settings: map[string]string{"MQTT_HOST": "tcp://local:1883"}, hosts: []string{"tcp://local:1883"}},
+		{settings: map[string]string{"MQTT_HOST": "tcp://local:1883, ssl://cloud:8883,"}, hosts: []string{"tcp://local:1883", "ssl://cloud:8883"}},
+		{settings: map[string]string{"MQTT_HOST": "tcp://local:1883", "MQTT_HOSTS": "ssl://cloud:8883,tcp://local:1883"}, hosts: []string{"tcp://local:1883", "ssl://cloud:8883"}},
+	} {
+		if hosts := BrokerHosts(mapLookup(c.settings)); !reflect.DeepEqual(hosts, c.hosts) {
+			t.Errorf("BrokerHosts(%v) = %q, expected %q", c.settings, hosts, c.hosts)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/* Current conditions from the `open-meteo.com` forecast API with wind
+ * speeds in m/s, values are null when unknown. */
+type OpenMeteoAPIData struct {
+	Time                 int64    `json:"time"`
+	Temperature          *float64 `json:"temperature_2m"`
+	Humidity             *float64 `json:"relative_humidity_2m"`
+	WindSpeed            *float64 `json:"wind_speed_10m"`
+	GustSpeed            *float64 `json:"wind_gusts_10m"`
+	WindDirectionDegrees *float64 `json:"wind_direction_10m"`
+	AirPressure          *float64 `json:"pressure_msl"`
+	Rain                 *float64 `json:"precipitation"`
+	SunIntensity         *float64 `json:"shortwave_radiation"`
+}
+
+/* The forecast per day starting today, the snowfall in centimeters and the
+ * highest chance of precipitation in percent. Values are null when
+ * unknown. */
+type OpenMeteoAPIDaily struct {
+	Snowfall            []*float64 `json:"snowfall_sum"`
+	PrecipitationChance []*float64 `json:"precipitation_probability_max"`
+}
+
+/* Result from the `open-meteo.com` forecast API. */
+type OpenMeteoAPIResult struct {
+	Error   bool              `json:"error"`
+	Reason  string            `json:"reason"`
+	Current OpenMeteoAPIData  `json:"current"`
+	Daily   OpenMeteoAPIDaily `json:"daily"`
+}
+
+/* Parse a response of the `open-meteo.com` forecast API into the current
+ * conditions and the forecast per day. */
+func ParseOpenMeteo(body []byte) (OpenMeteoAPIResult, error) {
+	var apiResult OpenMeteoAPIResult
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return OpenMeteoAPIResult{}, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if apiResult.Error {
+		return OpenMeteoAPIResult{}, fmt.Errorf("the response was an error: %s", apiResult.Reason)
+	}
+
+	return apiResult, nil
+}
+
+/* The snow forecast metrics of tomorrow, nothing when the forecast has no
+ * snowfall for it. */
+func OpenMeteoSnowMetrics(daily OpenMeteoAPIDaily) []Metric {
+	if len(daily.Snowfall) < 2 || daily.Snowfall[1] == nil {
+		return nil
+	}
+
+	if len(daily.PrecipitationChance) < 2 || daily.PrecipitationChance[1] == nil {
+		return []Metric{{Name: "snowfall", Value: strconv.FormatFloat(*daily.Snowfall[1], 'f', -1, 64)}}
+	}
+
+	return SnowForecastMetrics(*daily.Snowfall[1], *daily.PrecipitationChance[1])
+}
+
+/* Map the current conditions to the metrics of the weather source, values
+ * that are missing are left out. The wind direction arrow is included when
+ * `arrow` is set. */
+func OpenMeteoMetrics(current OpenMeteoAPIData, arrow bool) []Metric {
+	var metrics []Metric
+
+	for _, field := range []struct {
+		name  string
+		value *float64
+	}{
+		{"humidity", current.Humidity},
+		{"temperature.ground", current.Temperature},
+		{"wind", current.WindSpeed},
+		{"gust", current.GustSpeed},
+		{"wind.arrow", current.WindDirectionDegrees},
+		{"wind.direction.degrees", current.WindDirectionDegrees},
+		{"pressure", current.AirPressure},
+		{"rain", current.Rain},
+		{"sun", current.SunIntensity},
+	} {
+		if field.value == nil || (field.name == "wind.arrow" && !arrow) {
+			continue
+		}
+
+		value := strconv.FormatFloat(*field.value, 'f', -1, 64)
+
+		if field.name == "wind.arrow" {
+			value = WindArrow(*field.value)
+		}
+
+		metrics = append(metrics, Metric{Name: field.name, Value: value})
+	}
+
+	return metrics
+}
+
+/* Provides the current conditions and the snow forecast of tomorrow at
+ * `Coordinates` from `open-meteo.com`, which covers the whole world. */
+type OpenMeteoProvider struct {
+	Topic       string
+	Coordinates Coordinates
+	Arrow       bool
+}
+
+func (p *OpenMeteoProvider) Readings(ctx context.Context) ([]WeatherReading, error) {
+	apiUrl := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%f&longitude=%f&current=temperature_2m,relative_humidity_2m,wind_speed_10m,wind_gusts_10m,wind_direction_10m,pressure_msl,precipitation,shortwave_radiation&daily=snowfall_sum,precipitation_probability_max&forecast_days=2&wind_speed_unit=ms&timeformat=unixtime", p.Coordinates.Latitude, p.Coordinates.Longitude)
+
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	apiResult, err := ParseOpenMeteo(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	current := apiResult.Current
+
+	reading := WeatherReading{Topic: p.Topic, Station: "openmeteo", Metrics: append(OpenMeteoMetrics(current, p.Arrow), OpenMeteoSnowMetrics(apiResult.Daily)...)}
+
+	if current.Time != 0 {
+		reading.Time = time.Unix(current.Time, 0).UTC()
+		reading.Metrics = append(reading.Metrics, Metric{Name: "timestamp", Value: reading.Time.Format(time.RFC3339)})
+	}
+
+	return []WeatherReading{reading}, nil
+}
@@ -0,0 +1,51 @@
+package magpie
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseOpenMeteo(t *testing.T) {
+	body, err := os.ReadFile("testdata/openmeteo.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiResult, err := ParseOpenMeteo(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Metric{
+		{Name: "humidity", Value: "91"},
+		{Name: "temperature.ground", Value: "-1.5"},
+		{Name: "wind", Value: "3.2"},
+		{Name: "gust", Value: "7.9"},
+		{Name: "wind.direction.degrees", Value: "225"},
+		{Name: "pressure", Value: "1012.4"},
+		{Name: "rain", Value: "0.2"},
+	}
+
+	if metrics := OpenMeteoMetrics(apiResult.Current, false); !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("expected %+v, got %+v", expected, metrics)
+	}
+
+	if metrics := OpenMeteoSnowMetrics(apiResult.Daily); !reflect.DeepEqual(metrics, []Metric{{Name: "snowfall", Value: "2.1"}, {Name: "snow.chance", Value: "85"}}) {
+		t.Errorf("expected the snow forecast of tomorrow, got %+v", metrics)
+	}
+}
+
+func TestParseOpenMeteoError(t *testing.T) {
+	if _, err := ParseOpenMeteo([]byte(`{"error": true, "reason": "Latitude must be in range"}`)); err == nil {
+		t.Fatal("expected an error response to be an error")
+	}
+}
+
+func TestOpenMeteoSnowMetricsWithoutForecast(t *testing.T) {
+	if metrics := OpenMeteoSnowMetrics(OpenMeteoAPIDaily{}); metrics != nil {
+		t.Fatalf("expected nothing without a forecast, got %+v", metrics)
+	}
+}
@@ -0,0 +1,156 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var pollenLog = NewLogger("pollen")
+
+/* Current pollen concentrations in grains per cubic meter from the
+ * `open-meteo.com` air quality API, values are null outside of the
+ * covered area. */
+type PollenAPIData struct {
+	Alder   *float64 `json:"alder_pollen"`
+	Birch   *float64 `json:"birch_pollen"`
+	Grass   *float64 `json:"grass_pollen"`
+	Mugwort *float64 `json:"mugwort_pollen"`
+	Olive   *float64 `json:"olive_pollen"`
+	Ragweed *float64 `json:"ragweed_pollen"`
+}
+
+/* Result from the `open-meteo.com` air quality API. */
+type PollenAPIResult struct {
+	Error   bool          `json:"error"`
+	Reason  string        `json:"reason"`
+	Current PollenAPIData `json:"current"`
+}
+
+/* Concentration of a group of allergens and the thresholds in grains per
+ * cubic meter above which it is considered moderate and high. */
+type PollenLevel struct {
+	Allergen      string
+	Concentration float64
+	Moderate      float64
+	High          float64
+}
+
+/* The category of the concentration, `low`, `moderate`, or `high`. */
+func (l PollenLevel) Category() string {
+	switch {
+	case l.Concentration >= l.High:
+		return "high"
+	case l.Concentration >= l.Moderate:
+		return "moderate"
+	default:
+		return "low"
+	}
+}
+
+/* Sum the concentrations that are present, reports false when none are. */
+func sumPollen(values ...*float64) (float64, bool) {
+	var sum float64
+	var present bool
+
+	for _, value := range values {
+		if value != nil {
+			sum += *value
+			present = true
+		}
+	}
+
+	return sum, present
+}
+
+/* Parse a response of the `open-meteo.com` air quality API into the levels
+ * of grass, tree, and weed pollen. Allergens without data are left out. */
+func ParsePollen(body []byte) ([]PollenLevel, error) {
+	var apiResult PollenAPIResult
+	var levels []PollenLevel
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return nil, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if apiResult.Error {
+		return nil, fmt.Errorf("the response was an error: %s", apiResult.Reason)
+	}
+
+	current := apiResult.Current
+
+	if grass, present := sumPollen(current.Grass); present {
+		levels = append(levels, PollenLevel{Allergen: "grass", Concentration: grass, Moderate: 5, High: 20})
+	}
+
+	if tree, present := sumPollen(current.Alder, current.Birch, current.Olive); present {
+		levels = append(levels, PollenLevel{Allergen: "tree", Concentration: tree, Moderate: 15, High: 90})
+	}
+
+	if weed, present := sumPollen(current.Mugwort, current.Ragweed); present {
+		levels = append(levels, PollenLevel{Allergen: "weed", Concentration: weed, Moderate: 10, High: 50})
+	}
+
+	return levels, nil
+}
+
+/* Call the `open-meteo.com` air quality API and return the pollen levels. */
+func PollenAPICall(ctx context.Context, apiUrl string) ([]PollenLevel, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePollen(body)
+}
+
+/* A loop that waits between calls to the `open-meteo.com` air quality API
+ * and submits the pollen concentration and category per allergen to
+ * subtopics of the topic given in the environment variable
+ * `POLLEN_TOPIC`. */
+func PollenLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	if errors.Is(cfg.CoordinatesErr, ErrCoordinatesMissing) {
+		pollenLog.Println("PollenLoop needs `POLLEN_LATITUDE` and `POLLEN_LONGITUDE`, or `MAGPIE_LATITUDE` and `MAGPIE_LONGITUDE`, set in the environment, disabled.")
+		return
+	}
+
+	if cfg.CoordinatesErr != nil {
+		pollenLog.Warnf("PollenLoop could not use its coordinates: %s, disabled.\n", cfg.CoordinatesErr)
+		return
+	}
+
+	pollenLog.Println("PollenLoop enabled.")
+
+	apiUrl := fmt.Sprintf("https://air-quality-api.open-meteo.com/v1/air-quality?latitude=%f&longitude=%f&current=alder_pollen,birch_pollen,grass_pollen,mugwort_pollen,olive_pollen,ragweed_pollen", cfg.Coordinates.Latitude, cfg.Coordinates.Longitude)
+
+	for {
+		var levels []PollenLevel
+
+		if !fetchWithRetry(ctx, cfg, pollenLog, "PollenLoop could not fetch the pollen", func() error {
+			var err error
+
+			levels, err = PollenAPICall(ctx, apiUrl)
+
+			return err
+		}) {
+			return
+		}
+
+		for _, level := range levels {
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, level.Allergen), Payload: strconv.FormatFloat(level.Concentration, 'f', -1, 64)}) {
+				return
+			}
+
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, level.Allergen+".category"), Payload: level.Category()}) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
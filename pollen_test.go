@@ -0,0 +1,72 @@
+package magpie
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParsePollen(t *testing.T) {
+	body, err := os.ReadFile("testdata/pollen.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	levels, err := ParsePollen(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var concentrations []float64
+	var categories []string
+
+	for _, level := range levels {
+		concentrations = append(concentrations, level.Concentration)
+		categories = append(categories, level.Allergen+"="+level.Category())
+	}
+
+	if !reflect.DeepEqual(concentrations, []float64{23.5, 16.75, 0.5}) {
+		t.Errorf("expected the concentrations of grass, tree, and weed, got %v", concentrations)
+	}
+
+	if !reflect.DeepEqual(categories, []string{"grass=high", "tree=moderate", "weed=low"}) {
+		t.Errorf("expected high grass, moderate tree, and low weed, got %v", categories)
+	}
+}
+
+func TestParsePollenOutsideCoverage(t *testing.T) {
+	levels, err := ParsePollen([]byte(`{"current":{"alder_pollen":null,"birch_pollen":null,"grass_pollen":null,"mugwort_pollen":null,"olive_pollen":null,"ragweed_pollen":null}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(levels) != 0 {
+		t.Fatalf("expected no levels without data, got %+v", levels)
+	}
+
+	if _, err := ParsePollen([]byte(`{"error":true,"reason":"Latitude must be in range"}`)); err == nil {
+		t.Fatal("expected an error response to be an error")
+	}
+}
+
+func TestPollenLevelCategory(t *testing.T) {
+	for _, c := range []struct {
+		concentration float64
+		category      string
+	}{
+		{concentration: 0, category: "low"},
+		{concentration: 4.9, category: "low"},
+		{concentration: 5, category: "moderate"},
+		{concentration: 19.9, category: "moderate"},
+		{concentration: 20, category: "high"},
+	} {
+		level := PollenLevel{Allergen: "grass", Concentration: c.concentration, Moderate: 5, High: 20}
+
+		if category := level.Category(); category != c.category {
+			t.Errorf("expected %v grains to be %s, got %s", c.concentration, c.category, category)
+		}
+	}
+}
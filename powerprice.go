@@ -0,0 +1,201 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var powerPriceLog = NewLogger("powerprice")
+
+/* Day-ahead prices of the next day are published shortly before 13:00 in
+ * the timezone of the European power market. */
+var powerPriceMarket, _ = time.LoadLocation("Europe/Brussels")
+
+const powerPricePublishHour = 13
+
+/* Result from the `energy-charts.info` price API, `Price` holds the price
+ * in `Unit` of the period starting at the same index in `UnixSeconds`. */
+type PowerPriceAPIResult struct {
+	UnixSeconds []int64    `json:"unix_seconds"`
+	Price       []*float64 `json:"price"`
+	Unit        string     `json:"unit"`
+}
+
+/* The day-ahead price in EUR/MWh of the period starting at `Start`. */
+type PowerPrice struct {
+	Start time.Time
+	Price float64
+}
+
+/* Parse a response of the `energy-charts.info` price API into prices in
+ * order of their start, periods without a price are left out. */
+func ParsePowerPrices(body []byte) ([]PowerPrice, error) {
+	var apiResult PowerPriceAPIResult
+	var prices []PowerPrice
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return nil, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if len(apiResult.UnixSeconds) != len(apiResult.Price) {
+		return nil, fmt.Errorf("the response has %d periods but %d prices", len(apiResult.UnixSeconds), len(apiResult.Price))
+	}
+
+	if apiResult.Unit != "" && apiResult.Unit != "EUR / MWh" {
+		return nil, fmt.Errorf("the response has prices in `%s`, expected `EUR / MWh`", apiResult.Unit)
+	}
+
+	for idx, start := range apiResult.UnixSeconds {
+		if apiResult.Price[idx] != nil {
+			prices = append(prices, PowerPrice{Start: time.Unix(start, 0).UTC(), Price: *apiResult.Price[idx]})
+		}
+	}
+
+	return prices, nil
+}
+
+/* Average the prices of periods starting within the hour that starts at
+ * `start`, reports false when there are none. */
+func powerPriceForHour(prices []PowerPrice, start time.Time) (float64, bool) {
+	var sum float64
+	var count int
+
+	end := start.Add(time.Hour)
+
+	for _, price := range prices {
+		if !price.Start.Before(start) && price.Start.Before(end) {
+			sum += price.Price
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0, false
+	}
+
+	return sum / float64(count), true
+}
+
+/* The price of the hour `t` falls in, prices of quarter hours are
+ * averaged. */
+func PowerPriceAt(prices []PowerPrice, t time.Time) (float64, bool) {
+	return powerPriceForHour(prices, t.Truncate(time.Hour))
+}
+
+/* The price of every hour of the day `t` falls in, in the location of `t`.
+ * Hours without a price are nil, and days on which daylight saving time
+ * starts or ends have 23 or 25 hours. */
+func HourlyPowerPrices(prices []PowerPrice, t time.Time) []*float64 {
+	var hourly []*float64
+
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := start.AddDate(0, 0, 1)
+
+	for hour := start; hour.Before(end); hour = hour.Add(time.Hour) {
+		if price, exists := powerPriceForHour(prices, hour); exists {
+			hourly = append(hourly, &price)
+		} else {
+			hourly = append(hourly, nil)
+		}
+	}
+
+	return hourly
+}
+
+/* Determine if the prices have to be fetched again, either because they
+ * do not cover the current hour or because the prices of the next day
+ * should be published by now. */
+func PowerPriceNeedsFetch(prices []PowerPrice, now time.Time) bool {
+	if _, exists := PowerPriceAt(prices, now); !exists {
+		return true
+	}
+
+	market := now.In(powerPriceMarket)
+
+	if market.Hour() < powerPricePublishHour {
+		return false
+	}
+
+	tomorrow := time.Date(market.Year(), market.Month(), market.Day()+1, 0, 0, 0, 0, powerPriceMarket)
+
+	_, exists := PowerPriceAt(prices, tomorrow)
+
+	return !exists
+}
+
+/* Call the `energy-charts.info` price API for the bidding `zone` and return
+ * the prices of today and, once published, tomorrow. */
+func PowerPriceAPICall(ctx context.Context, zone string, now time.Time) ([]PowerPrice, error) {
+	market := now.In(powerPriceMarket)
+
+	apiUrl := fmt.Sprintf("https://api.energy-charts.info/price?bzn=%s&start=%s&end=%s", url.QueryEscape(zone), market.Format("2006-01-02"), market.AddDate(0, 0, 1).Format("2006-01-02"))
+
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePowerPrices(body)
+}
+
+/* A loop that submits the day-ahead electricity price of the current hour
+ * in EUR/MWh to the topic given in the environment variable
+ * `POWERPRICE_TOPIC`, and every hourly price of today as a JSON array to
+ * `<topic>/today`. Prices are only fetched again when they run out or when
+ * the prices of the next day are published. */
+func PowerPriceLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	zone := cfg.Get("POWERPRICE_ZONE")
+
+	if zone == "" {
+		powerPriceLog.Println("PowerPriceLoop needs `POWERPRICE_ZONE` to be a bidding zone such as `NL` or `DE-LU`, disabled.")
+		return
+	}
+
+	powerPriceLog.Println("PowerPriceLoop enabled.")
+
+	var prices []PowerPrice
+
+	for {
+		now := cfg.Now().In(cfg.Location)
+
+		if PowerPriceNeedsFetch(prices, now) {
+			if !fetchWithRetry(ctx, cfg, powerPriceLog, "PowerPriceLoop could not fetch the prices", func() error {
+				var err error
+
+				prices, err = PowerPriceAPICall(ctx, zone, now)
+
+				return err
+			}) {
+				return
+			}
+		}
+
+		if price, exists := PowerPriceAt(prices, now); exists {
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: strconv.FormatFloat(price, 'f', -1, 64)}) {
+				return
+			}
+
+			today, err := json.Marshal(HourlyPowerPrices(prices, now))
+
+			if err != nil {
+				powerPriceLog.Warnf("PowerPriceLoop could not serialize the prices: %s, disabled.\n", err)
+				return
+			}
+
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "today"), Payload: string(today)}) {
+				return
+			}
+		} else {
+			powerPriceLog.Warnln("PowerPriceLoop has no price for the current hour, skipping interval.")
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package magpie
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func parsePowerPriceFixture(t *testing.T) []PowerPrice {
+	t.Helper()
+
+	body, err := os.ReadFile("testdata/powerprice.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prices, err := ParsePowerPrices(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return prices
+}
+
+func TestParsePowerPrices(t *testing.T) {
+	prices := parsePowerPriceFixture(t)
+
+	if len(prices) != 6 {
+		t.Fatalf("expected the 6 quarter hours with a price, got %d", len(prices))
+	}
+
+	if first := prices[0]; !first.Start.Equal(time.Date(2026, 6, 20, 22, 0, 0, 0, time.UTC)) || first.Price != 80.5 {
+		t.Fatalf("expected 80.5 from 22:00 UTC, got %+v", first)
+	}
+
+	for _, body := range []string{
+		`{"unix_seconds": [1781992800], "price": [], "unit": "EUR / MWh"}`,
+		`{"unix_seconds": [1781992800], "price": [80.5], "unit": "EUR / kWh"}`,
+		`{"unix_seconds": `,
+	} {
+		if _, err := ParsePowerPrices([]byte(body)); err == nil {
+			t.Errorf("expected %s to be refused", body)
+		}
+	}
+}
+
+func TestPowerPriceAtAveragesQuarterHours(t *testing.T) {
+	prices := parsePowerPriceFixture(t)
+
+	for _, c := range []struct {
+		at     time.Time
+		price  float64
+		exists bool
+	}{
+		{at: time.Date(2026, 6, 20, 22, 40, 0, 0, time.UTC), price: 83.5, exists: true},
+		{at: time.Date(2026, 6, 20, 23, 59, 0, 0, time.UTC), price: 95, exists: true},
+		{at: time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC), exists: false},
+	} {
+		if price, exists := PowerPriceAt(prices, c.at); price != c.price || exists != c.exists {
+			t.Errorf("PowerPriceAt(%s) = %.2f, %t, expected %.2f, %t", c.at, price, exists, c.price, c.exists)
+		}
+	}
+
+	hourly := HourlyPowerPrices(prices, time.Date(2026, 6, 21, 12, 0, 0, 0, powerPriceMarket))
+
+	if len(hourly) != 24 || hourly[0] == nil || *hourly[0] != 83.5 || hourly[1] == nil || *hourly[1] != 95 || hourly[2] != nil {
+		t.Fatalf("expected 24 hours of which the first 2 have a price, got %d", len(hourly))
+	}
+}
+
+func TestPowerPriceNeedsFetch(t *testing.T) {
+	prices := parsePowerPriceFixture(t)
+
+	for _, c := range []struct {
+		at    time.Time
+		fetch bool
+	}{
+		{at: time.Date(2026, 6, 20, 22, 30, 0, 0, time.UTC), fetch: false},
+		{at: time.Date(2026, 6, 21, 2, 0, 0, 0, time.UTC), fetch: true},
+	} {
+		if fetch := PowerPriceNeedsFetch(prices, c.at); fetch != c.fetch {
+			t.Errorf("PowerPriceNeedsFetch(%s) = %t, expected %t", c.at, fetch, c.fetch)
+		}
+	}
+
+	today := []PowerPrice{
+		{Start: time.Date(2026, 6, 21, 10, 0, 0, 0, time.UTC), Price: 35},
+		{Start: time.Date(2026, 6, 21, 11, 0, 0, 0, time.UTC), Price: 40},
+	}
+
+	if PowerPriceNeedsFetch(today, time.Date(2026, 6, 21, 10, 30, 0, 0, time.UTC)) {
+		t.Error("expected no fetch before 13:00 in Brussels while the hour has a price")
+	}
+
+	if !PowerPriceNeedsFetch(today, time.Date(2026, 6, 21, 11, 30, 0, 0, time.UTC)) {
+		t.Error("expected the prices of tomorrow to be fetched after 13:00 in Brussels")
+	}
+}
@@ -0,0 +1,35 @@
+package magpie
+
+import (
+	"fmt"
+
+	"github.com/eclipse/paho.mqtt.golang"
+)
+
+/* Publishes a payload to a topic of an MQTT broker, `MqttSink` publishes
+ * through one so the flow of messages does not depend on paho. */
+type Publisher interface {
+	Publish(topic string, qos byte, retain bool, payload string) error
+}
+
+/* Publishes through a paho client to the broker at `Host`, returns
+ * `ErrBrokerOffline` while the client is not connected. */
+type PahoPublisher struct {
+	Client mqtt.Client
+	Host   string
+}
+
+func NewPahoPublisher(c mqtt.Client, host string) *PahoPublisher {
+	return &PahoPublisher{Client: c, Host: host}
+}
+
+func (p *PahoPublisher) Publish(topic string, qos byte, retain bool, payload string) error {
+	if !p.Client.IsConnectionOpen() {
+		return fmt.Errorf("%w `%s`", ErrBrokerOffline, p.Host)
+	}
+
+	token := p.Client.Publish(topic, qos, retain, payload)
+	token.Wait()
+
+	return token.Error()
+}
@@ -0,0 +1,88 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+/* A single call to `Publish` of a publisher. */
+type publication struct {
+	Topic   string
+	Qos     byte
+	Retain  bool
+	Payload string
+}
+
+/* Records every publish instead of sending it to a broker. */
+type recordingPublisher struct {
+	mu           sync.Mutex
+	publications []publication
+}
+
+func (p *recordingPublisher) Publish(topic string, qos byte, retain bool, payload string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.publications = append(p.publications, publication{Topic: topic, Qos: qos, Retain: retain, Payload: payload})
+
+	return nil
+}
+
+func (p *recordingPublisher) Publications() []publication {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]publication(nil), p.publications...)
+}
+
+func TestMessageLoopPublishesThroughThePublisher(t *testing.T) {
+	now := time.Now().UTC()
+
+	quiet, err := ParseQuietHours(fmt.Sprintf("%s-%s", now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04")), time.UTC)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		quiet    *QuietHours
+		expected []publication
+	}{
+		{quiet: nil, expected: []publication{
+			{Topic: "home/weather/temperature", Qos: 1, Payload: "12.5"},
+			{Topic: "home/season", Qos: 1, Retain: true, Payload: "autumn"},
+			{Topic: "homeassistant/sensor/magpie/config", Qos: 1, Retain: true, Payload: "{}"},
+			{Topic: "home/magpie/status", Qos: 2, Retain: true, Payload: "online"},
+		}},
+		{quiet: &quiet, expected: []publication{
+			{Topic: "home/magpie/status", Qos: 2, Retain: true, Payload: "online"},
+		}},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		ch := make(chan MqttCronMessage)
+		publisher := &recordingPublisher{}
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			MessageLoop(ctx, ch, []Sink{&MqttSink{Publisher: publisher, Qos: 1}}, "home", NewCurrentQuietHours(c.quiet).Get, nil)
+		}()
+
+		ch <- MqttCronMessage{Topic: "weather/temperature", Payload: "12.5"}
+		ch <- MqttCronMessage{Topic: "season", Payload: "autumn", Retain: true}
+		ch <- MqttCronMessage{Topic: "homeassistant/sensor/magpie/config", Payload: "{}", Retain: true, Absolute: true}
+		ch <- MqttCronMessage{Topic: "magpie/status", Payload: "online", Retain: true, Critical: true, Qos: 2}
+
+		cancel()
+		<-done
+
+		if publications := publisher.Publications(); !reflect.DeepEqual(publications, c.expected) {
+			t.Errorf("expected %+v with quiet hours %v, got %+v", c.expected, c.quiet, publications)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var quakeLog = NewLogger("quake")
+
+/* Every earthquake of the past week as recorded by the USGS. */
+const quakeFeedUrl = "https://earthquake.usgs.gov/earthquakes/feed/v1.0/summary/all_week.geojson"
+
+/* Properties of an earthquake in the USGS GeoJSON feed, `Time` is in
+ * milliseconds since the epoch and `Mag` is null when not determined. */
+type QuakeAPIProperties struct {
+	Mag   *float64 `json:"mag"`
+	Place string   `json:"place"`
+	Time  int64    `json:"time"`
+}
+
+/* Location of an earthquake as longitude, latitude, and depth. */
+type QuakeAPIGeometry struct {
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type QuakeAPIFeature struct {
+	Properties QuakeAPIProperties `json:"properties"`
+	Geometry   QuakeAPIGeometry   `json:"geometry"`
+}
+
+/* Result from the USGS GeoJSON feed. */
+type QuakeAPIResult struct {
+	Features []QuakeAPIFeature `json:"features"`
+}
+
+/* An earthquake of `Magnitude` at `Time` near `Place`. */
+type Quake struct {
+	Magnitude   float64
+	Place       string
+	Time        time.Time
+	Coordinates Coordinates
+}
+
+/* Parse the USGS GeoJSON feed into earthquakes, events without a magnitude
+ * or location are left out. */
+func ParseQuakes(body []byte) ([]Quake, error) {
+	var apiResult QuakeAPIResult
+	var quakes []Quake
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return nil, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	for _, feature := range apiResult.Features {
+		if feature.Properties.Mag == nil || len(feature.Geometry.Coordinates) < 2 {
+			continue
+		}
+
+		quakes = append(quakes, Quake{
+			Magnitude:   *feature.Properties.Mag,
+			Place:       feature.Properties.Place,
+			Time:        time.UnixMilli(feature.Properties.Time).UTC(),
+			Coordinates: Coordinates{Latitude: feature.Geometry.Coordinates[1], Longitude: feature.Geometry.Coordinates[0]},
+		})
+	}
+
+	return quakes, nil
+}
+
+/* The most recent earthquake of at least `minMagnitude` within `radiusKm`
+ * of `center`, reports false when there is none. */
+func LatestQuake(quakes []Quake, center Coordinates, radiusKm float64, minMagnitude float64) (Quake, bool) {
+	var latest Quake
+	var found bool
+
+	for _, quake := range quakes {
+		if quake.Magnitude < minMagnitude || DistanceKm(center, quake.Coordinates) > radiusKm {
+			continue
+		}
+
+		if !found || quake.Time.After(latest.Time) {
+			latest = quake
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+/* Call the USGS GeoJSON feed and return the earthquakes of the past
+ * week. */
+func QuakeAPICall(ctx context.Context, apiUrl string) ([]Quake, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseQuakes(body)
+}
+
+/* Parse a non-negative number setting of the quake source. */
+func quakeSettingFromEnv(cfg SourceConfig, name string) (float64, error) {
+	valueFromEnv := cfg.Get(name)
+
+	value, err := strconv.ParseFloat(valueFromEnv, 64)
+
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("could not use `%s='%s'`, expected a non-negative number", name, valueFromEnv)
+	}
+
+	return value, nil
+}
+
+/* Read and check the radius in km and the minimum magnitude of the quake
+ * source. */
+func quakeSettingsFromConfig(cfg SourceConfig) (float64, float64, error) {
+	radius, err := quakeSettingFromEnv(cfg, "QUAKE_RADIUS_KM")
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	minMagnitude, err := quakeSettingFromEnv(cfg, "QUAKE_MIN_MAGNITUDE")
+
+	return radius, minMagnitude, err
+}
+
+/* A loop that waits between calls to the USGS GeoJSON feed and submits the
+ * magnitude, place, and time of the most recent earthquake near the
+ * coordinates to subtopics of the topic given in the environment variable
+ * `QUAKE_TOPIC`. */
+func QuakeLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	if errors.Is(cfg.CoordinatesErr, ErrCoordinatesMissing) {
+		quakeLog.Println("QuakeLoop needs `QUAKE_LATITUDE` and `QUAKE_LONGITUDE`, or `MAGPIE_LATITUDE` and `MAGPIE_LONGITUDE`, set in the environment, disabled.")
+		return
+	}
+
+	if cfg.CoordinatesErr != nil {
+		quakeLog.Warnf("QuakeLoop could not use its coordinates: %s, disabled.\n", cfg.CoordinatesErr)
+		return
+	}
+
+	radius, minMagnitude, err := quakeSettingsFromConfig(cfg)
+
+	if err != nil {
+		quakeLog.Warnf("QuakeLoop %s, disabled.\n", err)
+		return
+	}
+
+	quakeLog.Println("QuakeLoop enabled.")
+
+	for {
+		var quakes []Quake
+
+		if !fetchWithRetry(ctx, cfg, quakeLog, "QuakeLoop could not fetch the earthquakes", func() error {
+			var err error
+
+			quakes, err = QuakeAPICall(ctx, quakeFeedUrl)
+
+			return err
+		}) {
+			return
+		}
+
+		if quake, found := LatestQuake(quakes, cfg.Coordinates, radius, minMagnitude); found {
+			msgs := []MqttCronMessage{
+				{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "magnitude"), Payload: strconv.FormatFloat(quake.Magnitude, 'f', -1, 64)},
+				{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "place"), Payload: quake.Place},
+				{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "time"), Payload: quake.Time.Format(time.RFC3339)},
+			}
+
+			for _, m := range msgs {
+				if !sendMessage(ctx, ch, m) {
+					return
+				}
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
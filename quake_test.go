@@ -0,0 +1,58 @@
+package magpie
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseQuakes(t *testing.T) {
+	body, err := os.ReadFile("testdata/quakes.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quakes, err := ParseQuakes(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quakes) != 4 {
+		t.Fatalf("expected the 4 quakes with a magnitude, got %d", len(quakes))
+	}
+
+	expected := Quake{Magnitude: 2.1, Place: "3 km SW of Garmerwolde, Netherlands", Time: time.UnixMilli(1781870400000).UTC(), Coordinates: Coordinates{Latitude: 53.23, Longitude: 6.62}}
+
+	if quakes[0] != expected {
+		t.Fatalf("expected %+v, got %+v", expected, quakes[0])
+	}
+
+	groningen := Coordinates{Latitude: 53.22, Longitude: 6.57}
+
+	for _, c := range []struct {
+		radiusKm     float64
+		minMagnitude float64
+		place        string
+	}{
+		{radiusKm: 50, minMagnitude: 1, place: "Westeremden, Netherlands"},
+		{radiusKm: 50, minMagnitude: 2, place: "3 km SW of Garmerwolde, Netherlands"},
+		{radiusKm: 300, minMagnitude: 2.5, place: "2 km N of Roermond, Netherlands"},
+		{radiusKm: 10, minMagnitude: 3, place: ""},
+	} {
+		var place string
+
+		if quake, found := LatestQuake(quakes, groningen, c.radiusKm, c.minMagnitude); found {
+			place = quake.Place
+		}
+
+		if place != c.place {
+			t.Errorf("expected `%s` within %.0fkm from magnitude %.1f, got `%s`", c.place, c.radiusKm, c.minMagnitude, place)
+		}
+	}
+
+	if _, err := ParseQuakes([]byte(`{"features": {}}`)); err == nil {
+		t.Fatal("expected a malformed response to be refused")
+	}
+}
@@ -0,0 +1,96 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+/* What happens to a message submitted while the queue is full. */
+type QueuePolicy string
+
+const (
+	/* The source waits until the queue has room again. */
+	QueueBlock QueuePolicy = "block"
+
+	/* The oldest queued message makes room, the source carries on. */
+	QueueDropOldest QueuePolicy = "drop-oldest"
+)
+
+/* Messages dropped from a full queue per source. */
+var DroppedMessages = NewCounters()
+
+/* Parse a queue policy, which is one of `block` or `drop-oldest`. */
+func ParseQueuePolicy(value string) (QueuePolicy, error) {
+	switch policy := QueuePolicy(value); policy {
+	case QueueBlock, QueueDropOldest:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("could not parse `%s` as queue policy, expected `block` or `drop-oldest`", value)
+	}
+}
+
+/* Parse the size of the queue through `lookup`, falling back to its
+ * default. */
+func queueSizeFromEnv(lookup func(string) (string, bool)) (int, error) {
+	sizeFromEnv, sizeExists := lookup("MQTT_QUEUE_SIZE")
+
+	if !sizeExists {
+		sizeFromEnv = EnvDefault("MQTT_QUEUE_SIZE")
+	}
+
+	size, err := strconv.Atoi(sizeFromEnv)
+
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("could not parse `MQTT_QUEUE_SIZE='%s'`, expected a non-negative number", sizeFromEnv)
+	}
+
+	return size, nil
+}
+
+/* Count and log a message dropped from a full queue. */
+func dropMessage(m MqttCronMessage) {
+	source := m.Source
+
+	if source == "" {
+		source = "magpie"
+	}
+
+	DroppedMessages.Inc(source)
+	messageLog.Warnf("QueueLoop dropped topic='%s' of a full queue.\n", m.Topic)
+}
+
+/* Move messages from `in` onto `out` until the context is done, `out` is
+ * buffered to the size of the queue. When it is full a source blocks or
+ * the oldest queued message is dropped, depending on `policy`. Only this
+ * loop sends on `out`, so a dropped message always makes room. */
+func QueueLoop(ctx context.Context, in chan MqttCronMessage, out chan MqttCronMessage, policy QueuePolicy) {
+	for {
+		select {
+		case m := <-in:
+			if policy == QueueBlock {
+				select {
+				case out <- m:
+				case <-ctx.Done():
+					return
+				}
+
+				continue
+			}
+
+			select {
+			case out <- m:
+			default:
+				select {
+				case oldest := <-out:
+					dropMessage(oldest)
+				default:
+				}
+
+				out <- m
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package magpie
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* Run `QueueLoop` with `policy` onto a queue of `size` that nothing reads
+ * from, as if the publisher is stuck. */
+func blockedQueue(policy QueuePolicy, size int) (chan MqttCronMessage, chan MqttCronMessage, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	in := make(chan MqttCronMessage)
+	out := make(chan MqttCronMessage, size)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		QueueLoop(ctx, in, out, policy)
+	}()
+
+	return in, out, func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestQueueLoopDropsTheOldestWhileBlocked(t *testing.T) {
+	before := DroppedMessages.Counts()["queue-drop-oldest"]
+
+	buffer, restore := captureLog()
+	defer restore()
+
+	in, out, stop := blockedQueue(QueueDropOldest, 2)
+
+	for _, payload := range []string{"1", "2", "3", "4", "5"} {
+		select {
+		case in <- MqttCronMessage{Source: "queue-drop-oldest", Topic: "heartbeat", Payload: payload}:
+		case <-time.After(time.Second):
+			t.Fatalf("expected message %s to be taken while the publisher is blocked", payload)
+		}
+	}
+
+	stop()
+	restore()
+
+	var payloads []string
+
+	for len(out) > 0 {
+		payloads = append(payloads, (<-out).Payload)
+	}
+
+	if strings.Join(payloads, ",") != "4,5" {
+		t.Fatalf("expected the newest messages 4 and 5 to be queued, got %v", payloads)
+	}
+
+	if dropped := DroppedMessages.Counts()["queue-drop-oldest"] - before; dropped != 3 {
+		t.Fatalf("expected 3 dropped messages, got %d", dropped)
+	}
+
+	if count := strings.Count(buffer.String(), "QueueLoop dropped topic='heartbeat'"); count != 3 {
+		t.Fatalf("expected every dropped message to be logged, got %q", buffer.String())
+	}
+}
+
+func TestQueueLoopBlocksTheSourceWhileBlocked(t *testing.T) {
+	before := DroppedMessages.Counts()["queue-block"]
+
+	in, out, stop := blockedQueue(QueueBlock, 2)
+	defer stop()
+
+	for _, payload := range []string{"1", "2", "3"} {
+		in <- MqttCronMessage{Source: "queue-block", Topic: "heartbeat", Payload: payload}
+	}
+
+	select {
+	case in <- MqttCronMessage{Source: "queue-block", Topic: "heartbeat", Payload: "4"}:
+		t.Fatal("expected the source to wait while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if m := <-out; m.Payload != "1" {
+		t.Fatalf("expected the oldest message first, got %+v", m)
+	}
+
+	select {
+	case in <- MqttCronMessage{Source: "queue-block", Topic: "heartbeat", Payload: "4"}:
+	case <-time.After(time.Second):
+		t.Fatal("expected the source to carry on once the queue has room")
+	}
+
+	for _, payload := range []string{"2", "3", "4"} {
+		if m := <-out; m.Payload != payload {
+			t.Fatalf("expected message %s, got %+v", payload, m)
+		}
+	}
+
+	if dropped := DroppedMessages.Counts()["queue-block"] - before; dropped != 0 {
+		t.Fatalf("expected nothing to be dropped, got %d", dropped)
+	}
+}
+
+func TestParseQueuePolicy(t *testing.T) {
+	for _, value := range []string{"block", "drop-oldest"} {
+		if policy, err := ParseQueuePolicy(value); err != nil || string(policy) != value {
+			t.Errorf("ParseQueuePolicy(%s) = %s, %v", value, policy, err)
+		}
+	}
+
+	if _, err := ParseQueuePolicy("drop-newest"); err == nil {
+		t.Error("expected `drop-newest` to be refused")
+	}
+
+	for _, size := range []string{"-1", "many"} {
+		if _, err := queueSizeFromEnv(mapLookup(map[string]string{"MQTT_QUEUE_SIZE": size})); err == nil {
+			t.Errorf("expected `MQTT_QUEUE_SIZE='%s'` to be refused", size)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package magpie
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* A daily window of wall-clock time such as `23:00-06:00`. A window that ends
+ * before it starts wraps around midnight. */
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+/* Parse a single `HH:MM` clock time into the offset since midnight. */
+func parseClock(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(value))
+
+	if err != nil {
+		return 0, fmt.Errorf("could not parse `%s` as `HH:MM`", value)
+	}
+
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+/* Parse a window in the `HH:MM-HH:MM` format. */
+func ParseTimeWindow(spec string) (TimeWindow, error) {
+	var err error
+	var window TimeWindow
+
+	parts := strings.Split(spec, "-")
+
+	if len(parts) != 2 {
+		return window, fmt.Errorf("could not parse `%s` as `HH:MM-HH:MM`", spec)
+	}
+
+	if window.Start, err = parseClock(parts[0]); err != nil {
+		return window, err
+	}
+
+	if window.End, err = parseClock(parts[1]); err != nil {
+		return window, err
+	}
+
+	return window, nil
+}
+
+/* Determine if the wall-clock time of `t` falls inside the window, the start
+ * is inclusive and the end is exclusive. */
+func (w TimeWindow) Contains(t time.Time) bool {
+	offset := clockOffset(t)
+
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+
+	return offset >= w.Start || offset < w.End
+}
+
+/* Hours during which only critical messages are published, the window is
+ * evaluated in `Location`. */
+type QuietHours struct {
+	Window   TimeWindow
+	Location *time.Location
+}
+
+/* Parse the `QUIET_HOURS` window expressed in the timezone `loc`. */
+func ParseQuietHours(spec string, loc *time.Location) (QuietHours, error) {
+	var err error
+
+	quiet := QuietHours{Location: loc}
+
+	if quiet.Window, err = ParseTimeWindow(spec); err != nil {
+		return quiet, err
+	}
+
+	return quiet, nil
+}
+
+/* Determine if quiet hours are in effect at `t`. */
+func (q QuietHours) Active(t time.Time) bool {
+	return q.Window.Contains(t.In(q.Location))
+}
+
+/* Determine if a message is allowed to be published at `t`, critical
+ * messages always pass. */
+func (q QuietHours) Allows(m MqttCronMessage, t time.Time) bool {
+	return m.Critical || !q.Active(t)
+}
+
+/* The quiet hours in effect, safe to replace while messages are published
+ * as a reload does. Holds nil when there are none. */
+type CurrentQuietHours struct {
+	mu    sync.Mutex
+	quiet *QuietHours
+}
+
+func NewCurrentQuietHours(quiet *QuietHours) *CurrentQuietHours {
+	return &CurrentQuietHours{quiet: quiet}
+}
+
+func (c *CurrentQuietHours) Get() *QuietHours {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.quiet
+}
+
+func (c *CurrentQuietHours) Set(quiet *QuietHours) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.quiet = quiet
+}
@@ -0,0 +1,103 @@
+package magpie
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	window, err := ParseTimeWindow("23:00-06:30")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if window.Start != 23*time.Hour || window.End != 6*time.Hour+30*time.Minute {
+		t.Fatalf("expected 23:00 to 06:30, got %+v", window)
+	}
+
+	for _, spec := range []string{"", "23:00", "23:00-", "25:00-06:00", "23:00-06:00-07:00"} {
+		if _, err := ParseTimeWindow(spec); err == nil {
+			t.Errorf("expected `%s` to be refused", spec)
+		}
+	}
+}
+
+func TestTimeWindowContainsAcrossMidnight(t *testing.T) {
+	window := TimeWindow{Start: 23 * time.Hour, End: 6 * time.Hour}
+
+	for _, c := range []struct {
+		hour     int
+		minute   int
+		contains bool
+	}{
+		{hour: 22, minute: 59, contains: false},
+		{hour: 23, minute: 0, contains: true},
+		{hour: 0, minute: 0, contains: true},
+		{hour: 5, minute: 59, contains: true},
+		{hour: 6, minute: 0, contains: false},
+		{hour: 12, minute: 0, contains: false},
+	} {
+		at := time.Date(2026, 1, 1, c.hour, c.minute, 0, 0, time.UTC)
+
+		if got := window.Contains(at); got != c.contains {
+			t.Errorf("Contains(%s) = %t, expected %t", at.Format("15:04"), got, c.contains)
+		}
+	}
+}
+
+func TestTimeWindowContainsWithinDay(t *testing.T) {
+	window := TimeWindow{Start: 9 * time.Hour, End: 17 * time.Hour}
+
+	for _, c := range []struct {
+		hour     int
+		contains bool
+	}{
+		{hour: 8, contains: false},
+		{hour: 9, contains: true},
+		{hour: 16, contains: true},
+		{hour: 17, contains: false},
+	} {
+		at := time.Date(2026, 1, 1, c.hour, 0, 0, 0, time.UTC)
+
+		if got := window.Contains(at); got != c.contains {
+			t.Errorf("Contains(%s) = %t, expected %t", at.Format("15:04"), got, c.contains)
+		}
+	}
+}
+
+func TestQuietHoursSuppressDataButNotStatus(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quiet, err := ParseQuietHours("23:00-06:00", loc)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := MqttCronMessage{Topic: "weather/wind", Payload: "3"}
+	status := MqttCronMessage{Topic: "magpie/status", Payload: "online", Critical: true}
+
+	for _, c := range []struct {
+		at     time.Time
+		allows bool
+	}{
+		{at: time.Date(2026, 1, 1, 22, 30, 0, 0, loc), allows: true},
+		{at: time.Date(2026, 1, 1, 23, 30, 0, 0, loc), allows: false},
+		{at: time.Date(2026, 1, 2, 5, 30, 0, 0, loc), allows: false},
+		{at: time.Date(2026, 1, 2, 6, 0, 0, 0, loc), allows: true},
+		{at: time.Date(2026, 1, 1, 22, 30, 0, 0, time.UTC), allows: false},
+	} {
+		if got := quiet.Allows(data, c.at); got != c.allows {
+			t.Errorf("Allows(data, %s) = %t, expected %t", c.at, got, c.allows)
+		}
+
+		if !quiet.Allows(status, c.at) {
+			t.Errorf("expected status to be allowed at %s", c.at)
+		}
+	}
+}
@@ -1,42 +1,265 @@
 package magpie
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"strings"
 	"time"
 )
 
+var seasonLog = NewLogger("season")
+
+/* A day in the year without a year attached. */
+type MonthDay struct {
+	Month time.Month
+	Day   int
+}
+
+/* Determine if `t` falls on or after this day in its year. */
+func (md MonthDay) reachedBy(t time.Time) bool {
+	return t.Month() > md.Month || (t.Month() == md.Month && t.Day() >= md.Day)
+}
+
+/* Determine if this day comes strictly after `other` in the year. */
+func (md MonthDay) after(other MonthDay) bool {
+	return md.Month > other.Month || (md.Month == other.Month && md.Day > other.Day)
+}
+
+/* The days on which spring, summer, fall, and winter start in that order. */
+type SeasonBoundaries [4]MonthDay
+
+/* Seasons as used by meteorologists, starting on the first of March, June,
+ * September, and December. */
+var MeteorologicalSeasons = SeasonBoundaries{{time.March, 1}, {time.June, 1}, {time.September, 1}, {time.December, 1}}
+
+var seasonNames = [4]string{"spring", "summer", "fall", "winter"}
+
+/* Parse four comma separated `MM-DD` pairs into boundaries, the pairs have
+ * to be in order within the year. */
+func ParseSeasonBoundaries(spec string) (SeasonBoundaries, error) {
+	var boundaries SeasonBoundaries
+
+	parts := strings.Split(spec, ",")
+
+	if len(parts) != len(boundaries) {
+		return boundaries, fmt.Errorf("expected %d `MM-DD` pairs, got %d", len(boundaries), len(parts))
+	}
+
+	for idx, part := range parts {
+		day, err := time.Parse("01-02", strings.TrimSpace(part))
+
+		if err != nil {
+			return boundaries, fmt.Errorf("could not parse `%s` as `MM-DD`", part)
+		}
+
+		boundaries[idx] = MonthDay{Month: day.Month(), Day: day.Day()}
+
+		if idx > 0 && !boundaries[idx].after(boundaries[idx-1]) {
+			return boundaries, fmt.Errorf("`%s` is not after `%s`", strings.TrimSpace(part), strings.TrimSpace(parts[idx-1]))
+		}
+	}
+
+	return boundaries, nil
+}
+
+/* Determine the season `t` falls in according to the boundaries. */
+func SeasonForDate(t time.Time, boundaries SeasonBoundaries) string {
+	season := seasonNames[len(seasonNames)-1]
+
+	for idx, boundary := range boundaries {
+		if boundary.reachedBy(t) {
+			season = seasonNames[idx]
+		}
+	}
+
+	return season
+}
+
+/* Convert a julian day to a time in UTC. */
+func julianDayToTime(jd float64) time.Time {
+	return time.Unix(0, int64((jd-2440587.5)*86400*float64(time.Second))).UTC()
+}
+
+/* Approximate the instants of the March equinox, June solstice, September
+ * equinox, and December solstice in `year`. Uses the mean values from Jean
+ * Meeus' Astronomical Algorithms which are accurate to within an hour or
+ * so for the years 2000 to 3000. */
+func AstronomicalSeasonStarts(year int) [4]time.Time {
+	y := float64(year-2000) / 1000
+
+	jds := [4]float64{
+		2451623.80984 + 365242.37404*y + 0.05169*y*y - 0.00411*y*y*y - 0.00057*y*y*y*y,
+		2451716.56767 + 365241.62603*y + 0.00325*y*y + 0.00888*y*y*y - 0.00030*y*y*y*y,
+		2451810.21715 + 365242.01767*y - 0.11575*y*y + 0.00337*y*y*y + 0.00078*y*y*y*y,
+		2451900.05952 + 365242.74049*y - 0.06223*y*y - 0.00823*y*y*y + 0.00032*y*y*y*y,
+	}
+
+	var starts [4]time.Time
+
+	for idx, jd := range jds {
+		starts[idx] = julianDayToTime(jd)
+	}
+
+	return starts
+}
+
+/* Determine the season `t` falls in for the `meteorological` or the
+ * `astronomical` mode, where seasons start at the equinoxes and solstices. */
+func SeasonForTime(t time.Time, mode string) string {
+	if mode != "astronomical" {
+		return SeasonForDate(t, MeteorologicalSeasons)
+	}
+
+	season := seasonNames[len(seasonNames)-1]
+
+	for idx, start := range AstronomicalSeasonStarts(t.Year()) {
+		if !t.Before(start) {
+			season = seasonNames[idx]
+		}
+	}
+
+	return season
+}
+
+/* The first boundary strictly after `t`, at midnight in the location of
+ * `t`. */
+func NextSeasonDate(t time.Time, boundaries SeasonBoundaries) time.Time {
+	for _, year := range []int{t.Year(), t.Year() + 1} {
+		for _, boundary := range boundaries {
+			start := time.Date(year, boundary.Month, boundary.Day, 0, 0, 0, 0, t.Location())
+
+			if start.After(t) {
+				return start
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+/* The instant the season after the one `t` falls in starts for the
+ * `meteorological` or the `astronomical` mode. Seasons change at the same
+ * instants on both hemispheres, `hemisphere` only decides which season
+ * starts then, see `SeasonForHemisphere`. */
+func NextSeasonChange(t time.Time, mode string, hemisphere string) time.Time {
+	if mode != "astronomical" {
+		return NextSeasonDate(t, MeteorologicalSeasons)
+	}
+
+	for _, year := range []int{t.Year(), t.Year() + 1} {
+		for _, start := range AstronomicalSeasonStarts(year) {
+			if start.After(t) {
+				return start.In(t.Location())
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+/* Map a season on the northern hemisphere to the season at the same time
+ * on the `north` or `south` hemisphere. */
+func SeasonForHemisphere(season string, hemisphere string) string {
+	if hemisphere != "south" {
+		return season
+	}
+
+	for idx, name := range seasonNames {
+		if name == season {
+			return seasonNames[(idx+2)%len(seasonNames)]
+		}
+	}
+
+	return season
+}
+
+/* Determine the season mode from `SEASON_MODE` and, for the custom mode,
+ * the boundaries from `SEASON_BOUNDARIES`. */
+func seasonModeFromEnv(lookup func(string) (string, bool)) (string, SeasonBoundaries, error) {
+	modeFromEnv, _ := lookup("SEASON_MODE")
+
+	switch mode := modeFromEnv; mode {
+	case "", "meteorological":
+		return "meteorological", MeteorologicalSeasons, nil
+	case "astronomical":
+		return mode, SeasonBoundaries{}, nil
+	case "custom":
+		boundariesFromEnv, boundariesExists := lookup("SEASON_BOUNDARIES")
+
+		if !boundariesExists {
+			return mode, SeasonBoundaries{}, fmt.Errorf("`SEASON_MODE=custom` needs `SEASON_BOUNDARIES` set in the environment")
+		}
+
+		boundaries, err := ParseSeasonBoundaries(boundariesFromEnv)
+
+		return mode, boundaries, err
+	default:
+		return mode, SeasonBoundaries{}, fmt.Errorf("unknown `SEASON_MODE='%s'`", mode)
+	}
+}
+
+/* The settings of the season source. */
+type seasonSettings struct {
+	mode       string
+	boundaries SeasonBoundaries
+	hemisphere string
+}
+
+/* Read and check the settings of the season source. */
+func seasonSettingsFromConfig(cfg SourceConfig) (seasonSettings, error) {
+	var err error
+	var settings seasonSettings
+
+	if settings.mode, settings.boundaries, err = seasonModeFromEnv(cfg.Lookup); err != nil {
+		return settings, fmt.Errorf("could not determine season boundaries: %w", err)
+	}
+
+	if settings.hemisphere = cfg.Get("SEASON_HEMISPHERE"); settings.hemisphere != "north" && settings.hemisphere != "south" {
+		return settings, fmt.Errorf("could not use `SEASON_HEMISPHERE='%s'`, expected `north` or `south`", settings.hemisphere)
+	}
+
+	return settings, nil
+}
+
 /* A loop that waits between submitting the current season to the
  * topic defined in the environment as `SEASON_TOPIC`. */
-func SeasonLoop(ch chan MqttCronMessage) {
-	topicFromEnv, topicExists := os.LookupEnv("SEASON_TOPIC")
+func SeasonLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	settings, err := seasonSettingsFromConfig(cfg)
 
-	if !topicExists {
-		log.Println("SeasonLoop needs `SEASON_TOPIC` set in the environment, disabled.")
+	if err != nil {
+		seasonLog.Warnf("SeasonLoop %s, disabled.\n", err)
 		return
 	}
 
-	log.Println("SeasonLoop enabled.")
+	seasonLog.Println("SeasonLoop enabled.")
 
 	for {
 		var season string
-		now := time.Now().UTC()
-
-		if now.Month() < 3 {
-			season = "winter"
-		} else if now.Month() < 6 {
-			season = "spring"
-		} else if now.Month() < 9 {
-			season = "summer"
-		} else if now.Month() < 12 {
-			season = "fall"
+		var next time.Time
+		now := cfg.Now().In(cfg.Location)
+
+		if settings.mode == "custom" {
+			season = SeasonForDate(now, settings.boundaries)
+			next = NextSeasonDate(now, settings.boundaries)
 		} else {
-			season = "winter"
+			season = SeasonForTime(now, settings.mode)
+			next = NextSeasonChange(now, settings.mode, settings.hemisphere)
 		}
 
-		ch <- MqttCronMessage{Retain: true, Topic: topicFromEnv, Payload: fmt.Sprintf("%s", season)}
+		msgs := []MqttCronMessage{
+			{Retain: cfg.Retain, Topic: cfg.Topic, Payload: SeasonForHemisphere(season, settings.hemisphere)},
+			{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "next"), Payload: next.Format("2006-01-02")},
+			{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "seconds_until"), Payload: fmt.Sprintf("%d", int64(next.Sub(now).Seconds()))},
+		}
 
-		time.Sleep(1 * time.Hour)
+		for _, m := range msgs {
+			if !sendMessage(ctx, ch, m) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
 	}
 }
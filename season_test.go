@@ -0,0 +1,171 @@
+package magpie
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSeasonForDateCelticCalendar(t *testing.T) {
+	boundaries, err := ParseSeasonBoundaries("02-01,05-01,08-01,11-01")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		month  time.Month
+		day    int
+		season string
+	}{
+		{month: time.January, day: 1, season: "winter"},
+		{month: time.January, day: 31, season: "winter"},
+		{month: time.February, day: 1, season: "spring"},
+		{month: time.April, day: 30, season: "spring"},
+		{month: time.May, day: 1, season: "summer"},
+		{month: time.August, day: 1, season: "fall"},
+		{month: time.October, day: 31, season: "fall"},
+		{month: time.November, day: 1, season: "winter"},
+		{month: time.December, day: 31, season: "winter"},
+	} {
+		at := time.Date(2026, c.month, c.day, 12, 0, 0, 0, time.UTC)
+
+		if season := SeasonForDate(at, boundaries); season != c.season {
+			t.Errorf("SeasonForDate(%s) = %s, expected %s", at.Format(time.DateOnly), season, c.season)
+		}
+	}
+}
+
+func TestParseSeasonBoundariesRefusesMalformed(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"02-01,05-01,08-01",
+		"02-01,05-01,08-01,11-01,12-01",
+		"02-01,05-01,08-01,13-01",
+		"02-01,05-01,august,11-01",
+		"05-01,02-01,08-01,11-01",
+		"02-01,02-01,08-01,11-01",
+	} {
+		if _, err := ParseSeasonBoundaries(spec); err == nil {
+			t.Errorf("expected `%s` to be refused", spec)
+		}
+	}
+}
+
+func TestSeasonForTimeModes(t *testing.T) {
+	for _, c := range []struct {
+		at             time.Time
+		meteorological string
+		astronomical   string
+	}{
+		{at: time.Date(2026, 2, 28, 23, 0, 0, 0, time.UTC), meteorological: "winter", astronomical: "winter"},
+		{at: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), meteorological: "spring", astronomical: "winter"},
+		{at: time.Date(2026, 3, 20, 10, 0, 0, 0, time.UTC), meteorological: "spring", astronomical: "winter"},
+		{at: time.Date(2026, 3, 20, 20, 0, 0, 0, time.UTC), meteorological: "spring", astronomical: "spring"},
+		{at: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), meteorological: "summer", astronomical: "spring"},
+		{at: time.Date(2026, 6, 21, 6, 0, 0, 0, time.UTC), meteorological: "summer", astronomical: "spring"},
+		{at: time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC), meteorological: "summer", astronomical: "summer"},
+	} {
+		if season := SeasonForTime(c.at, "meteorological"); season != c.meteorological {
+			t.Errorf("SeasonForTime(%s, meteorological) = %s, expected %s", c.at, season, c.meteorological)
+		}
+
+		if season := SeasonForTime(c.at, "astronomical"); season != c.astronomical {
+			t.Errorf("SeasonForTime(%s, astronomical) = %s, expected %s", c.at, season, c.astronomical)
+		}
+	}
+}
+
+func TestNextSeasonChangeMeteorological(t *testing.T) {
+	for _, c := range []struct {
+		at       time.Time
+		expected time.Time
+	}{
+		{at: time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC), expected: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{at: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), expected: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{at: time.Date(2026, 11, 30, 23, 59, 0, 0, time.UTC), expected: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{at: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), expected: time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		for _, hemisphere := range []string{"north", "south"} {
+			if next := NextSeasonChange(c.at, "meteorological", hemisphere); !next.Equal(c.expected) {
+				t.Errorf("NextSeasonChange(%s, meteorological, %s) = %s, expected %s", c.at, hemisphere, next, c.expected)
+			}
+		}
+	}
+}
+
+func TestNextSeasonChangeAstronomical(t *testing.T) {
+	for _, c := range []struct {
+		at       time.Time
+		expected time.Time
+	}{
+		{at: time.Date(2025, 12, 30, 0, 0, 0, 0, time.UTC), expected: time.Date(2026, 3, 20, 14, 46, 0, 0, time.UTC)},
+		{at: time.Date(2026, 3, 21, 0, 0, 0, 0, time.UTC), expected: time.Date(2026, 6, 21, 8, 24, 0, 0, time.UTC)},
+		{at: time.Date(2026, 6, 22, 0, 0, 0, 0, time.UTC), expected: time.Date(2026, 9, 23, 0, 5, 0, 0, time.UTC)},
+		{at: time.Date(2026, 9, 24, 0, 0, 0, 0, time.UTC), expected: time.Date(2026, 12, 21, 20, 50, 0, 0, time.UTC)},
+	} {
+		for _, hemisphere := range []string{"north", "south"} {
+			next := NextSeasonChange(c.at, "astronomical", hemisphere)
+
+			if difference := next.Sub(c.expected).Abs(); difference > time.Hour {
+				t.Errorf("NextSeasonChange(%s, astronomical, %s) = %s, expected about %s", c.at, hemisphere, next, c.expected)
+			}
+		}
+	}
+
+	equinox := NextSeasonChange(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), "astronomical", "north")
+
+	if next := NextSeasonChange(equinox, "astronomical", "north"); next.Month() != time.June {
+		t.Errorf("expected the change after the equinox to be the solstice, got %s", next)
+	}
+}
+
+func TestSeasonLoopWithFrozenClock(t *testing.T) {
+	for _, c := range []struct {
+		hemisphere string
+		expected   []MqttCronMessage
+	}{
+		{hemisphere: "north", expected: []MqttCronMessage{
+			{Topic: "season", Payload: "winter", Retain: true},
+			{Topic: "season/next", Payload: "2026-03-01", Retain: true},
+			{Topic: "season/seconds_until", Payload: "43200", Retain: true},
+		}},
+		{hemisphere: "south", expected: []MqttCronMessage{
+			{Topic: "season", Payload: "summer", Retain: true},
+			{Topic: "season/next", Payload: "2026-03-01", Retain: true},
+			{Topic: "season/seconds_until", Payload: "43200", Retain: true},
+		}},
+	} {
+		config, err := ConfigFromLookup(mapLookup(map[string]string{"STDOUT_SINK": "1", "SEASON_TOPIC": "season", "SEASON_HEMISPHERE": c.hemisphere, "MAGPIE_TIMEZONE": "UTC"}))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := config.Source("season")
+		cfg.Clock = FrozenClock{Time: time.Date(2026, 2, 28, 12, 0, 0, 0, time.UTC)}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := make(chan MqttCronMessage)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			SeasonLoop(ctx, ch, cfg)
+		}()
+
+		var msgs []MqttCronMessage
+
+		for range c.expected {
+			msgs = append(msgs, receive(t, ch))
+		}
+
+		cancel()
+		<-done
+
+		if !reflect.DeepEqual(msgs, c.expected) {
+			t.Errorf("expected %+v on the %s hemisphere, got %+v", c.expected, c.hemisphere, msgs)
+		}
+	}
+}
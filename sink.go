@@ -0,0 +1,81 @@
+package magpie
+
+import (
+	"io"
+	"sync"
+)
+
+/* A destination for messages, `Topic` of the message passed to `Publish`
+ * includes the prefix. */
+type Sink interface {
+	Publish(m MqttCronMessage) error
+}
+
+/* Records every message published to it, useful in tests. */
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []MqttCronMessage
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Publish(m MqttCronMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, m)
+
+	return nil
+}
+
+/* A copy of the messages published so far in order. */
+func (s *MemorySink) Messages() []MqttCronMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]MqttCronMessage(nil), s.messages...)
+}
+
+/* Logs every message instead of publishing it, used for `MAGPIE_DRY_RUN`. */
+type LogSink struct {
+	log *Logger
+}
+
+func NewLogSink() *LogSink {
+	return &LogSink{log: NewLogger("dryrun")}
+}
+
+func (s *LogSink) Publish(m MqttCronMessage) error {
+	s.log.Topic(m.Topic).Printf("Would publish topic='%s' payload='%s' retain=%t\n", m.Topic, m.Payload, m.Retain)
+
+	return nil
+}
+
+/* Writes every message as a single line of JSON to a writer such as
+ * stdout, whole lines are written at once so concurrent publishes do not
+ * interleave. */
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Publish(m MqttCronMessage) error {
+	line, err := EncodeMessageLine(m)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(line)
+
+	return err
+}
@@ -0,0 +1,126 @@
+package magpie
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMemorySinkRecordsInOrder(t *testing.T) {
+	sink := NewMemorySink()
+
+	for _, payload := range []string{"winter", "spring"} {
+		if err := sink.Publish(MqttCronMessage{Topic: "season", Payload: payload, Retain: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := sink.Messages()
+
+	if len(messages) != 2 || messages[0].Payload != "winter" || messages[1].Payload != "spring" || !messages[1].Retain {
+		t.Fatalf("expected winter and spring retained in order, got %+v", messages)
+	}
+
+	messages[0].Payload = "fall"
+
+	if sink.Messages()[0].Payload != "winter" {
+		t.Fatal("expected the recorded messages to be a copy")
+	}
+}
+
+func TestMemorySinkTakesConcurrentPublishes(t *testing.T) {
+	var wg sync.WaitGroup
+
+	sink := NewMemorySink()
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			sink.Publish(MqttCronMessage{Topic: "heartbeat"})
+		}()
+	}
+
+	wg.Wait()
+
+	if got := len(sink.Messages()); got != 50 {
+		t.Fatalf("expected 50 messages, got %d", got)
+	}
+}
+
+func TestWriterSinkWritesOneLinePerMessage(t *testing.T) {
+	var wg sync.WaitGroup
+	var buffer bytes.Buffer
+
+	sink := NewWriterSink(&buffer)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			sink.Publish(MqttCronMessage{Topic: "home.arpa/heartbeat", Payload: strconv.Itoa(i), Retain: true})
+		}()
+	}
+
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(&buffer)
+
+	for scanner.Scan() {
+		var line MessageLine
+
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("expected every line to be JSON, got %q: %s", scanner.Text(), err)
+		}
+
+		if line.Topic != "home.arpa/heartbeat" || !line.Retain {
+			t.Fatalf("expected the topic and retain flag of the message, got %+v", line)
+		}
+
+		seen[line.Payload] = true
+	}
+
+	if len(seen) != 50 {
+		t.Fatalf("expected a line for each of the 50 messages, got %d", len(seen))
+	}
+}
+
+func TestLogSinkLogsWhatWouldBePublished(t *testing.T) {
+	buffer, restore := captureLog()
+	defer restore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage, 2)
+
+	ch <- MqttCronMessage{Topic: "season", Payload: "winter", Retain: true}
+	ch <- MqttCronMessage{Topic: "weather/wind", Payload: "3.40"}
+
+	cancel()
+
+	MessageLoop(ctx, ch, []Sink{NewLogSink()}, "home", nil, nil)
+
+	restore()
+
+	for _, line := range []string{
+		"Would publish topic='home/season' payload='winter' retain=true",
+		"Would publish topic='home/weather/wind' payload='3.40' retain=false",
+	} {
+		if !strings.Contains(buffer.String(), line) {
+			t.Errorf("expected %q in the log, got %q", line, buffer.String())
+		}
+	}
+
+	config, err := ConfigFromLookup(mapLookup(map[string]string{"MAGPIE_DRY_RUN": "true"}))
+
+	if err != nil || !config.DryRun {
+		t.Fatalf("expected a dry run to need no broker, got %t and %v", config.DryRun, err)
+	}
+}
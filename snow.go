@@ -0,0 +1,126 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var snowLog = NewLogger("snow")
+
+/* Current snow conditions from the `open-meteo.com` forecast API, the depth
+ * in meters and the snowfall of the preceding period in centimeters. Values
+ * are null when unknown. */
+type SnowAPIData struct {
+	SnowDepth *float64 `json:"snow_depth"`
+	Snowfall  *float64 `json:"snowfall"`
+}
+
+/* Result from the `open-meteo.com` forecast API. */
+type SnowAPIResult struct {
+	Error   bool        `json:"error"`
+	Reason  string      `json:"reason"`
+	Current SnowAPIData `json:"current"`
+}
+
+/* The snow depth in centimeters and whether it is snowing, either is nil
+ * when the API did not know it. */
+type Snow struct {
+	Depth   *float64
+	Snowing *bool
+}
+
+/* Parse a response of the `open-meteo.com` forecast API into the current
+ * snow conditions, the depth is rounded to whole millimeters. */
+func ParseSnow(body []byte) (Snow, error) {
+	var apiResult SnowAPIResult
+	var snow Snow
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return Snow{}, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if apiResult.Error {
+		return Snow{}, fmt.Errorf("the response was an error: %s", apiResult.Reason)
+	}
+
+	if depth := apiResult.Current.SnowDepth; depth != nil {
+		centimeters := math.Round(*depth*1000) / 10
+		snow.Depth = &centimeters
+	}
+
+	if snowfall := apiResult.Current.Snowfall; snowfall != nil {
+		snowing := *snowfall > 0
+		snow.Snowing = &snowing
+	}
+
+	if snow.Depth == nil && snow.Snowing == nil {
+		return Snow{}, errors.New("the response has neither a snow depth nor a snowfall")
+	}
+
+	return snow, nil
+}
+
+/* Call the `open-meteo.com` forecast API and return the snow conditions. */
+func SnowAPICall(ctx context.Context, apiUrl string) (Snow, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return Snow{}, err
+	}
+
+	return ParseSnow(body)
+}
+
+/* A loop that waits between calls to the `open-meteo.com` forecast API and
+ * submits the snow depth in centimeters to the topic given in the
+ * environment variable `SNOW_TOPIC` and whether it is snowing to
+ * `<topic>/snowing`. */
+func SnowLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	if errors.Is(cfg.CoordinatesErr, ErrCoordinatesMissing) {
+		snowLog.Println("SnowLoop needs `SNOW_LATITUDE` and `SNOW_LONGITUDE`, or `MAGPIE_LATITUDE` and `MAGPIE_LONGITUDE`, set in the environment, disabled.")
+		return
+	}
+
+	if cfg.CoordinatesErr != nil {
+		snowLog.Warnf("SnowLoop could not use its coordinates: %s, disabled.\n", cfg.CoordinatesErr)
+		return
+	}
+
+	snowLog.Println("SnowLoop enabled.")
+
+	apiUrl := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%f&longitude=%f&current=snow_depth,snowfall", cfg.Coordinates.Latitude, cfg.Coordinates.Longitude)
+
+	for {
+		var snow Snow
+
+		if !fetchWithRetry(ctx, cfg, snowLog, "SnowLoop could not fetch the snow", func() error {
+			var err error
+
+			snow, err = SnowAPICall(ctx, apiUrl)
+
+			return err
+		}) {
+			return
+		}
+
+		if snow.Depth != nil {
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: strconv.FormatFloat(*snow.Depth, 'f', -1, 64)}) {
+				return
+			}
+		}
+
+		if snow.Snowing != nil {
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "snowing"), Payload: yesNo(*snow.Snowing)}) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
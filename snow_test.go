@@ -0,0 +1,46 @@
+package magpie
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseSnow(t *testing.T) {
+	body, err := os.ReadFile("testdata/snow.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snow, err := ParseSnow(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snow.Depth == nil || *snow.Depth != 42.4 || snow.Snowing == nil || !*snow.Snowing {
+		t.Fatalf("expected 42.4cm of snow while snowing, got %+v", snow)
+	}
+}
+
+func TestParseSnowWithMissingValues(t *testing.T) {
+	snow, err := ParseSnow([]byte(`{"current": {"snow_depth": 0, "snowfall": null}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snow.Depth == nil || *snow.Depth != 0 || snow.Snowing != nil {
+		t.Fatalf("expected no snow without knowing whether it snows, got %+v", snow)
+	}
+
+	for _, body := range []string{
+		`{"current": {"snow_depth": null, "snowfall": null}}`,
+		`{"error": true, "reason": "Latitude must be in range of -90 to 90°."}`,
+		`{"current": []}`,
+	} {
+		if _, err := ParseSnow([]byte(body)); err == nil {
+			t.Errorf("expected %s to be refused", body)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package magpie
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+)
+
+/* A message as it is written to line based sinks, `Topic` includes the
+ * prefix. */
+type MessageLine struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+	Retain  bool   `json:"retain"`
+}
+
+/* Encode a message as a single line of JSON including the trailing
+ * newline. */
+func EncodeMessageLine(m MqttCronMessage) ([]byte, error) {
+	line, err := json.Marshal(MessageLine{Topic: m.Topic, Payload: m.Payload, Retain: m.Retain})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(line, '\n'), nil
+}
+
+/* Writes messages as lines of JSON to the Unix domain socket at `Path`. The
+ * socket is (re)connected lazily so a reader that goes away and comes back
+ * is picked up again. */
+type SocketSink struct {
+	Path string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewSocketSink(path string) *SocketSink {
+	return &SocketSink{Path: path}
+}
+
+/* Write a message to the socket, reconnecting and retrying once when the
+ * write fails. */
+func (s *SocketSink) Publish(m MqttCronMessage) error {
+	line, err := EncodeMessageLine(m)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = net.Dial("unix", s.Path); err != nil {
+				s.conn = nil
+				return err
+			}
+		}
+
+		if _, err = s.conn.Write(line); err == nil {
+			return nil
+		}
+
+		s.conn.Close()
+		s.conn = nil
+
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+/* Close the connection to the socket if there is one. */
+func (s *SocketSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
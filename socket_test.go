@@ -0,0 +1,112 @@
+package magpie
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEncodeMessageLine(t *testing.T) {
+	line, err := EncodeMessageLine(MqttCronMessage{Topic: "magpie/season", Payload: "winter", Retain: true, Critical: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"topic":"magpie/season","payload":"winter","retain":true}` + "\n"; string(line) != expected {
+		t.Fatalf("expected %q, got %q", expected, line)
+	}
+}
+
+/* Accept connections on a Unix domain socket at `path` and send every line
+ * read from them on the returned channel, until the returned function
+ * closes the socket and its connections. */
+func acceptLines(t *testing.T, path string) (chan string, func()) {
+	var mu sync.Mutex
+	var conns []net.Conn
+
+	listener, err := net.Listen("unix", path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string, 16)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+
+			go func() {
+				scanner := bufio.NewScanner(conn)
+
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	return lines, func() {
+		listener.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+}
+
+func TestSocketSinkReconnects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "magpie.sock")
+
+	lines, stop := acceptLines(t, path)
+	sink := NewSocketSink(path)
+	defer sink.Close()
+
+	if err := sink.Publish(MqttCronMessage{Topic: "season", Payload: "winter"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if line := <-lines; line != `{"topic":"season","payload":"winter","retain":false}` {
+		t.Fatalf("expected the message as a line, got %q", line)
+	}
+
+	stop()
+
+	lines, stop = acceptLines(t, path)
+	defer stop()
+
+	deadline := time.After(time.Second)
+
+	for {
+		if err := sink.Publish(MqttCronMessage{Topic: "season", Payload: "summer"}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case line := <-lines:
+			if line != `{"topic":"season","payload":"summer","retain":false}` {
+				t.Fatalf("expected the message after reconnecting, got %q", line)
+			}
+
+			return
+		case <-deadline:
+			t.Fatal("expected the sink to reconnect to the new reader")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
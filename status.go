@@ -0,0 +1,233 @@
+package magpie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var statusLog = NewLogger("status")
+
+/* Counts events per source, safe for concurrent use. */
+type Counters struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func NewCounters() *Counters {
+	return &Counters{counts: make(map[string]uint64)}
+}
+
+/* Count a single event of `source`. */
+func (c *Counters) Inc(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[source]++
+}
+
+/* A copy of the counts so far keyed by source. */
+func (c *Counters) Counts() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]uint64, len(c.counts))
+
+	for source, count := range c.counts {
+		counts[source] = count
+	}
+
+	return counts
+}
+
+var (
+	/* Messages taken by at least one sink per source. */
+	PublishedMessages = NewCounters()
+
+	/* Publishes a sink failed or dropped per source. */
+	FailedPublishes = NewCounters()
+
+	/* Failed calls to upstream APIs per source. */
+	FetchErrors = NewCounters()
+)
+
+/* Remembers the last time of an event per source, safe for concurrent
+ * use. */
+type Timestamps struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func NewTimestamps() *Timestamps {
+	return &Timestamps{times: make(map[string]time.Time)}
+}
+
+/* Remember `t` as the last event of `source`. */
+func (s *Timestamps) Mark(source string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.times[source] = t
+}
+
+/* The last event of `source`, reports false when there was none. */
+func (s *Timestamps) Last(source string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, exists := s.times[source]
+
+	return t, exists
+}
+
+/* The last successful fetch from the upstream per source. */
+var LastUpdates = NewTimestamps()
+
+/* Time between checks of the stale watchdog, replaceable for tests. */
+var staleCheckInterval = time.Minute
+
+/* Determine if a source whose last update was at `last` is stale at `now`,
+ * which it is once more than `multiplier` times its `interval` passed. */
+func IsStale(last time.Time, now time.Time, interval time.Duration, multiplier float64) bool {
+	return now.Sub(last) > time.Duration(multiplier*float64(interval))
+}
+
+/* A loop that checks every minute whether the sources `running` reports
+ * fetched from their upstream within `multiplier` times their interval and
+ * submits `yes` or `no` to `magpie/<source>/stale`, also during quiet hours.
+ * A source that has not fetched yet counts from its start plus its start
+ * delay, computed sources are left out. The flag of a source that stopped
+ * running is cleared. */
+func StaleLoop(ctx context.Context, ch chan MqttCronMessage, running func() []RunningSource, multiplier float64) {
+	watched := make(map[string]bool)
+
+	for {
+		now := time.Now()
+		current := make(map[string]bool)
+
+		for _, source := range running() {
+			name := source.Config.Name
+
+			if computedSources[name] {
+				continue
+			}
+
+			last, updated := LastUpdates.Last(name)
+
+			if !updated || last.Before(source.Started) {
+				last = source.Started.Add(source.Config.StartDelay)
+			}
+
+			current[name] = true
+
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: true, Critical: true, Topic: buildTopic("magpie", name, "stale"), Payload: yesNo(IsStale(last, now, source.Config.Interval, multiplier))}) {
+				return
+			}
+		}
+
+		for name := range watched {
+			if current[name] {
+				continue
+			}
+
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: true, Critical: true, Topic: buildTopic("magpie", name, "stale"), Payload: ""}) {
+				return
+			}
+		}
+
+		watched = current
+
+		if !sleepContext(ctx, staleCheckInterval) {
+			return
+		}
+	}
+}
+
+/* A loop that waits between submitting the number of failed calls to
+ * upstream APIs of every source `running` reports to
+ * `magpie/errors/<source>`, also during quiet hours. */
+func ErrorsLoop(ctx context.Context, ch chan MqttCronMessage, running func() []RunningSource, interval time.Duration) {
+	for {
+		counts := FetchErrors.Counts()
+
+		for _, source := range running() {
+			name := source.Config.Name
+
+			if !sendMessage(ctx, ch, MqttCronMessage{Retain: true, Critical: true, Topic: buildTopic("magpie/errors", name), Payload: strconv.FormatUint(counts[name], 10)}) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, interval) {
+			return
+		}
+	}
+}
+
+/* Write a counter in the Prometheus text format with a `source` label per
+ * counted source, in order of the sources. */
+func writePrometheusCounter(w io.Writer, name string, help string, counts map[string]uint64) {
+	var sources []string
+
+	for source := range counts {
+		sources = append(sources, source)
+	}
+
+	sort.Strings(sources)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+
+	for _, source := range sources {
+		fmt.Fprintf(w, "%s{source=%q} %d\n", name, source, counts[source])
+	}
+}
+
+/* Serve `/healthz`, which is `200` while `healthy` reports true and `503`
+ * otherwise, and the counters in the Prometheus text format on
+ * `/metrics`. */
+func StatusHandler(healthy func() bool) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !healthy() {
+			http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		writePrometheusCounter(w, "magpie_messages_published_total", "Messages published per source.", PublishedMessages.Counts())
+		writePrometheusCounter(w, "magpie_publish_failures_total", "Publishes a sink failed or dropped per source.", FailedPublishes.Counts())
+		writePrometheusCounter(w, "magpie_fetch_errors_total", "Failed calls to upstream APIs per source.", FetchErrors.Counts())
+		writePrometheusCounter(w, "magpie_messages_dropped_total", "Messages dropped from a full queue per source.", DroppedMessages.Counts())
+	})
+
+	return mux
+}
+
+/* Serve the status handler on `addr` until the context is done. */
+func ServeStatus(ctx context.Context, addr string, healthy func() bool) {
+	server := &http.Server{Addr: addr, Handler: StatusHandler(healthy), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	statusLog.Printf("ServeStatus listening on `%s`.\n", addr)
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		statusLog.Fatalf("ServeStatus could not listen on `%s`: %s.\n", addr, err)
+	}
+}
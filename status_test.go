@@ -0,0 +1,247 @@
+package magpie
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/* Receive a single message from `ch` or fail after a second. */
+func receive(t *testing.T, ch chan MqttCronMessage) MqttCronMessage {
+	t.Helper()
+
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("expected a message")
+		return MqttCronMessage{}
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		age   time.Duration
+		stale bool
+	}{
+		{age: 0, stale: false},
+		{age: 2 * time.Minute, stale: false},
+		{age: 3 * time.Minute, stale: false},
+		{age: 3*time.Minute + time.Second, stale: true},
+	} {
+		if got := IsStale(now.Add(-c.age), now, time.Minute, 3); got != c.stale {
+			t.Errorf("IsStale after %s = %t, expected %t", c.age, got, c.stale)
+		}
+	}
+}
+
+/* The running sources of a test, safe to change while a loop reads them. */
+type testRunning struct {
+	mu      sync.Mutex
+	sources []RunningSource
+}
+
+func (r *testRunning) set(sources ...RunningSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sources = sources
+}
+
+func (r *testRunning) get() []RunningSource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]RunningSource(nil), r.sources...)
+}
+
+func TestStaleLoopFlagsSourceThatStoppedUpdating(t *testing.T) {
+	staleCheckInterval = 10 * time.Millisecond
+
+	source := RunningSource{Config: SourceConfig{Name: "staletest", Interval: 20 * time.Millisecond}, Started: time.Now()}
+	running := &testRunning{}
+	running.set(source)
+
+	LastUpdates.Mark("staletest", time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		StaleLoop(ctx, ch, running.get, 3)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+		staleCheckInterval = time.Minute
+	}()
+
+	first := receive(t, ch)
+
+	if first.Topic != "magpie/staletest/stale" || first.Payload != "no" || !first.Retain || !first.Critical {
+		t.Fatalf("expected a retained critical `no`, got %+v", first)
+	}
+
+	deadline := time.After(time.Second)
+
+	for {
+		select {
+		case m := <-ch:
+			if m.Payload == "yes" {
+				running.set()
+
+				if cleared := receive(t, ch); cleared.Topic != "magpie/staletest/stale" || cleared.Payload != "" {
+					t.Fatalf("expected the flag to be cleared once the source stopped, got %+v", cleared)
+				}
+
+				return
+			}
+		case <-deadline:
+			t.Fatal("expected the source to become stale")
+		}
+	}
+}
+
+func TestStaleLoopLeavesOutComputedSources(t *testing.T) {
+	staleCheckInterval = 10 * time.Millisecond
+
+	started := time.Now().Add(-time.Hour)
+	running := &testRunning{}
+	running.set(
+		RunningSource{Config: SourceConfig{Name: "heartbeat", Interval: time.Millisecond}, Started: started},
+		RunningSource{Config: SourceConfig{Name: "staletest-upstream", Interval: time.Millisecond}, Started: started},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		StaleLoop(ctx, ch, running.get, 3)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+		staleCheckInterval = time.Minute
+	}()
+
+	for i := 0; i < 3; i++ {
+		if m := receive(t, ch); m.Topic != "magpie/staletest-upstream/stale" || m.Payload != "yes" {
+			t.Fatalf("expected only the upstream source to be flagged, got %+v", m)
+		}
+	}
+}
+
+func TestErrorsLoopFollowsRunningSources(t *testing.T) {
+	running := &testRunning{}
+	running.set(RunningSource{Config: SourceConfig{Name: "errorstest"}})
+
+	expected := strconv.FormatUint(FetchErrors.Counts()["errorstest"]+2, 10)
+
+	FetchErrors.Inc("errorstest")
+	FetchErrors.Inc("errorstest")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan MqttCronMessage)
+
+	go ErrorsLoop(ctx, ch, running.get, 10*time.Millisecond)
+
+	if m := receive(t, ch); m.Topic != "magpie/errors/errorstest" || m.Payload != expected || !m.Critical {
+		t.Fatalf("expected a critical count of %s, got %+v", expected, m)
+	}
+
+	running.set(RunningSource{Config: SourceConfig{Name: "errorsother"}})
+
+	for i := 0; i < 3; i++ {
+		if m := receive(t, ch); m.Topic == "magpie/errors/errorsother" {
+			return
+		}
+	}
+
+	t.Fatal("expected the loop to follow the running sources")
+}
+
+func TestStatusHandlerHealthz(t *testing.T) {
+	for _, c := range []struct {
+		healthy bool
+		code    int
+	}{
+		{healthy: true, code: http.StatusOK},
+		{healthy: false, code: http.StatusServiceUnavailable},
+	} {
+		recorder := httptest.NewRecorder()
+
+		StatusHandler(func() bool { return c.healthy }).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		if recorder.Code != c.code {
+			t.Errorf("expected %d while healthy is %t, got %d", c.code, c.healthy, recorder.Code)
+		}
+	}
+}
+
+func TestStatusHandlerMetrics(t *testing.T) {
+	before := PublishedMessages.Counts()["metrics-test"]
+
+	publishAll([]Sink{NewMemorySink()}, nil,
+		MqttCronMessage{Source: "metrics-test", Topic: "a", Payload: "1"},
+		MqttCronMessage{Source: "metrics-test", Topic: "b", Payload: "2"},
+	)
+
+	FetchErrors.Inc("metrics-test")
+
+	recorder := httptest.NewRecorder()
+
+	StatusHandler(func() bool { return true }).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("expected the Prometheus text format, got %d with `%s`", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	for _, line := range []string{
+		"# TYPE magpie_messages_published_total counter",
+		fmt.Sprintf("magpie_messages_published_total{source=\"metrics-test\"} %d", PublishedMessages.Counts()["metrics-test"]),
+		fmt.Sprintf("magpie_fetch_errors_total{source=\"metrics-test\"} %d", FetchErrors.Counts()["metrics-test"]),
+		"# TYPE magpie_publish_failures_total counter",
+		"# TYPE magpie_messages_dropped_total counter",
+	} {
+		if !strings.Contains(recorder.Body.String(), line+"\n") {
+			t.Errorf("expected %q in the metrics, got %q", line, recorder.Body.String())
+		}
+	}
+
+	if count := PublishedMessages.Counts()["metrics-test"] - before; count != 2 {
+		t.Errorf("expected 2 more published messages, got %d", count)
+	}
+}
+
+func TestPublishMessageCountsFailedPublishesSeparately(t *testing.T) {
+	published, failures := PublishedMessages.Counts()["failures-test"], FailedPublishes.Counts()["failures-test"]
+	up, down := NewMemorySink(), &flakySink{down: true}
+	m := MqttCronMessage{Source: "failures-test", Topic: "a", Payload: "1"}
+
+	publishAll([]Sink{up, down}, nil, m)
+	publishAll([]Sink{down}, nil, m)
+
+	if count := PublishedMessages.Counts()["failures-test"] - published; count != 1 {
+		t.Errorf("expected 1 more published message, got %d", count)
+	}
+
+	if count := FailedPublishes.Counts()["failures-test"] - failures; count != 2 {
+		t.Errorf("expected 2 more failed publishes, got %d", count)
+	}
+}
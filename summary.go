@@ -0,0 +1,194 @@
+package magpie
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* The resolved settings of a single source. */
+type SourceSummary struct {
+	Name     string            `json:"name"`
+	Enabled  bool              `json:"enabled"`
+	Settings map[string]string `json:"settings"`
+}
+
+/* The resolved settings of magpie itself and of every source. */
+type ConfigSummary struct {
+	Settings map[string]string `json:"settings"`
+	Sources  []SourceSummary   `json:"sources"`
+}
+
+/* A source that runs along with its interval. */
+type ActiveSource struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval"`
+}
+
+/* The sources that run, announced on `magpie/sources` once connected. */
+type ActiveSources struct {
+	Count   int            `json:"count"`
+	Sources []ActiveSource `json:"sources"`
+}
+
+/* Collect the enabled sources of the configuration in the order of the
+ * registry. */
+func ActiveSourcesFromConfig(config Config) ActiveSources {
+	active := ActiveSources{Sources: []ActiveSource{}}
+
+	for _, source := range config.Sources {
+		if !source.Enabled {
+			continue
+		}
+
+		active.Sources = append(active.Sources, ActiveSource{Name: source.Name, Interval: source.Interval.String()})
+	}
+
+	active.Count = len(active.Sources)
+
+	return active
+}
+
+/* Resolve a recognized variable through `lookup`, falling back to its
+ * default. Secrets are redacted. */
+func summarizeValue(v EnvVar, lookup func(string) (string, bool)) (string, bool) {
+	value, exists := lookup(v.Name)
+
+	if !exists {
+		return v.Default, v.Default != ""
+	}
+
+	if v.Secret {
+		return "<redacted>", true
+	}
+
+	return value, true
+}
+
+/* The resolved values of the settings of magpie itself that `Config`
+ * holds, keyed by the variable they are read from. */
+func resolvedSettings(config Config) map[string]string {
+	return map[string]string{
+		"MQTT_PREFIX":             config.Prefix,
+		"MQTT_CLIENT_ID":          config.ClientId,
+		"MQTT_AVAILABILITY_TOPIC": config.AvailabilityTopic,
+		"MQTT_QOS":                strconv.Itoa(int(config.Qos)),
+		"MQTT_QUEUE_SIZE":         strconv.Itoa(config.QueueSize),
+		"MQTT_QUEUE_POLICY":       string(config.QueuePolicy),
+		"MQTT_RECONNECT_INTERVAL": config.ReconnectInterval.String(),
+		"BACKOFF_MAX":             config.BackoffMax.String(),
+		"MAGPIE_START_JITTER":     config.StartJitter.String(),
+		"MAGPIE_ERRORS_INTERVAL":  config.ErrorsInterval.String(),
+		"MAGPIE_STALE_MULTIPLIER": strconv.FormatFloat(config.StaleMultiplier, 'f', -1, 64),
+		"MAGPIE_HTTP_TIMEOUT":     config.HttpTimeout.String(),
+	}
+}
+
+/* The resolved values of the settings every enabled source has, keyed by
+ * the variable they are read from. The start delay is left out as it can
+ * be random. */
+func resolvedSourceSettings(source SourceConfig) map[string]string {
+	prefix := strings.ToUpper(source.Name)
+
+	settings := map[string]string{
+		prefix + "_TOPIC":          source.Topic,
+		prefix + "_PREFIX":         source.Prefix,
+		prefix + "_RETAIN":         strconv.FormatBool(source.Retain),
+		prefix + "_INTERVAL":       source.Interval.String(),
+		prefix + "_ROUND_DECIMALS": strconv.Itoa(source.RoundDecimals),
+	}
+
+	if source.Location != nil {
+		settings[prefix+"_TIMEZONE"] = source.Location.String()
+	}
+
+	if EnvKnown(prefix+"_LATITUDE") && source.CoordinatesErr == nil {
+		settings[prefix+"_LATITUDE"] = strconv.FormatFloat(source.Coordinates.Latitude, 'f', -1, 64)
+		settings[prefix+"_LONGITUDE"] = strconv.FormatFloat(source.Coordinates.Longitude, 'f', -1, 64)
+	}
+
+	return settings
+}
+
+/* Summarize the resolved configuration. Settings that `config` resolves
+ * show their resolved value, the others the value they were read from or
+ * their default. Secrets are redacted. */
+func SummarizeConfig(config Config) ConfigSummary {
+	summary := ConfigSummary{Settings: make(map[string]string)}
+	sources := make(map[string]*SourceSummary)
+
+	for _, v := range EnvVars {
+		if v.Source != "" {
+			continue
+		}
+
+		if value, exists := summarizeValue(v, config.Lookup); exists {
+			summary.Settings[v.Name] = value
+		}
+	}
+
+	for name, value := range resolvedSettings(config) {
+		if EnvKnown(name) {
+			summary.Settings[name] = value
+		}
+	}
+
+	for _, source := range config.Sources {
+		sources[source.Name] = &SourceSummary{Name: source.Name, Enabled: source.Enabled, Settings: make(map[string]string)}
+	}
+
+	for _, v := range EnvVars {
+		source, exists := sources[v.Source]
+
+		if !exists {
+			continue
+		}
+
+		if value, exists := summarizeValue(v, config.Lookup); exists {
+			source.Settings[v.Name] = value
+		}
+	}
+
+	for _, source := range config.Sources {
+		if source.Enabled {
+			for name, value := range resolvedSourceSettings(source) {
+				if EnvKnown(name) {
+					sources[source.Name].Settings[name] = value
+				}
+			}
+		}
+
+		summary.Sources = append(summary.Sources, *sources[source.Name])
+	}
+
+	return summary
+}
+
+/* Format settings as `NAME='value'` pairs in a stable order. */
+func formatSettings(settings map[string]string) string {
+	var pairs []string
+
+	for name, value := range settings {
+		pairs = append(pairs, fmt.Sprintf("%s='%s'", name, value))
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ", ")
+}
+
+/* Describe the summary in lines suitable for logging. */
+func (s ConfigSummary) Lines() []string {
+	lines := []string{fmt.Sprintf("magpie settings %s.", formatSettings(s.Settings))}
+
+	for _, source := range s.Sources {
+		if source.Enabled {
+			lines = append(lines, fmt.Sprintf("magpie source `%s` enabled, %s.", source.Name, formatSettings(source.Settings)))
+		} else {
+			lines = append(lines, fmt.Sprintf("magpie source `%s` disabled.", source.Name))
+		}
+	}
+
+	return lines
+}
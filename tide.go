@@ -0,0 +1,180 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var tideLog = NewLogger("tide")
+
+/* Predictions are fetched again once they are this old. */
+const tideRefresh = 6 * time.Hour
+
+/* A predicted high or low tide from the NOAA CO-OPS API, `T` is in UTC as
+ * `YYYY-MM-DD HH:MM`, `V` is the height in meters and `Type` either `H` or
+ * `L`. */
+type TideAPIPrediction struct {
+	T    string `json:"t"`
+	V    string `json:"v"`
+	Type string `json:"type"`
+}
+
+type TideAPIError struct {
+	Message string `json:"message"`
+}
+
+/* Result from the NOAA CO-OPS API. */
+type TideAPIResult struct {
+	Predictions []TideAPIPrediction `json:"predictions"`
+	Error       *TideAPIError       `json:"error"`
+}
+
+/* A high or low tide at `Time` of `Height` meters. */
+type Tide struct {
+	Time   time.Time
+	Height float64
+	High   bool
+}
+
+/* Parse a response of the NOAA CO-OPS API into the predicted tides in
+ * order of their time. */
+func ParseTides(body []byte) ([]Tide, error) {
+	var apiResult TideAPIResult
+	var tides []Tide
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return nil, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if apiResult.Error != nil {
+		return nil, fmt.Errorf("the response was an error: %s", apiResult.Error.Message)
+	}
+
+	for _, prediction := range apiResult.Predictions {
+		t, err := time.ParseInLocation("2006-01-02 15:04", prediction.T, time.UTC)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not parse `%s` as time", prediction.T)
+		}
+
+		height, err := strconv.ParseFloat(strings.TrimSpace(prediction.V), 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not parse `%s` as height", prediction.V)
+		}
+
+		tides = append(tides, Tide{Time: t, Height: height, High: prediction.Type == "H"})
+	}
+
+	return tides, nil
+}
+
+/* The first high, or low, tide after `now`, reports false when there is
+ * none. */
+func NextTide(tides []Tide, now time.Time, high bool) (Tide, bool) {
+	for _, tide := range tides {
+		if tide.High == high && tide.Time.After(now) {
+			return tide, true
+		}
+	}
+
+	return Tide{}, false
+}
+
+/* The water is `rising` towards a high tide or `falling` towards a low
+ * tide, empty when there is no tide after `now`. */
+func TideTrend(tides []Tide, now time.Time) string {
+	for _, tide := range tides {
+		if tide.Time.After(now) {
+			if tide.High {
+				return "rising"
+			}
+
+			return "falling"
+		}
+	}
+
+	return ""
+}
+
+/* Call the NOAA CO-OPS API and return the predicted tides of `station` for
+ * two days from `now`. */
+func TideAPICall(ctx context.Context, station string, now time.Time) ([]Tide, error) {
+	apiUrl := fmt.Sprintf("https://api.tidesandcurrents.noaa.gov/api/prod/datagetter?product=predictions&datum=MLLW&interval=hilo&units=metric&time_zone=gmt&format=json&application=magpie&station=%s&begin_date=%s&range=48", url.QueryEscape(station), now.UTC().Format("20060102"))
+
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTides(body)
+}
+
+/* A loop that fetches the tide predictions of the station in
+ * `TIDE_STATION` from the NOAA CO-OPS API a few times per day and submits
+ * the next high and low tide, and whether the water is rising or falling,
+ * to subtopics of the topic given in the environment variable
+ * `TIDE_TOPIC` every interval. */
+func TideLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	station := strings.TrimSpace(cfg.Get("TIDE_STATION"))
+
+	if station == "" {
+		tideLog.Println("TideLoop needs `TIDE_STATION` set in the environment to a station id such as `9414290`, disabled.")
+		return
+	}
+
+	tideLog.Println("TideLoop enabled.")
+
+	var tides []Tide
+	var fetched time.Time
+
+	for {
+		now := cfg.Now()
+
+		if now.Sub(fetched) >= tideRefresh {
+			if !fetchWithRetry(ctx, cfg, tideLog, "TideLoop could not fetch the tides", func() error {
+				var err error
+
+				tides, err = TideAPICall(ctx, station, now)
+
+				return err
+			}) {
+				return
+			}
+
+			fetched = now
+		}
+
+		var msgs []MqttCronMessage
+
+		if high, exists := NextTide(tides, now, true); exists {
+			msgs = append(msgs, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "next_high"), Payload: high.Time.Format(time.RFC3339)})
+		}
+
+		if low, exists := NextTide(tides, now, false); exists {
+			msgs = append(msgs, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "next_low"), Payload: low.Time.Format(time.RFC3339)})
+		}
+
+		if trend := TideTrend(tides, now); trend != "" {
+			msgs = append(msgs, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "trend"), Payload: trend})
+		} else {
+			tideLog.Warnln("TideLoop has no predicted tides after now.")
+		}
+
+		for _, m := range msgs {
+			if !sendMessage(ctx, ch, m) {
+				return
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
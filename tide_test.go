@@ -0,0 +1,68 @@
+package magpie
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseTides(t *testing.T) {
+	body, err := os.ReadFile("testdata/tide.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tides, err := ParseTides(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tides) != 4 {
+		t.Fatalf("expected 4 tides, got %d", len(tides))
+	}
+
+	if expected := (Tide{Time: time.Date(2026, 6, 21, 9, 27, 0, 0, time.UTC), Height: 1.875, High: true}); tides[1] != expected {
+		t.Fatalf("expected %+v, got %+v", expected, tides[1])
+	}
+
+	for _, c := range []struct {
+		at    time.Time
+		high  string
+		low   string
+		trend string
+	}{
+		{at: time.Date(2026, 6, 21, 1, 0, 0, 0, time.UTC), high: "09:27", low: "03:12", trend: "falling"},
+		{at: time.Date(2026, 6, 21, 3, 12, 0, 0, time.UTC), high: "09:27", low: "15:31", trend: "rising"},
+		{at: time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC), high: "21:48", low: "15:31", trend: "falling"},
+		{at: time.Date(2026, 6, 21, 18, 0, 0, 0, time.UTC), high: "21:48", low: "", trend: "rising"},
+		{at: time.Date(2026, 6, 21, 22, 0, 0, 0, time.UTC), high: "", low: "", trend: ""},
+	} {
+		var high, low string
+
+		if tide, found := NextTide(tides, c.at, true); found {
+			high = tide.Time.Format("15:04")
+		}
+
+		if tide, found := NextTide(tides, c.at, false); found {
+			low = tide.Time.Format("15:04")
+		}
+
+		if high != c.high || low != c.low || TideTrend(tides, c.at) != c.trend {
+			t.Errorf("expected high at `%s`, low at `%s`, and `%s` at %s, got `%s`, `%s`, and `%s`", c.high, c.low, c.trend, c.at.Format("15:04"), high, low, TideTrend(tides, c.at))
+		}
+	}
+}
+
+func TestParseTidesRefusesErrors(t *testing.T) {
+	for _, body := range []string{
+		`{"error": {"message": "No Predictions data was found. Please make sure the Datum input is valid."}}`,
+		`{"predictions": [{"t": "21-06-2026 03:12", "v": "0.412", "type": "L"}]}`,
+		`{"predictions": [{"t": "2026-06-21 03:12", "v": "low", "type": "L"}]}`,
+	} {
+		if _, err := ParseTides([]byte(body)); err == nil {
+			t.Errorf("expected %s to be refused", body)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package magpie
+
+import (
+	"fmt"
+	"time"
+
+	/* Embedded so timezones load in containers without a timezone database. */
+	_ "time/tzdata"
+)
+
+/* Load the timezone for `<prefix>_TIMEZONE`, falling back to
+ * `MAGPIE_TIMEZONE` and then to UTC. */
+func LocationFromEnv(lookup func(string) (string, bool), prefix string) (*time.Location, error) {
+	for _, name := range []string{fmt.Sprintf("%s_TIMEZONE", prefix), "MAGPIE_TIMEZONE"} {
+		if timezoneFromEnv, timezoneExists := lookup(name); timezoneExists {
+			loc, err := time.LoadLocation(timezoneFromEnv)
+
+			if err != nil {
+				return nil, fmt.Errorf("could not load timezone `%s='%s'`", name, timezoneFromEnv)
+			}
+
+			return loc, nil
+		}
+	}
+
+	return time.UTC, nil
+}
@@ -0,0 +1,38 @@
+package magpie
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimezoneDecidesSeasonAndDayPhase(t *testing.T) {
+	now := time.Date(2026, 2, 28, 12, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		timezone string
+		season   string
+		phase    string
+	}{
+		{timezone: "UTC", season: "winter", phase: "afternoon"},
+		{timezone: "Pacific/Auckland", season: "spring", phase: "night"},
+	} {
+		config, err := ConfigFromLookup(mapLookup(map[string]string{
+			"STDOUT_SINK":     "1",
+			"MAGPIE_TIMEZONE": c.timezone,
+			"SEASON_TOPIC":    "season",
+			"DAYPHASE_TOPIC":  "dayphase",
+		}))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m := firstMessageAt(t, SeasonLoop, config.Source("season"), now); m.Payload != c.season {
+			t.Errorf("expected the season `%s` in %s, got `%s`", c.season, c.timezone, m.Payload)
+		}
+
+		if m := firstMessageAt(t, DayPhaseLoop, config.Source("dayphase"), now); m.Payload != c.phase {
+			t.Errorf("expected the day phase `%s` in %s, got `%s`", c.phase, c.timezone, m.Payload)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package magpie
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	topicStyleMutex sync.Mutex
+	topicStyle      = "dotted"
+)
+
+/* Parse how the names of metrics become subtopics, either `dotted` where
+ * `temperature.ground` is a single level or `nested` where it is
+ * `temperature/ground`. An empty style is `dotted`. */
+func ParseTopicStyle(style string) (string, error) {
+	switch style {
+	case "":
+		return "dotted", nil
+	case "dotted", "nested":
+		return style, nil
+	}
+
+	return "", fmt.Errorf("could not use `MAGPIE_TOPIC_STYLE='%s'`, expected `dotted` or `nested`", style)
+}
+
+/* Select how the names of metrics become subtopics, see `ParseTopicStyle`,
+ * safe to change while sources publish. */
+func SetTopicStyle(style string) error {
+	style, err := ParseTopicStyle(style)
+
+	if err != nil {
+		return err
+	}
+
+	topicStyleMutex.Lock()
+	defer topicStyleMutex.Unlock()
+
+	topicStyle = style
+
+	return nil
+}
+
+/* Join the topic of a source with the names below it into a single topic.
+ * The first part is used as configured, dots in the other parts become
+ * levels of their own in the `nested` style. */
+func buildTopic(parts ...string) string {
+	topicStyleMutex.Lock()
+	nested := topicStyle == "nested"
+	topicStyleMutex.Unlock()
+
+	for idx := 1; idx < len(parts); idx++ {
+		if nested {
+			parts[idx] = strings.ReplaceAll(parts[idx], ".", "/")
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+/* Collect the base topics of the enabled sources below their prefix, as
+ * they are published, keyed by their environment variable. */
+func (c Config) SourceTopics() map[string]string {
+	topics := make(map[string]string)
+
+	for _, source := range c.Sources {
+		if source.Enabled {
+			topics[strings.ToUpper(source.Name)+"_TOPIC"] = PrefixTopic(source.Prefix, source.Topic)
+		}
+	}
+
+	return topics
+}
+
+/* Determine if two topics overlap, either because they are the same or
+ * because one is nested below the other. */
+func topicsOverlap(a string, b string) bool {
+	a = strings.Trim(a, "/") + "/"
+	b = strings.Trim(b, "/") + "/"
+
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+/* Find the overlapping base topics, returns a description of every
+ * overlapping pair. */
+func TopicCollisions(topics map[string]string) []string {
+	var names []string
+	var collisions []string
+
+	for name := range topics {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			if topicsOverlap(topics[a], topics[b]) {
+				collisions = append(collisions, fmt.Sprintf("`%s` at `%s` overlaps with `%s` at `%s`", a, topics[a], b, topics[b]))
+			}
+		}
+	}
+
+	return collisions
+}
+
+/* Returned by `CheckTopics` when topics overlap and `STRICT_TOPICS=1`. */
+var ErrTopicsOverlap = errors.New("refusing to start with overlapping topics when `STRICT_TOPICS=1`")
+
+/* Find the overlapping base topics of the enabled sources below their
+ * prefixes, overlapping topics are an error when the configuration is
+ * strict about them. */
+func CheckTopics(config Config) ([]string, error) {
+	collisions := TopicCollisions(config.SourceTopics())
+
+	if len(collisions) > 0 && config.StrictTopics {
+		return collisions, ErrTopicsOverlap
+	}
+
+	return collisions, nil
+}
@@ -0,0 +1,91 @@
+package magpie
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTopicCollisions(t *testing.T) {
+	collisions := TopicCollisions(map[string]string{
+		"WEATHER_TOPIC":  "home/weather",
+		"SNOW_TOPIC":     "home/weather/snow",
+		"SEASON_TOPIC":   "home/season",
+		"DAYPHASE_TOPIC": "home/seasonal",
+	})
+
+	if len(collisions) != 1 || collisions[0] != "`SNOW_TOPIC` at `home/weather/snow` overlaps with `WEATHER_TOPIC` at `home/weather`" {
+		t.Fatalf("expected only the snow topic below the weather topic, got %q", collisions)
+	}
+
+	if collisions := TopicCollisions(map[string]string{"SEASON_TOPIC": "season", "DAYPHASE_TOPIC": "/season/"}); len(collisions) != 1 {
+		t.Fatalf("expected the same topic with slashes to overlap, got %q", collisions)
+	}
+}
+
+func TestCheckTopicsRefusesOverlapWhenStrict(t *testing.T) {
+	settings := map[string]string{"STDOUT_SINK": "1", "SEASON_TOPIC": "home", "DAYPHASE_TOPIC": "home/dayphase"}
+
+	config, err := ConfigFromLookup(mapLookup(settings))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if collisions, err := CheckTopics(config); len(collisions) != 1 || err != nil {
+		t.Fatalf("expected a single collision to only be reported, got %q and %v", collisions, err)
+	}
+
+	settings["STRICT_TOPICS"] = "1"
+
+	if config, err = ConfigFromLookup(mapLookup(settings)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CheckTopics(config); !errors.Is(err, ErrTopicsOverlap) {
+		t.Fatalf("expected overlapping topics to be refused, got %v", err)
+	}
+
+	delete(settings, "DAYPHASE_TOPIC")
+
+	if config, err = ConfigFromLookup(mapLookup(settings)); err != nil {
+		t.Fatal(err)
+	}
+
+	if collisions, err := CheckTopics(config); len(collisions) != 0 || err != nil {
+		t.Fatalf("expected no collisions, got %q and %v", collisions, err)
+	}
+}
+
+func TestCheckTopicsComparesPrefixedTopics(t *testing.T) {
+	settings := map[string]string{"STDOUT_SINK": "1", "STRICT_TOPICS": "1", "SEASON_TOPIC": "home", "DAYPHASE_TOPIC": "home", "SEASON_PREFIX": "outside", "DAYPHASE_PREFIX": "inside"}
+
+	config, err := ConfigFromLookup(mapLookup(settings))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if collisions, err := CheckTopics(config); len(collisions) != 0 || err != nil {
+		t.Fatalf("expected the same topic below distinct prefixes not to overlap, got %q and %v", collisions, err)
+	}
+
+	settings["DAYPHASE_PREFIX"] = "outside"
+
+	if config, err = ConfigFromLookup(mapLookup(settings)); err != nil {
+		t.Fatal(err)
+	}
+
+	if collisions, err := CheckTopics(config); len(collisions) != 1 || collisions[0] != "`DAYPHASE_TOPIC` at `outside/home` overlaps with `SEASON_TOPIC` at `outside/home`" || !errors.Is(err, ErrTopicsOverlap) {
+		t.Fatalf("expected the same topic below the same prefix to overlap, got %q and %v", collisions, err)
+	}
+}
+
+func TestBuildTopicKeepsTheSourceTopic(t *testing.T) {
+	defer SetTopicStyle(topicStyle)
+
+	SetTopicStyle("nested")
+
+	if topic := buildTopic("home.arpa/weather", "venlo", "temperature.ground"); topic != "home.arpa/weather/venlo/temperature/ground" {
+		t.Fatalf("expected the dots of the source topic to be kept, got `%s`", topic)
+	}
+}
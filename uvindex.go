@@ -0,0 +1,93 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var uvIndexLog = NewLogger("uvindex")
+
+/* A single UV index reading from the `currentuvindex.com` API. */
+type UVIndexAPIData struct {
+	Time time.Time `json:"time"`
+	UVI  float64   `json:"uvi"`
+}
+
+/* Result from the `currentuvindex.com` API. */
+type UVIndexAPIResult struct {
+	Ok      bool           `json:"ok"`
+	Message string         `json:"message"`
+	Now     UVIndexAPIData `json:"now"`
+}
+
+/* Parse a response of the `currentuvindex.com` API into the current
+ * reading. */
+func ParseUVIndex(body []byte) (UVIndexAPIData, error) {
+	var apiResult UVIndexAPIResult
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return UVIndexAPIData{}, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	if !apiResult.Ok {
+		return UVIndexAPIData{}, fmt.Errorf("the response was not ok: %s", apiResult.Message)
+	}
+
+	return apiResult.Now, nil
+}
+
+/* Call the `currentuvindex.com` API and return the current reading. */
+func UVIndexAPICall(ctx context.Context, apiUrl string) (UVIndexAPIData, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return UVIndexAPIData{}, err
+	}
+
+	return ParseUVIndex(body)
+}
+
+/* A loop that waits between calls to the `currentuvindex.com` API and
+ * submits the current UV index to the topic given in the environment
+ * variable `UVINDEX_TOPIC`. */
+func UVIndexLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	if errors.Is(cfg.CoordinatesErr, ErrCoordinatesMissing) {
+		uvIndexLog.Println("UVIndexLoop needs `UVINDEX_LATITUDE` and `UVINDEX_LONGITUDE`, or `MAGPIE_LATITUDE` and `MAGPIE_LONGITUDE`, set in the environment, disabled.")
+		return
+	}
+
+	if cfg.CoordinatesErr != nil {
+		uvIndexLog.Warnf("UVIndexLoop could not use its coordinates: %s, disabled.\n", cfg.CoordinatesErr)
+		return
+	}
+
+	uvIndexLog.Println("UVIndexLoop enabled.")
+
+	apiUrl := fmt.Sprintf("https://currentuvindex.com/api/v1/uvi?latitude=%f&longitude=%f", cfg.Coordinates.Latitude, cfg.Coordinates.Longitude)
+
+	for {
+		var apiResult UVIndexAPIData
+
+		if !fetchWithRetry(ctx, cfg, uvIndexLog, "UVIndexLoop could not fetch the UV index", func() error {
+			var err error
+
+			apiResult, err = UVIndexAPICall(ctx, apiUrl)
+
+			return err
+		}) {
+			return
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: strconv.FormatFloat(apiResult.UVI, 'f', -1, 64)}) {
+			return
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
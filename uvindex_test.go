@@ -0,0 +1,31 @@
+package magpie
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseUVIndex(t *testing.T) {
+	body, err := os.ReadFile("testdata/uvindex.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reading, err := ParseUVIndex(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reading.UVI != 6.3 || !reading.Time.Equal(time.Date(2026, 6, 21, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected a UV index of 6.3 at 11:00, got %+v", reading)
+	}
+}
+
+func TestParseUVIndexNotOk(t *testing.T) {
+	if _, err := ParseUVIndex([]byte(`{"ok":false,"message":"Invalid latitude"}`)); err == nil {
+		t.Fatal("expected a response that is not ok to be an error")
+	}
+}
@@ -0,0 +1,16 @@
+package magpie
+
+import "fmt"
+
+/* Build information, set at build time with
+ * `-ldflags "-X github.com/petspalace/magpie.Version=..."`. */
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+/* Describe the build as `<version> (<commit>, <date>)`. */
+func VersionString() string {
+	return fmt.Sprintf("%s (%s, %s)", Version, Commit, BuildDate)
+}
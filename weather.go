@@ -0,0 +1,452 @@
+package magpie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+/* Normalized metrics published below `Topic`. Readings of a station name
+ * it in `Station` and carry the time of the measurement when known, other
+ * readings such as the number of matched stations leave both empty. */
+type WeatherReading struct {
+	Topic   string
+	Station string
+	Time    time.Time
+	Metrics []Metric
+}
+
+/* A backend of the weather source, selected with `WEATHER_PROVIDER`. */
+type WeatherProvider interface {
+	Readings(ctx context.Context) ([]WeatherReading, error)
+}
+
+/* Set up the provider named in `WEATHER_PROVIDER`, reports false after
+ * logging why when the source lacks the settings the provider needs. */
+func weatherProviderFromConfig(cfg SourceConfig, arrow bool) (WeatherProvider, bool) {
+	switch providerFromEnv := cfg.Get("WEATHER_PROVIDER"); providerFromEnv {
+	case "", "buienradar":
+		regionFromEnv, regionExists := cfg.Lookup("WEATHER_REGION")
+		codeFromEnv := cfg.Get("WEATHER_STATION_CODE")
+
+		if !regionExists && codeFromEnv == "" {
+			weatherLog.Println("WeatherLoop needs `WEATHER_REGION` or `WEATHER_STATION_CODE` set in the environment, disabled.")
+			return nil, false
+		}
+
+		provider := &BuienradarProvider{FeedUrl: cfg.Get("WEATHER_FEED_URL"), Topic: cfg.Topic, Code: codeFromEnv, Arrow: arrow}
+
+		if codeFromEnv == "" {
+			provider.Regions = ParseWeatherRegions(regionFromEnv)
+		}
+
+		return provider, true
+	case "openmeteo":
+		if errors.Is(cfg.CoordinatesErr, ErrCoordinatesMissing) {
+			weatherLog.Println("WeatherLoop needs `WEATHER_LATITUDE` and `WEATHER_LONGITUDE`, or `MAGPIE_LATITUDE` and `MAGPIE_LONGITUDE`, set in the environment for `WEATHER_PROVIDER=openmeteo`, disabled.")
+			return nil, false
+		}
+
+		if cfg.CoordinatesErr != nil {
+			weatherLog.Warnf("WeatherLoop could not use its coordinates: %s, disabled.\n", cfg.CoordinatesErr)
+			return nil, false
+		}
+
+		return &OpenMeteoProvider{Topic: cfg.Topic, Coordinates: cfg.Coordinates, Arrow: arrow}, true
+	default:
+		weatherLog.Warnf("WeatherLoop could not use `WEATHER_PROVIDER='%s'`, expected `buienradar` or `openmeteo`, disabled.\n", providerFromEnv)
+		return nil, false
+	}
+}
+
+/* The temperature in °C it feels like, the wind chill of Environment Canada
+ * at or below 10°C with wind above 4.8 km/h and the heat index of the US
+ * National Weather Service at or above 27°C. Otherwise it is the
+ * temperature itself. `windMS` is in m/s and `humidity` in percent. */
+func ApparentTemperature(tempC, windMS, humidity float64) float64 {
+	windKMH := windMS * 3.6
+
+	if tempC <= 10 && windKMH > 4.8 {
+		v := math.Pow(windKMH, 0.16)
+
+		return 13.12 + 0.6215*tempC - 11.37*v + 0.3965*tempC*v
+	}
+
+	if tempC >= 27 {
+		t := tempC*9/5 + 32
+		rh := humidity
+
+		hi := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+
+		if (hi+t)/2 >= 80 {
+			hi = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh - 0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+
+			switch {
+			case rh < 13 && t <= 112:
+				hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+			case rh > 85 && t <= 87:
+				hi += (rh - 85) / 10 * (87 - t) / 5
+			}
+		}
+
+		return (hi - 32) * 5 / 9
+	}
+
+	return tempC
+}
+
+/* Derive `temperature.apparent` rounded to a tenth of a degree from the
+ * temperature, wind, and humidity among `metrics`, reports false when any
+ * of them is missing. */
+func ApparentTemperatureMetric(metrics []Metric) (Metric, bool) {
+	values := make(map[string]float64)
+
+	for _, metric := range metrics {
+		switch metric.Name {
+		case "temperature.ground", "wind", "humidity":
+			if number, err := strconv.ParseFloat(metric.Value, 64); err == nil {
+				values[metric.Name] = number
+			}
+		}
+	}
+
+	if len(values) != 3 {
+		return Metric{}, false
+	}
+
+	apparent := math.Round(ApparentTemperature(values["temperature.ground"], values["wind"], values["humidity"])*10) / 10
+
+	return Metric{Name: "temperature.apparent", Value: strconv.FormatFloat(apparent, 'f', -1, 64)}, true
+}
+
+/* Convert a wind speed in m/s to km/h. */
+func MSToKMH(ms float64) float64 {
+	return ms * 3.6
+}
+
+/* The lowest wind speed in m/s of every Beaufort number from 1 to 12. */
+var beaufortScale = []float64{0.3, 1.6, 3.4, 5.5, 8.0, 10.8, 13.9, 17.2, 20.8, 24.5, 28.5, 32.7}
+
+/* Convert a wind speed in m/s to its number on the Beaufort scale, from `0`
+ * for calm to `12` for hurricane force. */
+func MSToBeaufort(ms float64) int {
+	number := 0
+
+	for _, lowest := range beaufortScale {
+		if ms >= lowest {
+			number++
+		}
+	}
+
+	return number
+}
+
+/* The units `WEATHER_WIND_UNIT` accepts and how Home Assistant names them. */
+var WindUnits = map[string]string{
+	"ms":  "m/s",
+	"kmh": "km/h",
+	"bft": "Beaufort",
+}
+
+/* Convert `wind` and `gust` among `metrics` from m/s to `unit`, km/h is
+ * rounded to a tenth. When `beaufort` is set the Beaufort number of the
+ * wind is added as `wind.bft`. */
+func ConvertWindMetrics(metrics []Metric, unit string, beaufort bool) []Metric {
+	var converted []Metric
+
+	for _, metric := range metrics {
+		if metric.Name != "wind" && metric.Name != "gust" {
+			converted = append(converted, metric)
+			continue
+		}
+
+		ms, err := strconv.ParseFloat(metric.Value, 64)
+
+		if err != nil {
+			converted = append(converted, metric)
+			continue
+		}
+
+		if metric.Name == "wind" && beaufort {
+			converted = append(converted, Metric{Name: "wind.bft", Value: strconv.Itoa(MSToBeaufort(ms))})
+		}
+
+		switch unit {
+		case "kmh":
+			metric.Value = strconv.FormatFloat(math.Round(MSToKMH(ms)*10)/10, 'f', -1, 64)
+		case "bft":
+			metric.Value = strconv.Itoa(MSToBeaufort(ms))
+		}
+
+		converted = append(converted, metric)
+	}
+
+	return converted
+}
+
+/* Derive `gust.alert` as `yes` when the gust among `metrics` in m/s exceeds
+ * `threshold` and `no` otherwise, reports false when the gust is not
+ * known. */
+func GustAlertMetric(metrics []Metric, threshold float64) (Metric, bool) {
+	for _, metric := range metrics {
+		if metric.Name != "gust" {
+			continue
+		}
+
+		gust, err := strconv.ParseFloat(metric.Value, 64)
+
+		if err != nil {
+			return Metric{}, false
+		}
+
+		return Metric{Name: "gust.alert", Value: yesNo(gust > threshold)}, true
+	}
+
+	return Metric{}, false
+}
+
+/* Number of readings the pressure trend is taken over. */
+const pressureHistorySize = 6
+
+/* Determine the trend of the air pressure over `pressures` in order of
+ * their measurement, `rising` or `falling` when it changed by more than
+ * `threshold` and `steady` otherwise. */
+func PressureTrend(pressures []float64, threshold float64) string {
+	if len(pressures) < 2 {
+		return "steady"
+	}
+
+	change := pressures[len(pressures)-1] - pressures[0]
+
+	switch {
+	case change > threshold:
+		return "rising"
+	case change < -threshold:
+		return "falling"
+	default:
+		return "steady"
+	}
+}
+
+/* An air pressure in hPa and the time it was measured. */
+type PressureReading struct {
+	Time     time.Time
+	Pressure float64
+}
+
+/* Keeps the last air pressures per topic, a measurement with the same time
+ * as the one before is only kept once. */
+type PressureHistory map[string][]PressureReading
+
+/* Remember the pressure of a reading and derive `pressure.trend` from the
+ * pressures so far, reports false when the reading has no pressure or it is
+ * the first one. */
+func (h PressureHistory) Trend(reading WeatherReading, threshold float64) (Metric, bool) {
+	var current PressureReading
+	var present bool
+
+	for _, metric := range reading.Metrics {
+		if metric.Name == "pressure" {
+			number, err := strconv.ParseFloat(metric.Value, 64)
+			current, present = PressureReading{Time: reading.Time, Pressure: number}, err == nil
+		}
+	}
+
+	if !present {
+		return Metric{}, false
+	}
+
+	history := h[reading.Topic]
+
+	if last := len(history) - 1; last < 0 || current.Time.IsZero() || !history[last].Time.Equal(current.Time) {
+		history = append(history, current)
+	}
+
+	if len(history) > pressureHistorySize {
+		history = history[len(history)-pressureHistorySize:]
+	}
+
+	h[reading.Topic] = history
+
+	if len(history) < 2 {
+		return Metric{}, false
+	}
+
+	var pressures []float64
+
+	for _, past := range history {
+		pressures = append(pressures, past.Pressure)
+	}
+
+	return Metric{Name: "pressure.trend", Value: PressureTrend(pressures, threshold)}, true
+}
+
+/* The settings of the weather source besides its provider. */
+type weatherSettings struct {
+	format        string
+	metricNames   MetricNames
+	dedup         bool
+	threshold     float64
+	windUnit      string
+	arrow         bool
+	beaufort      bool
+	gustThreshold float64
+	gustAlert     bool
+}
+
+/* The expected snowfall of tomorrow in centimeters as `snowfall` and the
+ * chance of snow in percent as `snow.chance`. Neither backend forecasts
+ * the chance of snow itself, it is the chance of precipitation when
+ * snowfall is expected and `0` otherwise. */
+func SnowForecastMetrics(snowfall float64, precipitationChance float64) []Metric {
+	chance := 0.0
+
+	if snowfall > 0 {
+		chance = precipitationChance
+	}
+
+	return []Metric{
+		{Name: "snowfall", Value: strconv.FormatFloat(snowfall, 'f', -1, 64)},
+		{Name: "snow.chance", Value: strconv.FormatFloat(chance, 'f', -1, 64)},
+	}
+}
+
+/* Read and check the settings of the weather source. */
+func weatherSettingsFromConfig(cfg SourceConfig) (weatherSettings, error) {
+	var err error
+
+	settings := weatherSettings{format: cfg.Get("WEATHER_FORMAT"), windUnit: cfg.Get("WEATHER_WIND_UNIT")}
+
+	if providerFromEnv := cfg.Get("WEATHER_PROVIDER"); providerFromEnv != "" && providerFromEnv != "buienradar" && providerFromEnv != "openmeteo" {
+		return settings, fmt.Errorf("could not use `WEATHER_PROVIDER='%s'`, expected `buienradar` or `openmeteo`", providerFromEnv)
+	}
+
+	if settings.format != "" && settings.format != "plain" && settings.format != "json" {
+		return settings, fmt.Errorf("could not use `WEATHER_FORMAT='%s'`, expected `plain` or `json`", settings.format)
+	}
+
+	if settings.metricNames, err = ParseMetricNames(cfg.Get("WEATHER_METRIC_NAMES"), WeatherMetrics); err != nil {
+		return settings, fmt.Errorf("could not parse `WEATHER_METRIC_NAMES`: %w", err)
+	}
+
+	if settings.arrow, err = boolFromEnv(cfg.Lookup, "WEATHER_WIND_ARROW"); err != nil {
+		return settings, err
+	}
+
+	if settings.beaufort, err = boolFromEnv(cfg.Lookup, "WEATHER_WIND_BEAUFORT"); err != nil {
+		return settings, err
+	}
+
+	dedupFromEnv := cfg.Get("WEATHER_DEDUP")
+
+	if settings.dedup, err = strconv.ParseBool(dedupFromEnv); err != nil {
+		return settings, fmt.Errorf("could not parse `WEATHER_DEDUP='%s'` as boolean", dedupFromEnv)
+	}
+
+	thresholdFromEnv := cfg.Get("WEATHER_PRESSURE_THRESHOLD")
+
+	if settings.threshold, err = strconv.ParseFloat(thresholdFromEnv, 64); err != nil || settings.threshold < 0 {
+		return settings, fmt.Errorf("could not use `WEATHER_PRESSURE_THRESHOLD='%s'`, expected a non-negative number", thresholdFromEnv)
+	}
+
+	if _, exists := WindUnits[settings.windUnit]; !exists {
+		return settings, fmt.Errorf("could not use `WEATHER_WIND_UNIT='%s'`, expected `ms`, `kmh`, or `bft`", settings.windUnit)
+	}
+
+	var gustThresholdFromEnv string
+
+	if gustThresholdFromEnv, settings.gustAlert = cfg.Lookup("WEATHER_GUST_THRESHOLD"); settings.gustAlert {
+		if settings.gustThreshold, err = strconv.ParseFloat(gustThresholdFromEnv, 64); err != nil || settings.gustThreshold < 0 {
+			return settings, fmt.Errorf("could not use `WEATHER_GUST_THRESHOLD='%s'`, expected a non-negative number", gustThresholdFromEnv)
+		}
+	}
+
+	return settings, nil
+}
+
+/* A loop that waits between fetching the readings of the weather provider
+ * and submits them to the topic given in the environment variable
+ * `WEATHER_TOPIC`, either as subtopics per metric or as a single JSON
+ * object per station. */
+func WeatherLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	settings, err := weatherSettingsFromConfig(cfg)
+
+	if err != nil {
+		weatherLog.Warnf("WeatherLoop %s, disabled.\n", err)
+		return
+	}
+
+	provider, ok := weatherProviderFromConfig(cfg, settings.arrow)
+
+	if !ok {
+		return
+	}
+
+	published := make(WeatherDedup)
+	pressures := make(PressureHistory)
+
+	for {
+		var readings []WeatherReading
+
+		if !fetchWithRetry(ctx, cfg, weatherLog, "WeatherLoop could not fetch the weather", func() error {
+			var err error
+
+			readings, err = provider.Readings(ctx)
+
+			return err
+		}) {
+			return
+		}
+
+		for _, reading := range readings {
+			if apparent, ok := ApparentTemperatureMetric(reading.Metrics); ok {
+				reading.Metrics = append(reading.Metrics, apparent)
+			}
+
+			if trend, ok := pressures.Trend(reading, settings.threshold); ok {
+				reading.Metrics = append(reading.Metrics, trend)
+			}
+
+			if alert, ok := GustAlertMetric(reading.Metrics, settings.gustThreshold); settings.gustAlert && ok {
+				reading.Metrics = append(reading.Metrics, alert)
+			}
+
+			reading.Metrics = ConvertWindMetrics(reading.Metrics, settings.windUnit, settings.beaufort)
+			reading.Metrics = ConvertTemperatureMetrics(reading.Metrics)
+
+			if reading.Station != "" && !reading.Time.IsZero() {
+				if !published.Changed(reading.Station, reading.Time) && settings.dedup {
+					continue
+				}
+			}
+
+			if reading.Station != "" && settings.format == "json" {
+				payload, err := WeatherJSON(reading.Metrics, settings.metricNames)
+
+				if err != nil {
+					weatherLog.Warnf("WeatherLoop %s.\n", err)
+					continue
+				}
+
+				if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: reading.Topic, Payload: payload}) {
+					return
+				}
+
+				continue
+			}
+
+			for _, metric := range reading.Metrics {
+				if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(reading.Topic, settings.metricNames.Name(metric.Name)), Payload: metric.Value}) {
+					return
+				}
+			}
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
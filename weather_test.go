@@ -0,0 +1,820 @@
+package magpie
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* Serve `testdata/buienradar.xml` as the `buienradar.nl` feed until the
+ * test ends and return its url. */
+func buienradarFeed(t *testing.T) string {
+	t.Helper()
+
+	body, err := os.ReadFile("testdata/buienradar.xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+/* Parse `testdata/buienradar.xml`. */
+func parseWeatherFixture(t *testing.T) WeatherAPIResult {
+	t.Helper()
+
+	body, err := os.ReadFile("testdata/buienradar.xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiResult, err := ParseWeather(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return apiResult
+}
+
+/* Run the weather source against the feed fixture with `settings` and
+ * collect its messages up to the snow forecast, which comes last, of as
+ * many fetches as `rounds`. */
+func weatherLoopMessages(t *testing.T, settings map[string]string, rounds int) []MqttCronMessage {
+	t.Helper()
+
+	var msgs []MqttCronMessage
+
+	settings["STDOUT_SINK"] = "1"
+	settings["WEATHER_TOPIC"] = "weather"
+	settings["WEATHER_FEED_URL"] = buienradarFeed(t)
+
+	config, err := ConfigFromLookup(mapLookup(settings))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan MqttCronMessage)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		WeatherLoop(ctx, ch, config.Source("weather"))
+	}()
+
+	for {
+		m := receive(t, ch)
+		msgs = append(msgs, m)
+
+		if strings.HasSuffix(m.Topic, "snow.chance") || strings.HasSuffix(m.Topic, "snow/chance") {
+			if rounds--; rounds == 0 {
+				break
+			}
+		}
+	}
+
+	cancel()
+	<-done
+
+	return msgs
+}
+
+/* The payload per topic of `msgs`. */
+func payloads(msgs []MqttCronMessage) map[string]string {
+	topics := make(map[string]string)
+
+	for _, m := range msgs {
+		topics[m.Topic] = m.Payload
+	}
+
+	return topics
+}
+
+/* The `station_count` per topic among `readings`. */
+func stationCounts(readings []WeatherReading) map[string]string {
+	counts := make(map[string]string)
+
+	for _, reading := range readings {
+		for _, metric := range reading.Metrics {
+			if metric.Name == "station_count" {
+				counts[reading.Topic] = metric.Value
+			}
+		}
+	}
+
+	return counts
+}
+
+func TestWeatherAPINormalizeValue(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected string
+	}{
+		{value: "-", expected: ""},
+		{value: "", expected: ""},
+		{value: "87", expected: "87"},
+		{value: "1013.25", expected: "1013.25"},
+		{value: "0,3", expected: "0.3"},
+		{value: " 2.1 ", expected: "2.1"},
+		{value: "ZW", expected: "ZW"},
+	} {
+		if value := WeatherAPINormalizeValue(c.value); value != c.expected {
+			t.Errorf("WeatherAPINormalizeValue(%q) = %q, expected %q", c.value, value, c.expected)
+		}
+	}
+}
+
+func TestParseWeather(t *testing.T) {
+	apiResult := parseWeatherFixture(t)
+
+	if len(apiResult.Stations) != 5 {
+		t.Fatalf("expected 5 stations, got %d", len(apiResult.Stations))
+	}
+
+	arcen := apiResult.Stations[0]
+
+	for _, c := range []struct {
+		field    string
+		got      string
+		expected string
+	}{
+		{field: "code", got: arcen.Code, expected: "6391"},
+		{field: "name", got: arcen.Station.Name, expected: "Meetstation Arcen"},
+		{field: "region", got: arcen.Station.Region, expected: "Venlo"},
+		{field: "timestamp", got: arcen.Timestamp, expected: "01/15/2026 14:50:00"},
+		{field: "humidity", got: arcen.Humidity, expected: "87"},
+		{field: "wind direction", got: arcen.WindDirection, expected: "ZW"},
+		{field: "air pressure", got: arcen.AirPressure, expected: "1013.25"},
+		{field: "rain", got: arcen.Rain, expected: "0,3"},
+		{field: "tomorrow's snowfall", got: apiResult.Tomorrow.Snowfall, expected: "2"},
+		{field: "tomorrow's rain chance", got: apiResult.Tomorrow.RainChance, expected: "70"},
+	} {
+		if c.got != c.expected {
+			t.Errorf("expected the %s to be %q, got %q", c.field, c.expected, c.got)
+		}
+	}
+
+	if schiphol := apiResult.Stations[4]; schiphol.Code != "6240" || WeatherAPINormalizeValue(schiphol.Humidity) != "" {
+		t.Errorf("expected Schiphol without a humidity, got %+v", schiphol)
+	}
+
+	if _, err := ParseWeather([]byte("<buienradarnl><weergegevens>")); err == nil {
+		t.Error("expected a truncated feed to be refused")
+	}
+}
+
+func TestSnowForecastMetrics(t *testing.T) {
+	for _, c := range []struct {
+		snowfall float64
+		chance   float64
+		expected []Metric
+	}{
+		{snowfall: 3, chance: 70, expected: []Metric{{Name: "snowfall", Value: "3"}, {Name: "snow.chance", Value: "70"}}},
+		{snowfall: 0, chance: 70, expected: []Metric{{Name: "snowfall", Value: "0"}, {Name: "snow.chance", Value: "0"}}},
+	} {
+		if metrics := SnowForecastMetrics(c.snowfall, c.chance); !reflect.DeepEqual(metrics, c.expected) {
+			t.Errorf("SnowForecastMetrics(%v, %v) = %+v, expected %+v", c.snowfall, c.chance, metrics, c.expected)
+		}
+	}
+}
+
+func TestBuienradarSnowMetrics(t *testing.T) {
+	for _, c := range []struct {
+		forecast WeatherAPIForecastData
+		expected []Metric
+	}{
+		{forecast: WeatherAPIForecastData{Snowfall: "1,5", RainChance: "80"}, expected: []Metric{{Name: "snowfall", Value: "1.5"}, {Name: "snow.chance", Value: "80"}}},
+		{forecast: WeatherAPIForecastData{Snowfall: "2", RainChance: "-"}, expected: []Metric{{Name: "snowfall", Value: "2"}}},
+		{forecast: WeatherAPIForecastData{Snowfall: "-", RainChance: "80"}, expected: nil},
+		{forecast: WeatherAPIForecastData{}, expected: nil},
+	} {
+		if metrics := BuienradarSnowMetrics(c.forecast); !reflect.DeepEqual(metrics, c.expected) {
+			t.Errorf("BuienradarSnowMetrics(%+v) = %+v, expected %+v", c.forecast, metrics, c.expected)
+		}
+	}
+}
+
+func TestWindArrowBoundaries(t *testing.T) {
+	for _, c := range []struct {
+		degrees  float64
+		expected string
+	}{
+		{degrees: 0, expected: "↑"},
+		{degrees: 22.4, expected: "↑"},
+		{degrees: 22.5, expected: "↗"},
+		{degrees: 67.4, expected: "↗"},
+		{degrees: 67.5, expected: "→"},
+		{degrees: 112.5, expected: "↘"},
+		{degrees: 157.5, expected: "↓"},
+		{degrees: 202.5, expected: "↙"},
+		{degrees: 247.5, expected: "←"},
+		{degrees: 292.5, expected: "↖"},
+		{degrees: 337.4, expected: "↖"},
+		{degrees: 337.5, expected: "↑"},
+		{degrees: 360, expected: "↑"},
+		{degrees: -45, expected: "↖"},
+	} {
+		if arrow := WindArrow(c.degrees); arrow != c.expected {
+			t.Errorf("WindArrow(%v) = %s, expected %s", c.degrees, arrow, c.expected)
+		}
+	}
+}
+
+func TestBuienradarStationCount(t *testing.T) {
+	feedUrl := buienradarFeed(t)
+
+	for _, c := range []struct {
+		regions  []string
+		expected string
+	}{
+		{regions: []string{"venlo"}, expected: "1"},
+		{regions: []string{"utrecht"}, expected: "2"},
+		{regions: []string{"texel"}, expected: "0"},
+	} {
+		provider := &BuienradarProvider{FeedUrl: feedUrl, Topic: "weather", Regions: c.regions}
+
+		readings, err := provider.Readings(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if counts := stationCounts(readings); !reflect.DeepEqual(counts, map[string]string{"weather": c.expected}) {
+			t.Errorf("expected %s stations for %v, got %v", c.expected, c.regions, counts)
+		}
+	}
+}
+
+func TestBuienradarSnowForecastFromFeed(t *testing.T) {
+	provider := &BuienradarProvider{FeedUrl: buienradarFeed(t), Topic: "weather", Regions: []string{"venlo"}}
+
+	readings, err := provider.Readings(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := WeatherReading{Topic: "weather", Metrics: []Metric{{Name: "snowfall", Value: "2"}, {Name: "snow.chance", Value: "70"}}}
+
+	if last := readings[len(readings)-1]; !reflect.DeepEqual(last, expected) {
+		t.Fatalf("expected the snow forecast of tomorrow last, got %+v", last)
+	}
+}
+
+func TestWeatherMetricNamesRenameSubtopics(t *testing.T) {
+	topics := payloads(weatherLoopMessages(t, map[string]string{
+		"WEATHER_REGION":       "venlo",
+		"WEATHER_METRIC_NAMES": "temperature.ground=temperature,humidity=rh",
+	}, 1))
+
+	for topic, expected := range map[string]string{"weather/temperature": "1.4", "weather/rh": "87", "weather/wind": "3.40"} {
+		if payload, exists := topics[topic]; !exists || payload != expected {
+			t.Errorf("expected `%s` on `%s`, got %q", expected, topic, payload)
+		}
+	}
+
+	for _, topic := range []string{"weather/temperature.ground", "weather/humidity"} {
+		if _, exists := topics[topic]; exists {
+			t.Errorf("expected nothing on the renamed `%s`", topic)
+		}
+	}
+}
+
+func TestWeatherStationMetricsNormalizeNumbers(t *testing.T) {
+	metrics := WeatherStationMetrics(WeatherAPIData{Humidity: "87", Rain: "0,3", WindDirection: "ZW", AirPressure: "-", SightRange: "far"}, false)
+
+	expected := []Metric{
+		{Name: "humidity", Value: "87"},
+		{Name: "wind.direction", Value: "ZW"},
+		{Name: "rain", Value: "0.3"},
+	}
+
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, metrics)
+	}
+}
+
+func TestWeatherJSON(t *testing.T) {
+	payload, err := WeatherJSON([]Metric{
+		{Name: "temperature.ground", Value: "1.4"},
+		{Name: "humidity", Value: "87"},
+		{Name: "wind.direction", Value: "ZW"},
+	}, MetricNames{"humidity": "rh"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"rh":87,"temperature.ground":1.4,"wind.direction":"ZW"}`; payload != expected {
+		t.Fatalf("expected %s, got %s", expected, payload)
+	}
+}
+
+func TestBuienradarSelectsStationByCode(t *testing.T) {
+	provider := &BuienradarProvider{FeedUrl: buienradarFeed(t), Topic: "weather", Code: "6348", Regions: []string{"venlo"}}
+
+	readings, err := provider.Readings(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stations []string
+
+	for _, reading := range readings {
+		if reading.Station != "" {
+			stations = append(stations, reading.Topic+"="+reading.Station)
+		}
+	}
+
+	if !reflect.DeepEqual(stations, []string{"weather=6348"}) {
+		t.Fatalf("expected only station 6348 on `weather`, got %v", stations)
+	}
+
+	if counts := stationCounts(readings); !reflect.DeepEqual(counts, map[string]string{"weather": "1"}) {
+		t.Fatalf("expected a single station, got %v", counts)
+	}
+}
+
+func TestBuienradarDiagnosesNoMatchOnce(t *testing.T) {
+	provider := &BuienradarProvider{FeedUrl: buienradarFeed(t), Topic: "weather", Code: "9999"}
+
+	buffer, restore := captureLog()
+	defer restore()
+
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Readings(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restore()
+
+	diagnostic := "matched no station for `weather`, available are 6391 (venlo), 6260 (utrecht), 6348 (utrecht), 6330 (hoek-van-holland), 6240 (amsterdam)"
+
+	if count := strings.Count(buffer.String(), diagnostic); count != 1 {
+		t.Fatalf("expected the stations to be listed once, got %d times in %q", count, buffer.String())
+	}
+}
+
+func TestWeatherLoopPublishesPerRegion(t *testing.T) {
+	topics := payloads(weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "utrecht,venlo,hoek-van-holland"}, 1))
+
+	for topic, expected := range map[string]string{
+		"weather/utrecht/station_count":          "2",
+		"weather/venlo/station_count":            "1",
+		"weather/hoek-van-holland/station_count": "1",
+		"weather/venlo/temperature.ground":       "1.4",
+		"weather/hoek-van-holland/wind":          "8.90",
+		"weather/snowfall":                       "2",
+	} {
+		if payload := topics[topic]; payload != expected {
+			t.Errorf("expected `%s` on `%s`, got %q", expected, topic, payload)
+		}
+	}
+
+	for _, topic := range []string{"weather/station_count", "weather/temperature.ground", "weather/amsterdam/station_count"} {
+		if _, exists := topics[topic]; exists {
+			t.Errorf("expected nothing on `%s` with several regions", topic)
+		}
+	}
+}
+
+func TestParseWeatherWindDirection(t *testing.T) {
+	location := parseWeatherFixture(t).Stations[0]
+
+	if location.WindDirection != "ZW" || location.WindDirectionDegrees != "225.0" {
+		t.Fatalf("expected the wind from `ZW` at 225 degrees, got `%s` at `%s`", location.WindDirection, location.WindDirectionDegrees)
+	}
+
+	var metrics []Metric
+
+	for _, metric := range WeatherStationMetrics(location, true) {
+		if strings.HasPrefix(metric.Name, "wind.") {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	expected := []Metric{
+		{Name: "wind.arrow", Value: "↙"},
+		{Name: "wind.direction", Value: "ZW"},
+		{Name: "wind.direction.degrees", Value: "225.0"},
+	}
+
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, metrics)
+	}
+}
+
+func TestWeatherWindArrowIsABoolean(t *testing.T) {
+	for _, c := range []struct {
+		arrow     string
+		published bool
+	}{
+		{arrow: "true", published: true},
+		{arrow: "1", published: true},
+		{arrow: "false", published: false},
+	} {
+		_, published := payloads(weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "venlo", "WEATHER_WIND_ARROW": c.arrow}, 1))["weather/wind.arrow"]
+
+		if published != c.published {
+			t.Errorf("expected `WEATHER_WIND_ARROW='%s'` to publish the arrow to be %t, got %t", c.arrow, c.published, published)
+		}
+	}
+}
+
+func TestWeatherWindBeaufortIsABoolean(t *testing.T) {
+	for _, c := range []struct {
+		beaufort  string
+		published bool
+	}{
+		{beaufort: "true", published: true},
+		{beaufort: "1", published: true},
+		{beaufort: "false", published: false},
+	} {
+		_, published := payloads(weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "venlo", "WEATHER_WIND_BEAUFORT": c.beaufort}, 1))["weather/wind.bft"]
+
+		if published != c.published {
+			t.Errorf("expected `WEATHER_WIND_BEAUFORT='%s'` to publish the Beaufort number to be %t, got %t", c.beaufort, c.published, published)
+		}
+	}
+}
+
+func TestParseWeatherTimestamp(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected time.Time
+	}{
+		{value: "01/15/2026 14:50:00", expected: time.Date(2026, 1, 15, 13, 50, 0, 0, time.UTC)},
+		{value: " 06/21/2026 14:50:00 ", expected: time.Date(2026, 6, 21, 12, 50, 0, 0, time.UTC)},
+	} {
+		timestamp, err := ParseWeatherTimestamp(c.value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !timestamp.Equal(c.expected) {
+			t.Errorf("ParseWeatherTimestamp(%q) = %s, expected %s", c.value, timestamp, c.expected)
+		}
+	}
+
+	if _, err := ParseWeatherTimestamp("2026-01-15T14:50:00"); err == nil {
+		t.Fatal("expected a timestamp in another format to be refused")
+	}
+}
+
+func TestWeatherDedupSkipsUnchangedReadings(t *testing.T) {
+	msgs := weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "venlo", "WEATHER_DEDUP": "true", "WEATHER_INTERVAL": "10ms"}, 2)
+
+	counts := make(map[string]int)
+
+	for _, m := range msgs {
+		counts[m.Topic]++
+	}
+
+	if counts["weather/temperature.ground"] != 1 || counts["weather/timestamp"] != 1 {
+		t.Fatalf("expected the unchanged reading to be published once, got %v", counts)
+	}
+
+	if counts["weather/station_count"] != 2 {
+		t.Fatalf("expected the station count on every fetch, got %v", counts)
+	}
+
+	dedup := make(WeatherDedup)
+	measured := time.Date(2026, 1, 15, 13, 50, 0, 0, time.UTC)
+
+	if !dedup.Changed("6391", measured) || dedup.Changed("6391", measured) || !dedup.Changed("6391", measured.Add(10*time.Minute)) || !dedup.Changed("6260", measured) {
+		t.Fatal("expected only a repeated measurement of the same station to be unchanged")
+	}
+}
+
+func TestWeatherLoopAgainstFeedServer(t *testing.T) {
+	msgs := weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "venlo"}, 1)
+
+	expected := []MqttCronMessage{
+		{Topic: "weather/humidity", Payload: "87"},
+		{Topic: "weather/temperature.ground", Payload: "1.4"},
+		{Topic: "weather/temperature.10cm", Payload: "0.9"},
+		{Topic: "weather/wind", Payload: "3.40"},
+		{Topic: "weather/gust", Payload: "6.20"},
+		{Topic: "weather/wind.direction", Payload: "ZW"},
+		{Topic: "weather/wind.direction.degrees", Payload: "225.0"},
+		{Topic: "weather/pressure", Payload: "1013.25"},
+		{Topic: "weather/rain", Payload: "0.3"},
+		{Topic: "weather/sight", Payload: "25000"},
+		{Topic: "weather/sun", Payload: "180"},
+		{Topic: "weather/timestamp", Payload: "2026-01-15T14:50:00+01:00"},
+		{Topic: "weather/temperature.apparent", Payload: "-2.2"},
+		{Topic: "weather/station_count", Payload: "1"},
+		{Topic: "weather/snowfall", Payload: "2"},
+		{Topic: "weather/snow.chance", Payload: "70"},
+	}
+
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, msgs)
+	}
+}
+
+func TestWeatherTopicStyles(t *testing.T) {
+	defer SetTopicStyle(topicStyle)
+
+	for _, c := range []struct {
+		style  string
+		topics []string
+	}{
+		{style: "dotted", topics: []string{"weather/temperature.ground", "weather/temperature.10cm", "weather/wind.direction.degrees", "weather/temperature.apparent", "weather/snow.chance"}},
+		{style: "nested", topics: []string{"weather/temperature/ground", "weather/temperature/10cm", "weather/wind/direction/degrees", "weather/temperature/apparent", "weather/snow/chance"}},
+	} {
+		if err := SetTopicStyle(c.style); err != nil {
+			t.Fatal(err)
+		}
+
+		topics := payloads(weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "venlo"}, 1))
+
+		for _, topic := range c.topics {
+			if _, exists := topics[topic]; !exists {
+				t.Errorf("expected `%s` in the %s style, got %v", topic, c.style, topics)
+			}
+		}
+
+		if topics["weather/humidity"] != "87" {
+			t.Errorf("expected single level names to be left alone in the %s style, got %v", c.style, topics)
+		}
+	}
+
+	if err := SetTopicStyle("flat"); err == nil {
+		t.Error("expected `flat` to be refused")
+	}
+}
+
+func TestWeatherWaterTemperature(t *testing.T) {
+	apiResult := parseWeatherFixture(t)
+
+	if water := apiResult.Stations[3].WaterTemperature; water != "6.2" {
+		t.Fatalf("expected a water temperature of 6.2 at Hoek van Holland, got %q", water)
+	}
+
+	coast := payloads(weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "hoek-van-holland"}, 1))
+
+	if coast["weather/temperature.water"] != "6.2" {
+		t.Errorf("expected `6.2` on `weather/temperature.water`, got %v", coast)
+	}
+
+	inland := payloads(weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "venlo"}, 1))
+
+	if water, exists := inland["weather/temperature.water"]; exists {
+		t.Errorf("expected no water temperature inland, got %q", water)
+	}
+}
+
+func TestBuienradarWarnsAboutAnEmptyFeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<buienradarnl><weergegevens><actueel_weer><weerstations></weerstations></actueel_weer></weergegevens></buienradarnl>")
+	}))
+	defer server.Close()
+
+	provider := &BuienradarProvider{FeedUrl: server.URL, Topic: "weather", Regions: []string{"venlo"}}
+
+	buffer, restore := captureLog()
+	defer restore()
+
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Readings(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restore()
+
+	if count := strings.Count(buffer.String(), "received no stations at all"); count != 1 {
+		t.Fatalf("expected the empty feed to be warned about once, got %d times in %q", count, buffer.String())
+	}
+
+	if strings.Contains(buffer.String(), "matched no station") {
+		t.Fatalf("expected an empty feed to not be taken for a region without stations, got %q", buffer.String())
+	}
+}
+
+func TestApparentTemperatureAgainstReferenceTables(t *testing.T) {
+	fahrenheit := func(f float64) float64 {
+		return (f - 32) * 5 / 9
+	}
+
+	for _, c := range []struct {
+		name     string
+		tempC    float64
+		windKMH  float64
+		humidity float64
+		expected float64
+	}{
+		{name: "wind chill", tempC: 0, windKMH: 10, humidity: 50, expected: -3},
+		{name: "wind chill", tempC: 5, windKMH: 40, humidity: 50, expected: -1},
+		{name: "wind chill", tempC: -10, windKMH: 20, humidity: 50, expected: -18},
+		{name: "wind chill", tempC: -20, windKMH: 30, humidity: 50, expected: -33},
+		{name: "heat index", tempC: fahrenheit(86), windKMH: 7, humidity: 40, expected: fahrenheit(85)},
+		{name: "heat index", tempC: fahrenheit(90), windKMH: 7, humidity: 60, expected: fahrenheit(100)},
+		{name: "heat index", tempC: fahrenheit(96), windKMH: 7, humidity: 50, expected: fahrenheit(108)},
+		{name: "heat index", tempC: fahrenheit(82), windKMH: 7, humidity: 90, expected: fahrenheit(91)},
+		{name: "calm", tempC: 10, windKMH: 3.6, humidity: 50, expected: 10},
+		{name: "mild", tempC: 20, windKMH: 18, humidity: 50, expected: 20},
+	} {
+		apparent := ApparentTemperature(c.tempC, c.windKMH/3.6, c.humidity)
+
+		if math.Abs(apparent-c.expected) > 0.6 {
+			t.Errorf("expected a %s of %.1f°C at %.1f°C, %.0f km/h, and %.0f%%, got %.1f°C", c.name, c.expected, c.tempC, c.windKMH, c.humidity, apparent)
+		}
+	}
+}
+
+func TestApparentTemperatureMetricNeedsEveryInput(t *testing.T) {
+	metrics := []Metric{{Name: "temperature.ground", Value: "1.4"}, {Name: "wind", Value: "3.40"}, {Name: "humidity", Value: "87"}}
+
+	if metric, exists := ApparentTemperatureMetric(metrics); !exists || metric != (Metric{Name: "temperature.apparent", Value: "-2.2"}) {
+		t.Fatalf("expected -2.2, got %+v", metric)
+	}
+
+	if metric, exists := ApparentTemperatureMetric([]Metric{metrics[0], metrics[1], {Name: "humidity", Value: ""}}); exists {
+		t.Fatalf("expected nothing without a humidity, got %+v", metric)
+	}
+}
+
+func TestWriteWeatherStations(t *testing.T) {
+	var out bytes.Buffer
+
+	if err := WriteWeatherStations(&out, parseWeatherFixture(t).Stations); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+
+	if len(lines) != 6 {
+		t.Fatalf("expected a header and 5 stations, got %q", out.String())
+	}
+
+	for idx, expected := range map[int]string{
+		0: "CODE  NAME                          REGION",
+		1: "6391  Meetstation Arcen             venlo",
+		4: "6330  Meetstation Hoek van Holland  hoek-van-holland",
+	} {
+		if lines[idx] != expected {
+			t.Errorf("expected line %d to be %q, got %q", idx, expected, lines[idx])
+		}
+	}
+}
+
+func TestPressureTrend(t *testing.T) {
+	for _, c := range []struct {
+		pressures []float64
+		trend     string
+	}{
+		{pressures: nil, trend: "steady"},
+		{pressures: []float64{1013}, trend: "steady"},
+		{pressures: []float64{1010, 1011, 1012.5}, trend: "rising"},
+		{pressures: []float64{1015, 1014.2, 1013.1}, trend: "falling"},
+		{pressures: []float64{1013, 1013.4, 1013.9}, trend: "steady"},
+		{pressures: []float64{1013, 1012.2, 1012}, trend: "steady"},
+		{pressures: []float64{1013, 1009, 1013.5}, trend: "steady"},
+	} {
+		if trend := PressureTrend(c.pressures, 1); trend != c.trend {
+			t.Errorf("PressureTrend(%v) = %s, expected %s", c.pressures, trend, c.trend)
+		}
+	}
+}
+
+func TestPressureHistoryTrend(t *testing.T) {
+	history := make(PressureHistory)
+	start := time.Date(2026, 1, 15, 14, 0, 0, 0, time.UTC)
+
+	reading := func(minutes int, pressure string) WeatherReading {
+		return WeatherReading{Topic: "weather", Time: start.Add(time.Duration(minutes) * time.Minute), Metrics: []Metric{{Name: "pressure", Value: pressure}}}
+	}
+
+	if metric, exists := history.Trend(reading(0, "1010.0"), 1); exists {
+		t.Fatalf("expected no trend from a single reading, got %+v", metric)
+	}
+
+	if metric, exists := history.Trend(reading(0, "1010.0"), 1); exists {
+		t.Fatalf("expected a repeated measurement to be kept once, got %+v", metric)
+	}
+
+	for _, c := range []struct {
+		minutes  int
+		pressure string
+		trend    string
+	}{
+		{minutes: 10, pressure: "1010.6", trend: "steady"},
+		{minutes: 20, pressure: "1011.2", trend: "rising"},
+	} {
+		if metric, exists := history.Trend(reading(c.minutes, c.pressure), 1); !exists || metric.Value != c.trend {
+			t.Errorf("expected %s after %s hPa, got %+v", c.trend, c.pressure, metric)
+		}
+	}
+
+	if metric, exists := history.Trend(reading(30, ""), 1); exists {
+		t.Errorf("expected no trend without a pressure, got %+v", metric)
+	}
+}
+
+func TestMSToKMH(t *testing.T) {
+	for ms, kmh := range map[float64]float64{0: 0, 1: 3.6, 3.4: 12.24, 10: 36} {
+		if got := MSToKMH(ms); math.Abs(got-kmh) > 1e-9 {
+			t.Errorf("MSToKMH(%.1f) = %f, expected %f", ms, got, kmh)
+		}
+	}
+}
+
+func TestMSToBeaufortBoundaries(t *testing.T) {
+	lowest := []float64{0, 0.3, 1.6, 3.4, 5.5, 8.0, 10.8, 13.9, 17.2, 20.8, 24.5, 28.5, 32.7}
+
+	for number, speed := range lowest {
+		if got := MSToBeaufort(speed); got != number {
+			t.Errorf("MSToBeaufort(%.1f) = %d, expected %d", speed, got, number)
+		}
+
+		if number > 0 {
+			if got := MSToBeaufort(speed - 0.01); got != number-1 {
+				t.Errorf("MSToBeaufort(%.2f) = %d, expected %d", speed-0.01, got, number-1)
+			}
+		}
+	}
+
+	if got := MSToBeaufort(60); got != 12 {
+		t.Errorf("expected hurricane force to stay at 12, got %d", got)
+	}
+}
+
+func TestGustAlertMetricFlipsAtTheThreshold(t *testing.T) {
+	alert := ""
+
+	for _, c := range []struct {
+		gust  string
+		alert string
+	}{
+		{gust: "8.0", alert: "no"},
+		{gust: "12.4", alert: "yes"},
+		{gust: "10.0", alert: "no"},
+		{gust: "10.1", alert: "yes"},
+		{gust: "3.2", alert: "no"},
+	} {
+		metric, ok := GustAlertMetric([]Metric{{Name: "wind", Value: "4.0"}, {Name: "gust", Value: c.gust}}, 10)
+
+		if !ok || metric.Name != "gust.alert" {
+			t.Fatalf("expected `gust.alert` for a gust of %s, got %+v", c.gust, metric)
+		}
+
+		if metric.Value != c.alert {
+			t.Errorf("expected the alert to go from `%s` to `%s` at a gust of %s, got `%s`", alert, c.alert, c.gust, metric.Value)
+		}
+
+		alert = metric.Value
+	}
+
+	for _, metrics := range [][]Metric{{{Name: "wind", Value: "4.0"}}, {{Name: "gust", Value: "-"}}} {
+		if metric, ok := GustAlertMetric(metrics, 10); ok {
+			t.Errorf("expected no alert without a known gust in %+v, got %+v", metrics, metric)
+		}
+	}
+}
+
+func TestWeatherLoopPublishesTheGustAlert(t *testing.T) {
+	for _, c := range []struct {
+		threshold string
+		alert     string
+	}{
+		{threshold: "6", alert: "yes"},
+		{threshold: "6.5", alert: "no"},
+	} {
+		topics := payloads(weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "venlo", "WEATHER_GUST_THRESHOLD": c.threshold}, 1))
+
+		if alert := topics["weather/gust.alert"]; alert != c.alert {
+			t.Errorf("expected `%s` on `weather/gust.alert` for a gust of 6.20 at %s m/s, got `%s`", c.alert, c.threshold, alert)
+		}
+
+		if gust := topics["weather/gust"]; gust != "6.20" {
+			t.Errorf("expected the gust to be published as well, got `%s`", gust)
+		}
+	}
+
+	if alert, exists := payloads(weatherLoopMessages(t, map[string]string{"WEATHER_REGION": "venlo"}, 1))["weather/gust.alert"]; exists {
+		t.Errorf("expected no alert without a threshold, got `%s`", alert)
+	}
+}
@@ -0,0 +1,189 @@
+package magpie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weatherWarningLog = NewLogger("weatherwarning")
+
+/* A parameter of a warning, such as `awareness_level` with the value
+ * `2; yellow; Moderate`. */
+type WeatherWarningAPIParameter struct {
+	ValueName string `json:"valueName"`
+	Value     string `json:"value"`
+}
+
+/* An area a warning applies to, Dutch areas are the provinces. */
+type WeatherWarningAPIArea struct {
+	AreaDesc string `json:"areaDesc"`
+}
+
+/* A warning in a single language. */
+type WeatherWarningAPIInfo struct {
+	Language  string                       `json:"language"`
+	Headline  string                       `json:"headline"`
+	Onset     time.Time                    `json:"onset"`
+	Expires   time.Time                    `json:"expires"`
+	Parameter []WeatherWarningAPIParameter `json:"parameter"`
+	Area      []WeatherWarningAPIArea      `json:"area"`
+}
+
+type WeatherWarningAPIAlert struct {
+	Info []WeatherWarningAPIInfo `json:"info"`
+}
+
+type WeatherWarningAPIWarning struct {
+	Alert WeatherWarningAPIAlert `json:"alert"`
+}
+
+/* Result from the `meteoalarm.org` feed, which carries the warnings of
+ * KNMI for the Netherlands. */
+type WeatherWarningAPIResult struct {
+	Warnings []WeatherWarningAPIWarning `json:"warnings"`
+}
+
+/* The colors of the warning levels from the lowest to the highest. */
+var weatherWarningColors = []string{"green", "yellow", "orange", "red"}
+
+/* The current warning of a region, `green` without a description when
+ * there is none. */
+type WeatherWarning struct {
+	Color       string
+	Description string
+}
+
+/* The rank of a warning color, `0` for green and colors that are not
+ * known. */
+func weatherWarningRank(color string) int {
+	for rank, known := range weatherWarningColors {
+		if known == color {
+			return rank
+		}
+	}
+
+	return 0
+}
+
+/* The color of an `awareness_level` such as `2; yellow; Moderate`. */
+func weatherWarningColor(info WeatherWarningAPIInfo) string {
+	for _, parameter := range info.Parameter {
+		if parameter.ValueName != "awareness_level" {
+			continue
+		}
+
+		if parts := strings.Split(parameter.Value, ";"); len(parts) >= 2 {
+			return strings.ToLower(strings.TrimSpace(parts[1]))
+		}
+	}
+
+	return ""
+}
+
+/* Determine if a warning applies to `region` at `now`, regions are compared
+ * without regard to case. */
+func weatherWarningApplies(info WeatherWarningAPIInfo, region string, now time.Time) bool {
+	if !info.Onset.IsZero() && now.Before(info.Onset) {
+		return false
+	}
+
+	if !info.Expires.IsZero() && !now.Before(info.Expires) {
+		return false
+	}
+
+	for _, area := range info.Area {
+		if strings.EqualFold(strings.TrimSpace(area.AreaDesc), region) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/* Parse the `meteoalarm.org` feed into the highest warning in effect for
+ * `region` at `now`. Without any such warning the region is `green`. */
+func ParseWeatherWarnings(body []byte, region string, now time.Time) (WeatherWarning, error) {
+	var apiResult WeatherWarningAPIResult
+
+	if err := json.Unmarshal(body, &apiResult); err != nil {
+		return WeatherWarning{}, fmt.Errorf("could not parse the response: %w", err)
+	}
+
+	warning := WeatherWarning{Color: weatherWarningColors[0]}
+
+	for _, w := range apiResult.Warnings {
+		for _, info := range w.Alert.Info {
+			if !weatherWarningApplies(info, region, now) {
+				continue
+			}
+
+			color := weatherWarningColor(info)
+			rank := weatherWarningRank(color)
+			highest := weatherWarningRank(warning.Color)
+
+			/* Warnings come in Dutch and English, prefer the English
+			 * description of an equally high warning. */
+			if rank > highest || (rank == highest && rank > 0 && strings.HasPrefix(info.Language, "en")) {
+				warning = WeatherWarning{Color: color, Description: info.Headline}
+			}
+		}
+	}
+
+	return warning, nil
+}
+
+/* Call the `meteoalarm.org` feed and return the warning of `region` at
+ * `now`. */
+func WeatherWarningAPICall(ctx context.Context, apiUrl string, region string, now time.Time) (WeatherWarning, error) {
+	body, err := httpGet(ctx, apiUrl)
+
+	if err != nil {
+		return WeatherWarning{}, err
+	}
+
+	return ParseWeatherWarnings(body, region, now)
+}
+
+/* A loop that waits between calls to the `meteoalarm.org` feed and submits
+ * the color of the KNMI warning of the province in `WEATHERWARNING_REGION`
+ * to the topic given in the environment variable `WEATHERWARNING_TOPIC`,
+ * and its description to `<topic>/description`. */
+func WeatherWarningLoop(ctx context.Context, ch chan MqttCronMessage, cfg SourceConfig) {
+	region := strings.TrimSpace(cfg.Get("WEATHERWARNING_REGION"))
+
+	if region == "" {
+		weatherWarningLog.Println("WeatherWarningLoop needs `WEATHERWARNING_REGION` set in the environment to a province such as `Noord-Holland`, disabled.")
+		return
+	}
+
+	weatherWarningLog.Println("WeatherWarningLoop enabled.")
+
+	for {
+		var warning WeatherWarning
+
+		if !fetchWithRetry(ctx, cfg, weatherWarningLog, "WeatherWarningLoop could not fetch the warnings", func() error {
+			var err error
+
+			warning, err = WeatherWarningAPICall(ctx, "https://feeds.meteoalarm.org/api/v1/warnings/feeds-netherlands", region, cfg.Now())
+
+			return err
+		}) {
+			return
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: cfg.Topic, Payload: warning.Color}) {
+			return
+		}
+
+		if !sendMessage(ctx, ch, MqttCronMessage{Retain: cfg.Retain, Topic: buildTopic(cfg.Topic, "description"), Payload: warning.Description}) {
+			return
+		}
+
+		if !sleepContext(ctx, cfg.Interval) {
+			return
+		}
+	}
+}
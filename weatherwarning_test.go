@@ -0,0 +1,52 @@
+package magpie
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseWeatherWarnings(t *testing.T) {
+	body, err := os.ReadFile("testdata/weatherwarning.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noon := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		region   string
+		at       time.Time
+		expected WeatherWarning
+	}{
+		{region: "Utrecht", at: noon, expected: WeatherWarning{Color: "yellow", Description: "Code yellow: severe gusts"}},
+		{region: "gelderland", at: noon, expected: WeatherWarning{Color: "yellow", Description: "Code yellow: severe gusts"}},
+		{region: "Zeeland", at: noon, expected: WeatherWarning{Color: "orange", Description: "Code orange: storm surge"}},
+		{region: "Utrecht", at: time.Date(2026, 1, 15, 18, 0, 0, 0, time.UTC), expected: WeatherWarning{Color: "green"}},
+		{region: "Utrecht", at: time.Date(2026, 1, 15, 5, 59, 0, 0, time.UTC), expected: WeatherWarning{Color: "green"}},
+		{region: "Groningen", at: noon, expected: WeatherWarning{Color: "green"}},
+	} {
+		warning, err := ParseWeatherWarnings(body, c.region, c.at)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if warning != c.expected {
+			t.Errorf("expected %+v for %s at %s, got %+v", c.expected, c.region, c.at, warning)
+		}
+	}
+}
+
+func TestParseWeatherWarningsWithoutWarnings(t *testing.T) {
+	warning, err := ParseWeatherWarnings([]byte(`{"warnings": []}`), "Utrecht", time.Now())
+
+	if err != nil || warning != (WeatherWarning{Color: "green"}) {
+		t.Fatalf("expected green without a description, got %+v and %v", warning, err)
+	}
+
+	if _, err := ParseWeatherWarnings([]byte(`{"warnings": {}}`), "Utrecht", time.Now()); err == nil {
+		t.Fatal("expected a malformed response to be refused")
+	}
+}